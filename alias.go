@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// maxAliasDepth limits how many aliases may expand into each other.
+const maxAliasDepth = 10
+
+// expandAlias replaces a user-defined alias in the first argument with its
+// expansion, e.g. "i" -> "get --no-deps". Aliases may refer to other
+// aliases, but not to themselves. Built-in commands always take precedence.
+func expandAlias(args []string, aliases map[string]string, isCommand func(string) bool) ([]string, error) {
+	seen := make(map[string]bool)
+
+	for len(args) > 0 {
+		name := args[0]
+		expansion, ok := aliases[name]
+		if !ok || isCommand(name) {
+			return args, nil
+		}
+
+		if seen[name] || len(seen) == maxAliasDepth {
+			return nil, fmt.Errorf("alias %q is recursive", name)
+		}
+		seen[name] = true
+
+		fields := strings.Fields(expansion)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("alias %q is empty", name)
+		}
+		args = append(fields, args[1:]...)
+	}
+
+	return args, nil
+}
+
+// builtinCommand reports whether name is a command or command alias of root.
+func builtinCommand(root *cobra.Command) func(string) bool {
+	return func(name string) bool {
+		if name == "help" || name == "completion" {
+			return true
+		}
+		for _, cmd := range root.Commands() {
+			if cmd.Name() == name || cmd.HasAlias(name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// warnShadowedAliases tells the user about aliases that can never be used
+// because a built-in command has the same name.
+func warnShadowedAliases(aliases map[string]string, isCommand func(string) bool) {
+	for name := range aliases {
+		if isCommand(name) {
+			warnf("alias %q is ignored, it has the same name as a built-in command\n", name)
+		}
+	}
+}
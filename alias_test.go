@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandAlias(t *testing.T) {
+	aliases := map[string]string{
+		"i":    "get --no-deps",
+		"up":   "i --show-resolved",
+		"loop": "loop --x",
+		"a":    "b",
+		"b":    "a",
+		"get":  "search",
+	}
+	isCommand := func(name string) bool {
+		return name == "get" || name == "search"
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"no alias", []string{"search", "chart"}, []string{"search", "chart"}, false},
+		{"alias", []string{"i", "@preview/cetz"}, []string{"get", "--no-deps", "@preview/cetz"}, false},
+		{"nested alias", []string{"up", "@preview/cetz"}, []string{"get", "--no-deps", "--show-resolved", "@preview/cetz"}, false},
+		{"builtin wins", []string{"get", "@preview/cetz"}, []string{"get", "@preview/cetz"}, false},
+		{"self recursive", []string{"loop"}, nil, true},
+		{"mutually recursive", []string{"a"}, nil, true},
+		{"no args", []string{}, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandAlias(tt.args, aliases, isCommand)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandAlias() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandAlias() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
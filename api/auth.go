@@ -2,7 +2,9 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,10 +15,25 @@ import (
 )
 
 const (
+	// pollInterval is used if the server does not specify one.
 	pollInterval = 5 * time.Second
+	// slowDownIncrement is added to the interval on a slow_down error, as
+	// required by RFC 8628.
+	slowDownIncrement = 5 * time.Second
 )
 
-func DeviceLogin() (*TokenResponse, error) {
+// errSlowDown is returned by pollForToken when the server asks the client
+// to poll less frequently.
+var errSlowDown = errors.New("polling too frequently")
+
+// ErrInvalidToken is returned by CurrentUser and MyPackages when the server
+// rejects the access token.
+var ErrInvalidToken = errors.New("access token is invalid or expired")
+
+// DeviceLogin logs in with the OAuth 2.0 device flow. The verification URI
+// is opened in the browser if openBrowser is set, otherwise it is only
+// printed along with the code.
+func DeviceLogin(openBrowser bool) (*TokenResponse, error) {
 	// Initiate device flow
 	resp, err := makeRequest("POST", "/auth/device/code", nil, "")
 	if err != nil {
@@ -34,15 +51,21 @@ func DeviceLogin() (*TokenResponse, error) {
 	fmt.Printf("Visit: %s\n", deviceResp.VerificationURI)
 	fmt.Printf("Enter code: %s\n", deviceResp.UserCode)
 	fmt.Printf("Code expires in %d seconds\n", deviceResp.ExpiresIn)
-	fmt.Printf("If the browser does not open, please open the above URL manually.")
 
-	// open the url for user
-	utils.OpenURL(deviceResp.VerificationURI)
+	if openBrowser {
+		fmt.Printf("If the browser does not open, please open the above URL manually.")
+		// open the url for user
+		utils.OpenURL(deviceResp.VerificationURI)
+	} else {
+		fmt.Printf("Open the above URL in a browser and enter the code.")
+	}
 
 	// Poll for token
 	timeout := time.After(time.Duration(deviceResp.ExpiresIn) * time.Second)
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
+	interval := pollInterval
+	if deviceResp.Interval > 0 {
+		interval = time.Duration(deviceResp.Interval) * time.Second
+	}
 
 	hostname, _ := os.Hostname()
 
@@ -50,8 +73,12 @@ func DeviceLogin() (*TokenResponse, error) {
 		select {
 		case <-timeout:
 			return nil, fmt.Errorf("device code expired, please try again.")
-		case <-ticker.C:
+		case <-time.After(interval):
 			tokenResp, pending, err := pollForToken(deviceResp.DeviceCode, hostname)
+			if errors.Is(err, errSlowDown) {
+				interval += slowDownIncrement
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -93,6 +120,8 @@ func pollForToken(deviceCode string, hostname string) (*TokenResponse, bool, err
 	switch errResp.Error {
 	case "authorization_pending":
 		return nil, true, nil // Keep polling
+	case "slow_down":
+		return nil, true, errSlowDown
 	case "access_denied":
 		return nil, false, fmt.Errorf("authorization denied by user")
 	case "expired_token":
@@ -101,3 +130,28 @@ func pollForToken(deviceCode string, hostname string) (*TokenResponse, bool, err
 		return nil, false, fmt.Errorf("error: %s", errResp.Description)
 	}
 }
+
+// CurrentUser returns the account that token belongs to. It is meant to
+// validate a token before it is stored, so token is sent as is instead of
+// the stored credentials, and is never refreshed.
+func CurrentUser(token string) (*UserResponse, error) {
+	resp, err := doRequest(context.Background(), "GET", "/api/v1/me", nil, nil, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrInvalidToken
+	default:
+		return nil, statusError(resp, "failed to get user")
+	}
+
+	var user UserResponse
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &user, nil
+}
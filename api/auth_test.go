@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestPollForToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        any
+		wantPending bool
+		wantErr     string
+		wantToken   string
+	}{
+		{"token", http.StatusOK, TokenResponse{AccessToken: "token"}, false, "", "token"},
+		{"pending", http.StatusBadRequest, ErrorResponse{Error: "authorization_pending"}, true, "", ""},
+		{"slow down", http.StatusBadRequest, ErrorResponse{Error: "slow_down"}, true, errSlowDown.Error(), ""},
+		{"denied", http.StatusBadRequest, ErrorResponse{Error: "access_denied"}, false, "authorization denied by user", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/auth/device/token", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(tt.body)
+			})
+			setupServer(t, mux)
+
+			token, pending, err := pollForToken("device-code", "host")
+			if pending != tt.wantPending {
+				t.Errorf("pollForToken() pending = %v, want %v", pending, tt.wantPending)
+			}
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("pollForToken() error = %q, want %q", gotErr, tt.wantErr)
+			}
+			if tt.wantToken != "" && (token == nil || token.AccessToken != tt.wantToken) {
+				t.Errorf("pollForToken() token = %+v, want %q", token, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer valid-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(UserResponse{ID: "1", Username: "alice"})
+	})
+	setupServer(t, mux)
+
+	user, err := CurrentUser("valid-token")
+	if err != nil {
+		t.Fatalf("CurrentUser() error = %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("CurrentUser() username = %q, want %q", user.Username, "alice")
+	}
+
+	if _, err := CurrentUser("revoked-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("CurrentUser() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// batchFetchConcurrency limits the number of parallel requests made when
+// the server does not support fetching packages in a batch.
+const batchFetchConcurrency = 8
+
+// batchUnsupported is set once the server turned out not to support the
+// batch endpoint, so that it is not asked again.
+var batchUnsupported atomic.Bool
+
+// BatchFetchPackages fetches the details of several packages, given as
+// "@namespace/name", with a single request. If the server does not support
+// batch requests, the packages are fetched concurrently one by one instead.
+//
+// The result maps each spec to the package details. Packages that could not
+// be fetched are missing from it and reported in the returned error, which
+// does not invalidate the other results.
+func BatchFetchPackages(specs []string) (map[string]*PackageResponse, error) {
+	result := make(map[string]*PackageResponse, len(specs))
+	var errs []error
+	var pending []string
+
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if seen[spec] {
+			continue
+		}
+		seen[spec] = true
+
+		namespace, name, err := splitPackageSpec(spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if pkg, ok := cachedPackage(namespace, name); ok {
+			result[spec] = pkg
+			continue
+		}
+		pending = append(pending, spec)
+	}
+
+	if len(pending) == 0 {
+		return result, errors.Join(errs...)
+	}
+
+	if !batchUnsupported.Load() {
+		fetched, err := fetchPackagesBatch(pending)
+		if err == nil {
+			for _, spec := range pending {
+				if pkg, ok := fetched[spec]; ok {
+					result[spec] = pkg
+				} else {
+					errs = append(errs, fmt.Errorf("package %s not found", spec))
+				}
+			}
+			return result, errors.Join(errs...)
+		}
+		if !errors.Is(err, errBatchUnsupported) {
+			return result, errors.Join(append(errs, err)...)
+		}
+		batchUnsupported.Store(true)
+	}
+
+	fetched, err := fetchPackagesConcurrently(pending)
+	for spec, pkg := range fetched {
+		result[spec] = pkg
+	}
+	return result, errors.Join(append(errs, err)...)
+}
+
+// errBatchUnsupported is returned by fetchPackagesBatch if the server has
+// no batch endpoint.
+var errBatchUnsupported = errors.New("batch requests are not supported")
+
+// fetchPackagesBatch fetches the details of all packages in specs from the
+// batch endpoint.
+func fetchPackagesBatch(specs []string) (map[string]*PackageResponse, error) {
+	body, err := json.Marshal(BatchPackagesRequest{Packages: specs})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := makeRequest("POST", "/api/v1/packages/batch", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch packages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errBatchUnsupported
+	default:
+		return nil, statusError(resp, "failed to get packages")
+	}
+
+	var batchResp BatchPackagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batchResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	result := make(map[string]*PackageResponse, len(batchResp.Packages))
+	for i := range batchResp.Packages {
+		pkg := &batchResp.Packages[i]
+		storePackage(pkg.Namespace, pkg.Name, pkg)
+		result[packageKey(pkg.Namespace, pkg.Name)] = pkg
+	}
+
+	// Map the results back to the specs as given, which may lack the "@"
+	for _, spec := range specs {
+		if namespace, name, err := splitPackageSpec(spec); err == nil {
+			if pkg, ok := result[packageKey(namespace, name)]; ok {
+				result[spec] = pkg
+			}
+		}
+	}
+	return result, nil
+}
+
+// fetchPackagesConcurrently fetches the details of all packages in specs
+// with one FetchPackage call each, running at most batchFetchConcurrency
+// at a time.
+func fetchPackagesConcurrently(specs []string) (map[string]*PackageResponse, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = make(map[string]*PackageResponse, len(specs))
+		errs   []error
+		limit  = make(chan struct{}, batchFetchConcurrency)
+	)
+
+	for _, spec := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			namespace, name, _ := splitPackageSpec(spec)
+			pkg, err := FetchPackage(namespace, name)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", spec, err))
+				return
+			}
+			result[spec] = pkg
+		}()
+	}
+
+	wg.Wait()
+	return result, errors.Join(errs...)
+}
+
+// splitPackageSpec splits "@namespace/name" into its parts. The leading "@"
+// is optional.
+func splitPackageSpec(spec string) (namespace, name string, err error) {
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(spec, "@"), "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid package %q, expected @namespace/name", spec)
+	}
+	return namespace, name, nil
+}
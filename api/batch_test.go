@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBatchFetchPackages(t *testing.T) {
+	var batchRequests, singleRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/packages/batch", func(w http.ResponseWriter, r *http.Request) {
+		batchRequests.Add(1)
+		var req BatchPackagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode batch request: %v", err)
+			return
+		}
+		if len(req.Packages) != 3 {
+			t.Errorf("batch request packages = %v, want 3 entries", req.Packages)
+		}
+		json.NewEncoder(w).Encode(BatchPackagesResponse{Packages: []PackageResponse{
+			{Namespace: "preview", Name: "a", LatestVersion: PackageVersionInfo{Version: "1.0.0"}},
+			{Namespace: "preview", Name: "b", LatestVersion: PackageVersionInfo{Version: "2.0.0"}},
+		}})
+	})
+	mux.HandleFunc("/api/v1/packages/", func(w http.ResponseWriter, r *http.Request) {
+		singleRequests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	setupServer(t, mux)
+
+	got, err := BatchFetchPackages([]string{"@preview/a", "preview/b", "@preview/missing", "@preview/a"})
+	if err == nil {
+		t.Error("BatchFetchPackages() expected error for missing package")
+	}
+	if got["@preview/a"] == nil || got["@preview/a"].LatestVersion.Version != "1.0.0" {
+		t.Errorf("@preview/a = %+v, want version 1.0.0", got["@preview/a"])
+	}
+	if got["preview/b"] == nil || got["preview/b"].LatestVersion.Version != "2.0.0" {
+		t.Errorf("preview/b = %+v, want version 2.0.0", got["preview/b"])
+	}
+	if _, ok := got["@preview/missing"]; ok {
+		t.Error("missing package is in the result")
+	}
+	if n := batchRequests.Load(); n != 1 {
+		t.Errorf("batch requests = %d, want 1", n)
+	}
+	if n := singleRequests.Load(); n != 0 {
+		t.Errorf("single package requests = %d, want 0", n)
+	}
+}
+
+func TestBatchFetchPackagesFallback(t *testing.T) {
+	var batchRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/packages/batch", func(w http.ResponseWriter, r *http.Request) {
+		batchRequests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /api/v1/packages/preview/{name}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageResponse{Namespace: "preview", Name: r.PathValue("name")})
+	})
+	mux.HandleFunc("GET /api/v1/packages/preview/{name}/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{Versions: []PackageVersionInfo{{Version: "0.1.0"}}})
+	})
+	setupServer(t, mux)
+
+	specs := []string{"@preview/a", "@preview/b", "@preview/c"}
+	got, err := BatchFetchPackages(specs)
+	if err != nil {
+		t.Fatalf("BatchFetchPackages() error = %v", err)
+	}
+	for _, spec := range specs {
+		pkg := got[spec]
+		if pkg == nil || len(pkg.Versions) != 1 {
+			t.Errorf("%s = %+v, want package with versions", spec, pkg)
+		}
+	}
+
+	// The unsupported batch endpoint is not asked again
+	Refresh = true
+	defer func() { Refresh = false }()
+	if _, err := BatchFetchPackages(specs); err != nil {
+		t.Fatalf("BatchFetchPackages() error = %v", err)
+	}
+	if n := batchRequests.Load(); n != 1 {
+		t.Errorf("batch requests = %d, want 1", n)
+	}
+}
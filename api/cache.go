@@ -0,0 +1,93 @@
+package api
+
+import (
+	"slices"
+	"sync"
+)
+
+// Refresh disables the memoization of package lookups, so that every call
+// asks the server again.
+var Refresh bool
+
+// packageCache memoizes package details and versions by "@namespace/name"
+// for the lifetime of the process. Commands often look up the same package
+// several times, e.g. once per cached version.
+var packageCache = struct {
+	sync.Mutex
+	packages map[string]*PackageResponse
+	versions map[string][]PackageVersionInfo
+}{
+	packages: make(map[string]*PackageResponse),
+	versions: make(map[string][]PackageVersionInfo),
+}
+
+func packageKey(namespace, name string) string {
+	return "@" + namespace + "/" + name
+}
+
+func cachedPackage(namespace, name string) (*PackageResponse, bool) {
+	if Refresh {
+		return nil, false
+	}
+
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	pkg, ok := packageCache.packages[packageKey(namespace, name)]
+	if !ok {
+		return nil, false
+	}
+	// Callers may modify the response and its versions
+	copied := *pkg
+	copied.Versions = slices.Clone(pkg.Versions)
+	return &copied, true
+}
+
+func storePackage(namespace, name string, pkg *PackageResponse) {
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	copied := *pkg
+	copied.Versions = slices.Clone(pkg.Versions)
+	packageCache.packages[packageKey(namespace, name)] = &copied
+}
+
+func cachedVersions(namespace, name string) ([]PackageVersionInfo, bool) {
+	if Refresh {
+		return nil, false
+	}
+
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	versions, ok := packageCache.versions[packageKey(namespace, name)]
+	return slices.Clone(versions), ok
+}
+
+func storeVersions(namespace, name string, versions []PackageVersionInfo) {
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	packageCache.versions[packageKey(namespace, name)] = slices.Clone(versions)
+}
+
+// forgetPackage drops the memoized lookups of a package, e.g. after a new
+// version was uploaded.
+func forgetPackage(namespace, name string) {
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	delete(packageCache.packages, packageKey(namespace, name))
+	delete(packageCache.versions, packageKey(namespace, name))
+}
+
+// resetPackageCache forgets all memoized package lookups, including whether
+// the server supports batch requests.
+func resetPackageCache() {
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	clear(packageCache.packages)
+	clear(packageCache.versions)
+	batchUnsupported.Store(false)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotAuthorized is returned when the server rejects a request with HTTP
+// 401 or 403.
+var ErrNotAuthorized = errors.New("not authorized, run 'tpix login'")
+
+// ErrRateLimited is returned when the server rejects a request with HTTP 429.
+var ErrRateLimited = errors.New("rate limited by the server")
+
+// NotFoundError is returned when the server has no package of the requested
+// name, or no such version of it if Version is set.
+type NotFoundError struct {
+	Namespace string
+	Name      string
+	Version   string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Version != "" {
+		return fmt.Sprintf("version %s of @%s/%s not found", e.Version, e.Namespace, e.Name)
+	}
+	return fmt.Sprintf("package @%s/%s not found", e.Namespace, e.Name)
+}
+
+// Is makes a missing package match ErrPackageNotFound.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrPackageNotFound && e.Version == ""
+}
+
+// maxErrorBody is how much of an unexpected response is quoted in an error.
+const maxErrorBody = 1024
+
+// statusError returns the error for an unsuccessful response, prefixed with
+// what, e.g. "search failed". Statuses with a well-known meaning get a short
+// message; for any other the body is included, as it may tell what went
+// wrong.
+func statusError(resp *http.Response, what string) error {
+	if err := knownStatusError(resp); err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("%s: %s", what, msg)
+	}
+	return fmt.Errorf("%s: %s", what, resp.Status)
+}
+
+// knownStatusError returns the error for a response status with a
+// well-known meaning, or nil. A rate limit error tells when to try again if
+// the server says so.
+func knownStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrNotAuthorized
+	case http.StatusTooManyRequests:
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return fmt.Errorf("%w, try again in %s", ErrRateLimited, wait.Round(time.Second))
+		}
+		return fmt.Errorf("%w, try again later", ErrRateLimited)
+	}
+	return nil
+}
@@ -2,27 +2,80 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/typstify/tpix-cli/config"
+	"github.com/typstify/tpix-cli/version"
 )
 
 const (
-	TpixServer          = "https://tpix.typstify.com"
-	TpixClientUserAgent = "tpix-client/v1.0.0"
+	TpixServer = "https://tpix.typstify.com"
 )
 
+var (
+	// serverURL is the base URL all API requests are sent to.
+	serverURL = TpixServer
+
+	// loadConfig and saveConfig are indirections over the config package so
+	// that tests do not read or overwrite the user's settings.
+	loadConfig = config.Load
+	saveConfig = config.Save
+
+	// httpClient sends all API requests.
+	httpClient = &http.Client{}
+)
+
+// ServerURL returns the base URL of the TPIX server requests are sent to.
+func ServerURL() string {
+	return serverURL
+}
+
 // refreshMu prevents concurrent refresh attempts
 var refreshMu sync.Mutex
 
+// tokenRefreshMargin is how long before its expiry an access token is
+// refreshed, so that it does not expire while a request is in flight.
+const tokenRefreshMargin = 60 * time.Second
+
+// expiredTokenWarning makes sure the user is only told once per run that
+// their token expired.
+var expiredTokenWarning sync.Once
+
+// tokenExpiresSoon reports whether the access token in cfg expires within
+// tokenRefreshMargin. Tokens without a known expiry never do.
+func tokenExpiresSoon(cfg config.Config) bool {
+	return !cfg.TokenExpiry.IsZero() && time.Until(cfg.TokenExpiry) < tokenRefreshMargin
+}
+
 // makeRequest creates an HTTP request with Bearer token.
 // On 401 responses, it transparently attempts to refresh the access token
 // and retries the request once.
 func makeRequest(method, url string, body io.Reader, contentType string) (*http.Response, error) {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return makeRequestWithHeader(context.Background(), method, url, body, header)
+}
+
+// makeRequestContext is makeRequest with a context that cancels the request.
+func makeRequestContext(ctx context.Context, method, url string, body io.Reader, contentType string) (*http.Response, error) {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return makeRequestWithHeader(ctx, method, url, body, header)
+}
+
+// makeRequestWithHeader is makeRequestContext with additional request headers.
+func makeRequestWithHeader(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
 	// Buffer the body so we can replay it on retry
 	var bodyBytes []byte
 	if body != nil {
@@ -33,43 +86,93 @@ func makeRequest(method, url string, body io.Reader, contentType string) (*http.
 		}
 	}
 
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := doRequest(method, url, bodyBytes, contentType, cfg.AccessToken)
+	// Refresh a token about to expire up front instead of waiting for a 401,
+	// which would mean sending large uploads twice.
+	if cfg.AccessToken != "" && tokenExpiresSoon(cfg) {
+		if cfg.RefreshToken == "" {
+			expiredTokenWarning.Do(func() {
+				fmt.Fprintln(os.Stderr, "Warning: your access token has expired, please run 'tpix login' again.")
+			})
+		} else if refreshAccessToken(cfg) == nil {
+			if cfg, err = loadConfig(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp, err := doRequestWithRetry(ctx, method, url, bodyBytes, header, cfg.AccessToken)
 	if err != nil {
 		return nil, err
 	}
 
 	// If 401 and we have a refresh token, try to refresh and retry
-	if resp.StatusCode == http.StatusUnauthorized && cfg.RefreshToken != "" {
+	// A token from TPIX_TOKEN has no refresh token and is never refreshed.
+	if resp.StatusCode == http.StatusUnauthorized && cfg.RefreshToken != "" && !cfg.TokenFromEnv {
 		resp.Body.Close()
 		if refreshErr := refreshAccessToken(cfg); refreshErr == nil {
 			// reload config
-			cfg, err := config.Load()
+			cfg, err := loadConfig()
 			if err != nil {
 				return nil, err
 			}
 
-			return doRequest(method, url, bodyBytes, contentType, cfg.AccessToken)
+			return doRequestWithRetry(ctx, method, url, bodyBytes, header, cfg.AccessToken)
 		}
 	}
 
 	return resp, nil
 }
 
+// maxGetRetryAfter is the longest a GET request waits for a rate limit to
+// pass. If the server asks to wait longer, the 429 response is returned so
+// that the caller can tell the user when to try again.
+const maxGetRetryAfter = 30 * time.Second
+
+// OnRateLimit, if set, is called before a rate limited GET request is sent
+// again after waiting for wait.
+var OnRateLimit RetryFunc
+
+// doRequestWithRetry is doRequest, except that GET requests rejected with
+// HTTP 429 are sent again after the time given in the Retry-After header,
+// up to maxRateLimitRetries times. Other requests are never retried here,
+// as they may not be safe to send twice.
+func doRequestWithRetry(ctx context.Context, method, url string, bodyBytes []byte, header http.Header, accessToken string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := doRequest(ctx, method, url, bodyBytes, header, accessToken)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || method != http.MethodGet || attempt == maxRateLimitRetries {
+			return resp, err
+		}
+
+		wait := retryAfter(resp.Header.Get("Retry-After"), attempt)
+		if wait > maxGetRetryAfter {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if OnRateLimit != nil {
+			OnRateLimit(wait)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
 // doRequest executes a single HTTP request without retry logic.
-func doRequest(method, url string, bodyBytes []byte, contentType string, accessToken string) (*http.Response, error) {
-	apiUrl := fmt.Sprintf("%s%s", TpixServer, url)
+func doRequest(ctx context.Context, method, url string, bodyBytes []byte, header http.Header, accessToken string) (*http.Response, error) {
+	apiUrl := fmt.Sprintf("%s%s", serverURL, url)
 
 	var bodyReader io.Reader
 	if bodyBytes != nil {
 		bodyReader = bytes.NewReader(bodyBytes)
 	}
 
-	req, err := http.NewRequest(method, apiUrl, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, apiUrl, bodyReader)
 	if err != nil {
 		return nil, err
 	}
@@ -78,12 +181,12 @@ func doRequest(method, url string, bodyBytes []byte, contentType string, accessT
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 	}
 
-	req.Header.Set("User-Agent", TpixClientUserAgent)
-	if contentType != "" {
-		req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", version.UserAgent())
+	for name, values := range header {
+		req.Header[name] = values
 	}
 
-	return http.DefaultClient.Do(req)
+	return httpClient.Do(req)
 }
 
 // refreshAccessToken uses the stored refresh token to obtain a new access token.
@@ -96,7 +199,8 @@ func refreshAccessToken(cfg config.Config) error {
 		"refresh_token": cfg.RefreshToken,
 	})
 
-	resp, err := doRequest("POST", "/auth/token/refresh", reqBody, "application/json", "")
+	header := http.Header{"Content-Type": {"application/json"}}
+	resp, err := doRequest(context.Background(), "POST", "/auth/token/refresh", reqBody, header, "")
 	if err != nil {
 		return err
 	}
@@ -105,7 +209,7 @@ func refreshAccessToken(cfg config.Config) error {
 	if resp.StatusCode != http.StatusOK {
 		// Refresh failed — clear refresh token so we don't keep retrying
 		cfg.RefreshToken = ""
-		config.Save(cfg)
+		saveConfig(cfg)
 		return fmt.Errorf("token refresh failed with status %d", resp.StatusCode)
 	}
 
@@ -115,8 +219,9 @@ func refreshAccessToken(cfg config.Config) error {
 	}
 
 	cfg.AccessToken = tokenResp.AccessToken
+	cfg.TokenExpiry = tokenResp.Expiry()
 	if tokenResp.RefreshToken != "" {
 		cfg.RefreshToken = tokenResp.RefreshToken
 	}
-	return config.Save(cfg)
+	return saveConfig(cfg)
 }
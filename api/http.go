@@ -2,37 +2,51 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/typstify/tpix-cli/config"
 	"github.com/typstify/tpix-cli/utils"
+	"github.com/typstify/tpix-cli/version"
 )
 
 // SearchPackages fetches packages matching a query from the TPIX server.
-func SearchPackages(query, namespace string, limit int) (*SearchResponse, error) {
-	url := fmt.Sprintf("/api/v1/search?q=%s", query)
+// If typst is not empty, the server is asked to only return packages with a
+// version that compiles with that Typst version; servers that do not
+// support it ignore the parameter.
+func SearchPackages(query, namespace, typst string, limit int) (*SearchResponse, error) {
+	params := url.Values{"q": {query}}
 	if namespace != "" {
-		url += "&namespace=" + namespace
+		params.Set("namespace", namespace)
+	}
+	if typst != "" {
+		params.Set("typst", typst)
 	}
 	if limit > 0 {
-		url += fmt.Sprintf("&limit=%d", limit)
+		params.Set("limit", strconv.Itoa(limit))
 	}
 
-	resp, err := makeRequest("GET", url, nil, "")
+	resp, err := makeRequest("GET", "/api/v1/search?"+params.Encode(), nil, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to search packages: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("search failed: %s", string(body))
+		return nil, statusError(resp, "search failed")
 	}
 
 	var result SearchResponse
@@ -43,57 +57,351 @@ func SearchPackages(query, namespace string, limit int) (*SearchResponse, error)
 	return &result, nil
 }
 
-// DownloadPackage downloads a package, extracts it to the cache directory,
-// and optionally saves the archive to output path.
-func DownloadPackage(namespace, name, version string) error {
+// maxChecksumRetries is how many times a package is downloaded again after
+// its archive failed checksum verification. Only checksum mismatches are
+// retried here; any other failure is returned to the caller immediately.
+const maxChecksumRetries = 2
+
+// ErrChecksumMismatch is returned when a downloaded archive does not match the
+// SHA256 published by the server.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrPackageNotFound matches the NotFoundError returned when the server has
+// no package of the requested name.
+var ErrPackageNotFound = errors.New("package not found")
+
+// ProgressFunc reports download progress. received is the number of bytes
+// read so far and total is the size of the download, or -1 if unknown.
+type ProgressFunc func(received, total int64)
+
+// progressWriter counts the bytes written to it and reports them to onProgress.
+type progressWriter struct {
+	received   int64
+	total      int64
+	onProgress ProgressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.received += int64(len(p))
+	if w.onProgress != nil {
+		w.onProgress(w.received, w.total)
+	}
+	return len(p), nil
+}
+
+// DownloadPackage downloads a package, verifies it against the checksum
+// published by the server and extracts it to the cache directory.
+// A download failing verification is retried up to maxChecksumRetries times,
+// as a corrupted transfer is usually transient. onProgress may be nil.
+// Cancelling ctx aborts the download without leaving partial files behind.
+func DownloadPackage(ctx context.Context, namespace, name, version string, onProgress ProgressFunc) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	cacheDir := cfg.TypstCachePkgPath
+	if cacheDir == "" {
+		return fmt.Errorf("typst cache directory not configured")
+	}
+
+	return downloadTo(ctx, namespace, name, version, filepath.Join(cacheDir, namespace, name, version), onProgress)
+}
+
+// downloadTo downloads a package, verifies it and extracts it to extractDir,
+// retrying on checksum mismatches as described for DownloadPackage.
+func downloadTo(ctx context.Context, namespace, name, version, extractDir string, onProgress ProgressFunc) error {
+	expected, err := expectedChecksum(namespace, name, version)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= maxChecksumRetries; attempt++ {
+		err = downloadAndExtract(ctx, namespace, name, version, expected, extractDir, onProgress)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// downloadAndExtract performs a single download of the package archive and
+// extracts it into extractDir. If expected is not empty, the archive is
+// verified against it before extraction.
+func downloadAndExtract(ctx context.Context, namespace, name, version, expected, extractDir string, onProgress ProgressFunc) error {
+	tmpPath, err := downloadArchive(ctx, namespace, name, version, expected, onProgress)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := utils.ExtractTarGz(tmpPath, extractDir); err != nil {
+		return fmt.Errorf("failed to extract package: %w", err)
+	}
+
+	return nil
+}
+
+// downloadArchive performs a single download of the package archive into a
+// temporary file, which the caller has to remove. If expected is not empty,
+// the archive is verified against it.
+func downloadArchive(ctx context.Context, namespace, name, version, expected string, onProgress ProgressFunc) (string, error) {
 	url := fmt.Sprintf("/api/v1/download/%s/%s/%s", namespace, name, version)
 
-	resp, err := makeRequest("GET", url, nil, "")
+	resp, err := makeRequestContext(ctx, "GET", url, nil, "")
 	if err != nil {
-		return fmt.Errorf("failed to download package: %w", err)
+		return "", fmt.Errorf("failed to download package: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", &NotFoundError{Namespace: namespace, Name: name, Version: version}
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("download failed: %s", string(body))
+		return "", statusError(resp, "download failed")
 	}
 
 	// Create temp file for the archive
 	tmpFile, err := os.CreateTemp("", "tpix-*.tar.gz")
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
 	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
 
-	_, err = io.Copy(tmpFile, resp.Body)
+	hasher := sha256.New()
+	progress := &progressWriter{total: resp.ContentLength, onProgress: onProgress}
+	_, err = io.Copy(io.MultiWriter(tmpFile, hasher, progress), resp.Body)
 	tmpFile.Close()
 	if err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	if expected != "" {
+		actual := hex.EncodeToString(hasher.Sum(nil))
+		if !strings.EqualFold(actual, expected) {
+			os.Remove(tmpPath)
+			return "", fmt.Errorf("@%s/%s:%s: %w (expected %s, got %s)", namespace, name, version, ErrChecksumMismatch, expected, actual)
+		}
+	}
+
+	return tmpPath, nil
+}
+
+// DownloadArchive downloads the archive of a package, verifies it like
+// DownloadPackage and saves it as dest without extracting it. dest is only
+// written once the archive has been verified.
+func DownloadArchive(ctx context.Context, namespace, name, version, dest string, onProgress ProgressFunc) error {
+	expected, err := expectedChecksum(namespace, name, version)
+	if err != nil {
+		return err
 	}
 
-	// Extract to cache directory
-	cfg, err := config.Load()
+	var tmpPath string
+	for attempt := 0; attempt <= maxChecksumRetries; attempt++ {
+		tmpPath, err = downloadArchive(ctx, namespace, name, version, expected, onProgress)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			break
+		}
+	}
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmpPath)
 
-	cacheDir := cfg.TypstCachePkgPath
-	if cacheDir == "" {
-		return fmt.Errorf("typst cache directory not configured")
+	if err := copyFile(tmpPath, dest); err != nil {
+		return fmt.Errorf("failed to save archive: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst through a temporary file next to dst, so that
+// dst is never left partially written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	extractDir := filepath.Join(cacheDir, namespace, name, version)
-	if err := utils.ExtractTarGz(tmpPath, extractDir); err != nil {
-		return fmt.Errorf("failed to extract package: %w", err)
+	out, err := os.CreateTemp(filepath.Dir(dst), ".tpix-*.tar.gz")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(out.Name())
 
-	return nil
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// VerifyStatus is the result of verifying a cached package.
+type VerifyStatus int
+
+const (
+	// VerifyOK means the cached package matches the published archive.
+	VerifyOK VerifyStatus = iota
+	// VerifyMismatch means the cached files differ from the published archive.
+	VerifyMismatch
+	// VerifyMissingOnServer means the version is not published on the server.
+	VerifyMissingOnServer
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyOK:
+		return "OK"
+	case VerifyMismatch:
+		return "MISMATCH"
+	default:
+		return "MISSING-ON-SERVER"
+	}
+}
+
+// VerifyPackage checks the package extracted in dir against the archive
+// published on the server. The server's SHA256 covers the archive rather
+// than the extracted files, so the archive is downloaded and verified
+// against it, and its contents are compared with dir.
+func VerifyPackage(namespace, name, version, dir string) (VerifyStatus, error) {
+	versions, err := fetchPackageVersions(namespace, name)
+	if err != nil {
+		return 0, err
+	}
+	if !containsVersion(versions, version) {
+		return VerifyMissingOnServer, nil
+	}
+
+	cachedHash, err := utils.HashDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cached package: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tpix-verify-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	publishedDir := filepath.Join(tmpDir, version)
+	if err := downloadTo(context.Background(), namespace, name, version, publishedDir, nil); err != nil {
+		return 0, err
+	}
+
+	publishedHash, err := utils.HashDir(publishedDir)
+	if err != nil {
+		return 0, err
+	}
+
+	if cachedHash != publishedHash {
+		return VerifyMismatch, nil
+	}
+	return VerifyOK, nil
+}
+
+// VersionPublished reports whether a version of a package is published on
+// the server. A package that does not exist yet has no published versions.
+func VersionPublished(namespace, name, version string) (bool, error) {
+	versions, err := fetchPackageVersions(namespace, name)
+	if errors.Is(err, ErrPackageNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return containsVersion(versions, version), nil
+}
+
+// WaitForVersion polls the server every interval until version of a package
+// is published, for servers that process uploads asynchronously. It gives
+// up after timeout. onPoll, if not nil, is called before every attempt
+// after the first.
+func WaitForVersion(namespace, name, version string, timeout, interval time.Duration, onPoll func(attempt int)) error {
+	if interval <= 0 {
+		return fmt.Errorf("poll interval must be positive")
+	}
+
+	attempts := max(int(timeout/interval), 0) + 1
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		forgetPackage(namespace, name)
+		published, err := VersionPublished(namespace, name, version)
+		if err == nil && published {
+			return nil
+		}
+		lastErr = err
+
+		if attempt == attempts {
+			break
+		}
+		sleep(context.Background(), interval)
+		if onPoll != nil {
+			onPoll(attempt + 1)
+		}
+	}
+
+	if lastErr != nil {
+		return fmt.Errorf("@%s/%s:%s was not published within %s: %w", namespace, name, version, timeout, lastErr)
+	}
+	return fmt.Errorf("@%s/%s:%s was not published within %s", namespace, name, version, timeout)
+}
+
+func containsVersion(versions []PackageVersionInfo, version string) bool {
+	for _, v := range versions {
+		if v.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedChecksum looks up the SHA256 the server published for a package
+// version. It returns an empty string when the server does not know the
+// version or published no checksum for it, in which case the download is not
+// verified. Any other error is returned.
+func expectedChecksum(namespace, name, version string) (string, error) {
+	checksum, err := PackageChecksum(namespace, name, version)
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get checksum: %w", err)
+	}
+	return checksum, nil
+}
+
+// PackageChecksum returns the SHA256 of a package version's archive as
+// published by the server.
+func PackageChecksum(namespace, name, version string) (string, error) {
+	versions, err := fetchPackageVersions(namespace, name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range versions {
+		if v.Version == version {
+			return v.SHA256, nil
+		}
+	}
+
+	return "", &NotFoundError{Namespace: namespace, Name: name, Version: version}
 }
 
 // FetchPackage fetches package details from the TPIX server.
 func FetchPackage(namespace, name string) (*PackageResponse, error) {
+	if pkg, ok := cachedPackage(namespace, name); ok {
+		return pkg, nil
+	}
+
 	url := fmt.Sprintf("/api/v1/packages/%s/%s", namespace, name)
 	resp, err := makeRequest("GET", url, nil, "")
 	if err != nil {
@@ -101,9 +409,11 @@ func FetchPackage(namespace, name string) (*PackageResponse, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &NotFoundError{Namespace: namespace, Name: name}
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get package: %s", string(body))
+		return nil, statusError(resp, "failed to get package")
 	}
 
 	var pkg PackageResponse
@@ -117,11 +427,16 @@ func FetchPackage(namespace, name string) (*PackageResponse, error) {
 		pkg.Versions = versions
 	}
 
+	storePackage(namespace, name, &pkg)
 	return &pkg, nil
 }
 
 // FetchPackageVersions fetches all versions for a package.
 func fetchPackageVersions(namespace, name string) ([]PackageVersionInfo, error) {
+	if versions, ok := cachedVersions(namespace, name); ok {
+		return versions, nil
+	}
+
 	url := fmt.Sprintf("/api/v1/packages/%s/%s/versions", namespace, name)
 	resp, err := makeRequest("GET", url, nil, "")
 	if err != nil {
@@ -129,9 +444,11 @@ func fetchPackageVersions(namespace, name string) ([]PackageVersionInfo, error)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &NotFoundError{Namespace: namespace, Name: name}
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get versions: %s", string(body))
+		return nil, statusError(resp, "failed to get versions")
 	}
 
 	var versionsResp PackageVersionsResponse
@@ -139,10 +456,42 @@ func fetchPackageVersions(namespace, name string) ([]PackageVersionInfo, error)
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	storeVersions(namespace, name, versionsResp.Versions)
 	return versionsResp.Versions, nil
 }
 
+// MyPackages fetches the packages published by the logged in user. If
+// namespace is not empty, only the packages in that namespace are returned.
+func MyPackages(namespace string) ([]PackageResponse, error) {
+	path := "/api/v1/me/packages"
+	if namespace != "" {
+		path += "?" + url.Values{"namespace": {namespace}}.Encode()
+	}
+
+	resp, err := makeRequest("GET", path, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch packages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrInvalidToken
+	default:
+		return nil, statusError(resp, "failed to get packages")
+	}
+
+	var result UserPackagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Packages, nil
+}
+
 // FetchDependencies fetches the dependencies for a specific package version.
+// Older packages have no dependency data on the server, which responds with
+// 404 for them; they are treated as having no dependencies.
 func FetchDependencies(namespace, name, version string) ([]DependencyInfo, error) {
 	url := fmt.Sprintf("/api/v1/packages/%s/%s/%s/dependencies", namespace, name, version)
 	resp, err := makeRequest("GET", url, nil, "")
@@ -151,9 +500,11 @@ func FetchDependencies(namespace, name, version string) ([]DependencyInfo, error
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get dependencies: %s", string(body))
+		return nil, statusError(resp, "failed to get dependencies")
 	}
 
 	var depsResp DependenciesResponse
@@ -164,8 +515,67 @@ func FetchDependencies(namespace, name, version string) ([]DependencyInfo, error
 	return depsResp.Dependencies, nil
 }
 
-// UploadPackage uploads a package to the TPIX server.
-func UploadPackage(packagePath, namespace string) (*UploadResponse, error) {
+// maxRateLimitRetries is how many times an upload rejected with HTTP 429 is
+// sent again.
+const maxRateLimitRetries = 3
+
+// maxRetryAfter caps how long an upload waits for a rate limit to pass.
+const maxRetryAfter = 5 * time.Minute
+
+// sleep waits for d, or until ctx is cancelled, in which case it returns
+// the error of ctx. It is replaced in tests to avoid waiting for rate
+// limits.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RetryFunc is called before a request is sent again after waiting for wait.
+type RetryFunc func(wait time.Duration)
+
+// retryAfter returns how long to wait before retrying a rate limited request,
+// based on a Retry-After header in seconds or as an HTTP date. Without a
+// usable header it backs off exponentially from one second.
+func retryAfter(header string, attempt int) time.Duration {
+	wait, ok := parseRetryAfter(header)
+	if !ok {
+		wait = time.Duration(1<<attempt) * time.Second
+	}
+	return min(wait, maxRetryAfter)
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// UploadOptions configures UploadPackage.
+type UploadOptions struct {
+	// Compress sends the request body with Content-Encoding: gzip. If the
+	// server rejects compressed requests, the upload is sent uncompressed.
+	Compress bool
+	// OnRetry is called before an upload rejected with HTTP 429 is sent
+	// again. It may be nil.
+	OnRetry RetryFunc
+}
+
+// UploadPackage uploads a package to the TPIX server. If the server
+// responds with HTTP 429, the upload is retried after the time given in the
+// Retry-After header. Cancelling ctx aborts the upload, also while waiting.
+func UploadPackage(ctx context.Context, packagePath, namespace string, opts UploadOptions) (*UploadResponse, error) {
 	file, err := os.Open(packagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open package file: %w", err)
@@ -198,11 +608,33 @@ func UploadPackage(packagePath, namespace string) (*UploadResponse, error) {
 
 	writer.Close()
 
-	// Create request
-	url := "/api/v1/packages/upload"
-	resp, err := makeRequest("POST", url, &buf, writer.FormDataContentType())
-	if err != nil {
-		return nil, fmt.Errorf("failed to upload package: %w", err)
+	header := http.Header{"Content-Type": {writer.FormDataContentType()}}
+
+	var resp *http.Response
+	if opts.Compress {
+		compressed, err := gzipBytes(buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress upload: %w", err)
+		}
+
+		gzipHeader := header.Clone()
+		gzipHeader.Set("Content-Encoding", "gzip")
+		resp, err = sendUpload(ctx, compressed, gzipHeader, opts.OnRetry)
+		if err != nil {
+			return nil, err
+		}
+
+		// The server does not support compressed requests
+		if resp.StatusCode == http.StatusUnsupportedMediaType {
+			resp.Body.Close()
+			resp = nil
+		}
+	}
+	if resp == nil {
+		resp, err = sendUpload(ctx, buf.Bytes(), header, opts.OnRetry)
+		if err != nil {
+			return nil, err
+		}
 	}
 	defer resp.Body.Close()
 
@@ -211,14 +643,90 @@ func UploadPackage(packagePath, namespace string) (*UploadResponse, error) {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	var uploadResp UploadResponse
+	decodeErr := json.Unmarshal(body, &uploadResp)
+	uploadResp.Status = resp.StatusCode
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		// A rejected package comes with a validation report
+		if decodeErr == nil && len(uploadResp.ValidateReport) > 0 {
+			uploadResp.SHA256 = ""
+			return &uploadResp, nil
+		}
+		if err := knownStatusError(resp); err != nil {
+			return nil, fmt.Errorf("upload failed: %w", err)
+		}
 		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var uploadResp UploadResponse
-	if err := json.Unmarshal(body, &uploadResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", decodeErr)
 	}
 
 	return &uploadResp, nil
 }
+
+// sendUpload posts an upload request body. Uploads are not retried in
+// general, but a 429 means the server did not accept the upload, so it is
+// safe to send it again.
+func sendUpload(ctx context.Context, body []byte, header http.Header, onRetry RetryFunc) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := makeRequestWithHeader(ctx, "POST", "/api/v1/packages/upload", bytes.NewReader(body), header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload package: %w", err)
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		wait := retryAfter(resp.Header.Get("Retry-After"), attempt)
+		if onRetry != nil {
+			onRetry(wait)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, fmt.Errorf("failed to upload package: %w", err)
+		}
+	}
+}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if _, err := gzw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apiVersionHeader is the response header in which the server advertises
+// its API version.
+const apiVersionHeader = "X-TPIX-API-Version"
+
+// CheckCompatibility asks the server for its API version and returns an
+// error if it is not compatible with this client. Servers that do not
+// advertise a version are assumed to be compatible.
+func CheckCompatibility() error {
+	resp, err := makeRequest("GET", "/api/v1/health", nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to check server version: %w", err)
+	}
+	defer resp.Body.Close()
+
+	serverVersion := resp.Header.Get(apiVersionHeader)
+	if serverVersion == "" {
+		var health HealthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&health); err == nil {
+			serverVersion = health.APIVersion
+		}
+	}
+
+	if serverVersion == "" {
+		return nil
+	}
+	return version.CheckAPIVersion(serverVersion)
+}
@@ -0,0 +1,857 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/typstify/tpix-cli/config"
+)
+
+// buildArchive returns a tar.gz archive containing the given files.
+func buildArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	tw.Close()
+	gzw.Close()
+
+	return buf.Bytes()
+}
+
+// setupServer points the api package at handler and at a temporary cache
+// directory, returning the cache directory.
+func setupServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cacheDir := t.TempDir()
+	origServerURL, origLoad, origSave := serverURL, loadConfig, saveConfig
+	serverURL = srv.URL
+	loadConfig = func() (config.Config, error) {
+		return config.Config{TypstCachePkgPath: cacheDir}, nil
+	}
+	saveConfig = func(config.Config) error { return nil }
+	t.Cleanup(func() {
+		serverURL, loadConfig, saveConfig = origServerURL, origLoad, origSave
+	})
+
+	resetPackageCache()
+	t.Cleanup(resetPackageCache)
+
+	return cacheDir
+}
+
+func TestDownloadPackageRetriesOnChecksumMismatch(t *testing.T) {
+	archive := buildArchive(t, map[string]string{"lib.typ": "#let x = 1"})
+	sum := sha256.Sum256(archive)
+
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{
+			Versions: []PackageVersionInfo{{Version: "1.0.0", SHA256: hex.EncodeToString(sum[:])}},
+		})
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		if downloads == 1 {
+			// Simulate a truncated transfer.
+			w.Write(archive[:len(archive)/2])
+			return
+		}
+		w.Write(archive)
+	})
+	cacheDir := setupServer(t, mux)
+
+	if err := DownloadPackage(context.Background(), "preview", "demo", "1.0.0", nil); err != nil {
+		t.Fatalf("DownloadPackage() error = %v", err)
+	}
+
+	if downloads != 2 {
+		t.Errorf("downloads = %d, want 2", downloads)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, "preview", "demo", "1.0.0", "lib.typ")); err != nil {
+		t.Errorf("extracted file missing: %v", err)
+	}
+}
+
+func TestDownloadPackageGivesUpOnPersistentMismatch(t *testing.T) {
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{
+			Versions: []PackageVersionInfo{{Version: "1.0.0", SHA256: "deadbeef"}},
+		})
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(buildArchive(t, map[string]string{"lib.typ": ""}))
+	})
+	setupServer(t, mux)
+
+	err := DownloadPackage(context.Background(), "preview", "demo", "1.0.0", nil)
+	if err == nil {
+		t.Fatal("DownloadPackage() expected checksum error")
+	}
+
+	if downloads != maxChecksumRetries+1 {
+		t.Errorf("downloads = %d, want %d", downloads, maxChecksumRetries+1)
+	}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	archive := buildArchive(t, map[string]string{"lib.typ": "#let x = 1"})
+	sum := sha256.Sum256(archive)
+
+	corrupt := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{
+			Versions: []PackageVersionInfo{{Version: "1.0.0", SHA256: hex.EncodeToString(sum[:])}},
+		})
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		if corrupt {
+			w.Write(archive[:len(archive)/2])
+			return
+		}
+		w.Write(archive)
+	})
+	cacheDir := setupServer(t, mux)
+	dest := filepath.Join(t.TempDir(), "demo-1.0.0.tar.gz")
+
+	if err := DownloadArchive(context.Background(), "preview", "demo", "1.0.0", dest, nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("DownloadArchive() error = %v, want checksum mismatch", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("unverified archive was saved: %v", err)
+	}
+
+	corrupt = false
+	if err := DownloadArchive(context.Background(), "preview", "demo", "1.0.0", dest, nil); err != nil {
+		t.Fatalf("DownloadArchive() error = %v", err)
+	}
+	saved, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !bytes.Equal(saved, archive) {
+		t.Error("saved archive differs from the published one")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "preview", "demo")); !os.IsNotExist(err) {
+		t.Errorf("archive was extracted into the cache: %v", err)
+	}
+}
+
+func TestDownloadPackageDoesNotRetryNotFound(t *testing.T) {
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		http.NotFound(w, r)
+	})
+	setupServer(t, mux)
+
+	if err := DownloadPackage(context.Background(), "preview", "demo", "1.0.0", nil); err == nil {
+		t.Fatal("DownloadPackage() expected error for missing package")
+	}
+
+	if downloads != 1 {
+		t.Errorf("downloads = %d, want 1", downloads)
+	}
+}
+
+func TestDownloadPackageChecksumLookupFails(t *testing.T) {
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database unavailable", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(buildArchive(t, map[string]string{"lib.typ": ""}))
+	})
+	setupServer(t, mux)
+
+	// The archive must not be installed unverified
+	if err := DownloadPackage(context.Background(), "preview", "demo", "1.0.0", nil); err == nil {
+		t.Fatal("DownloadPackage() expected error when the checksum lookup fails")
+	}
+	if downloads != 0 {
+		t.Errorf("downloads = %d, want 0", downloads)
+	}
+}
+
+func TestFetchPackageMemoized(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(PackageResponse{Namespace: "preview", Name: "demo"})
+	})
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(PackageVersionsResponse{
+			Versions: []PackageVersionInfo{{Version: "1.0.0", SHA256: "abc"}},
+		})
+	})
+	setupServer(t, mux)
+
+	for i := 0; i < 3; i++ {
+		pkg, err := FetchPackage("preview", "demo")
+		if err != nil {
+			t.Fatalf("FetchPackage() error = %v", err)
+		}
+		if len(pkg.Versions) != 1 || pkg.Versions[0].SHA256 != "abc" {
+			t.Fatalf("FetchPackage() versions = %v, want 1 version", pkg.Versions)
+		}
+		// Modifying the response must not change the memoized one
+		pkg.Versions[0].SHA256 = "modified"
+	}
+	if _, err := PackageChecksum("preview", "demo", "1.0.0"); err != nil {
+		t.Fatalf("PackageChecksum() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("server received %d requests, want 2", requests)
+	}
+
+	Refresh = true
+	t.Cleanup(func() { Refresh = false })
+
+	if _, err := FetchPackage("preview", "demo"); err != nil {
+		t.Fatalf("FetchPackage() error = %v", err)
+	}
+	if requests != 4 {
+		t.Errorf("server received %d requests with Refresh, want 4", requests)
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		body    string
+		wantErr bool
+	}{
+		{"same version", "1.0.0", "", false},
+		{"newer minor", "1.3.0", "", false},
+		{"newer major", "2.0.0", "", true},
+		{"from body", "", `{"status":"ok","api_version":"2.1.0"}`, true},
+		{"not advertised", "", `{"status":"ok"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v1/health", func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set(apiVersionHeader, tt.header)
+				}
+				w.Write([]byte(tt.body))
+			})
+			setupServer(t, mux)
+
+			err := CheckCompatibility()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCompatibility() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyPackage(t *testing.T) {
+	archive := buildArchive(t, map[string]string{"lib.typ": "#let x = 1"})
+	sum := sha256.Sum256(archive)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{
+			Versions: []PackageVersionInfo{{Version: "1.0.0", SHA256: hex.EncodeToString(sum[:])}},
+		})
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	setupServer(t, mux)
+
+	tests := []struct {
+		name    string
+		version string
+		content string
+		want    VerifyStatus
+	}{
+		{"intact", "1.0.0", "#let x = 1", VerifyOK},
+		{"modified", "1.0.0", "#let x = 2", VerifyMismatch},
+		{"unpublished", "0.9.0", "#let x = 1", VerifyMissingOnServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "lib.typ"), []byte(tt.content), 0644)
+
+			got, err := VerifyPackage("preview", "demo", tt.version, dir)
+			if err != nil {
+				t.Fatalf("VerifyPackage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionPublished(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{
+			Versions: []PackageVersionInfo{{Version: "1.0.0"}},
+		})
+	})
+	mux.HandleFunc("/api/v1/packages/preview/new/versions", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("/api/v1/packages/preview/broken/versions", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	setupServer(t, mux)
+
+	tests := []struct {
+		name    string
+		version string
+		want    bool
+		wantErr bool
+	}{
+		{"demo", "1.0.0", true, false},
+		{"demo", "1.1.0", false, false},
+		{"new", "0.1.0", false, false},
+		{"broken", "0.1.0", false, true},
+	}
+
+	for _, tt := range tests {
+		got, err := VersionPublished("preview", tt.name, tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("VersionPublished(%s, %s) error = %v, wantErr %v", tt.name, tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("VersionPublished(%s, %s) = %v, want %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestUploadPackageRetriesOnRateLimit(t *testing.T) {
+	uploads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/upload", func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		if err := r.ParseMultipartForm(1 << 20); err != nil || r.FormValue("namespace") != "preview" {
+			t.Errorf("upload %d: bad form: %v", uploads, err)
+		}
+		if uploads == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(UploadResponse{Package: "demo", Version: "1.0.0", SHA256: "abc"})
+	})
+	setupServer(t, mux)
+
+	var slept []time.Duration
+	origSleep := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	path := filepath.Join(t.TempDir(), "demo.tar.gz")
+	os.WriteFile(path, buildArchive(t, map[string]string{"lib.typ": ""}), 0644)
+
+	var reported []time.Duration
+	resp, err := UploadPackage(context.Background(), path, "preview", UploadOptions{
+		OnRetry: func(wait time.Duration) {
+			reported = append(reported, wait)
+		},
+	})
+	if err != nil {
+		t.Fatalf("UploadPackage() error = %v", err)
+	}
+	if resp.Package != "demo" {
+		t.Errorf("UploadPackage() package = %q, want demo", resp.Package)
+	}
+
+	if uploads != 2 {
+		t.Errorf("uploads = %d, want 2", uploads)
+	}
+	want := []time.Duration{7 * time.Second}
+	if !slices.Equal(slept, want) || !slices.Equal(reported, want) {
+		t.Errorf("waited %v and reported %v, want %v", slept, reported, want)
+	}
+}
+
+func TestMakeRequestRefreshesExpiringToken(t *testing.T) {
+	refreshes := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/token/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: "new-token", ExpiresIn: 3600, RefreshToken: "new-refresh"})
+	})
+	mux.HandleFunc("/api/v1/packages/preview/demo", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer new-token" {
+			t.Errorf("Authorization = %q, want the refreshed token", got)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(PackageResponse{Namespace: "preview", Name: "demo"})
+	})
+	setupServer(t, mux)
+
+	cfg := config.Config{
+		AccessToken:  "old-token",
+		RefreshToken: "refresh",
+		TokenExpiry:  time.Now().Add(30 * time.Second),
+	}
+	loadConfig = func() (config.Config, error) { return cfg, nil }
+	saveConfig = func(c config.Config) error {
+		cfg = c
+		return nil
+	}
+
+	if _, err := FetchPackage("preview", "demo"); err != nil {
+		t.Fatalf("FetchPackage() error = %v", err)
+	}
+
+	if refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", refreshes)
+	}
+	if time.Until(cfg.TokenExpiry) < time.Hour-time.Minute {
+		t.Errorf("saved token expiry = %v, want about an hour from now", cfg.TokenExpiry)
+	}
+}
+
+func TestUploadPackageCompressed(t *testing.T) {
+	archive := buildArchive(t, map[string]string{"lib.typ": "#let x = 1"})
+	path := filepath.Join(t.TempDir(), "demo.tar.gz")
+	os.WriteFile(path, archive, 0644)
+
+	tests := []struct {
+		name          string
+		supportsGzip  bool
+		wantEncodings []string
+	}{
+		{"supported", true, []string{"gzip"}},
+		{"fallback", false, []string{"gzip", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var encodings []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v1/packages/upload", func(w http.ResponseWriter, r *http.Request) {
+				encoding := r.Header.Get("Content-Encoding")
+				encodings = append(encodings, encoding)
+				if encoding == "gzip" {
+					if !tt.supportsGzip {
+						w.WriteHeader(http.StatusUnsupportedMediaType)
+						return
+					}
+					gzr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Errorf("gzip.NewReader() error = %v", err)
+						return
+					}
+					r.Body = io.NopCloser(gzr)
+				}
+
+				file, _, err := r.FormFile("file")
+				if err != nil {
+					t.Errorf("FormFile() error = %v", err)
+					return
+				}
+				received, _ := io.ReadAll(file)
+				if !bytes.Equal(received, archive) {
+					t.Error("server received a different archive")
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(UploadResponse{Package: "demo", Version: "1.0.0", SHA256: "abc"})
+			})
+			setupServer(t, mux)
+
+			if _, err := UploadPackage(context.Background(), path, "preview", UploadOptions{Compress: true}); err != nil {
+				t.Fatalf("UploadPackage() error = %v", err)
+			}
+			if !slices.Equal(encodings, tt.wantEncodings) {
+				t.Errorf("Content-Encoding of requests = %q, want %q", encodings, tt.wantEncodings)
+			}
+		})
+	}
+}
+
+func TestUploadPackageRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.tar.gz")
+	os.WriteFile(path, buildArchive(t, map[string]string{"lib.typ": ""}), 0644)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/upload", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(UploadResponse{ValidateReport: []string{"package.version: invalid"}})
+	})
+	setupServer(t, mux)
+
+	resp, err := UploadPackage(context.Background(), path, "preview", UploadOptions{})
+	if err != nil {
+		t.Fatalf("UploadPackage() error = %v", err)
+	}
+	if resp.Status != http.StatusUnprocessableEntity || resp.SHA256 != "" {
+		t.Errorf("UploadPackage() status = %d, sha256 = %q", resp.Status, resp.SHA256)
+	}
+	if !slices.Equal(resp.ValidateReport, []string{"package.version: invalid"}) {
+		t.Errorf("UploadPackage() report = %v", resp.ValidateReport)
+	}
+}
+
+func TestWaitForVersion(t *testing.T) {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		versions := []PackageVersionInfo{{Version: "1.0.0"}}
+		if polls >= 3 {
+			versions = append(versions, PackageVersionInfo{Version: "1.1.0"})
+		}
+		json.NewEncoder(w).Encode(PackageVersionsResponse{Versions: versions})
+	})
+	setupServer(t, mux)
+
+	var slept []time.Duration
+	origSleep := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	var attempts []int
+	err := WaitForVersion("preview", "demo", "1.1.0", time.Minute, 10*time.Second, func(attempt int) {
+		attempts = append(attempts, attempt)
+	})
+	if err != nil {
+		t.Fatalf("WaitForVersion() error = %v", err)
+	}
+	if polls != 3 || !slices.Equal(attempts, []int{2, 3}) {
+		t.Errorf("polls = %d, attempts = %v, want 3 polls", polls, attempts)
+	}
+	if !slices.Equal(slept, []time.Duration{10 * time.Second, 10 * time.Second}) {
+		t.Errorf("slept = %v", slept)
+	}
+
+	// 30s at a 10s interval allows 4 polls in total
+	polls = 0
+	if err := WaitForVersion("preview", "demo", "2.0.0", 30*time.Second, 10*time.Second, nil); err == nil {
+		t.Fatal("WaitForVersion() expected timeout error")
+	}
+	if polls != 4 {
+		t.Errorf("polls = %d, want 4 before giving up", polls)
+	}
+}
+
+func TestDownloadPackageCancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageVersionsResponse{Versions: []PackageVersionInfo{{Version: "1.0.0"}}})
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000000")
+		w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		// Stall until the client gives up
+		<-r.Context().Done()
+	})
+	cacheDir := setupServer(t, mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := DownloadPackage(ctx, "preview", "demo", "1.0.0", func(received, total int64) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DownloadPackage() error = %v, want context.Canceled", err)
+	}
+
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "preview", "demo", "1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("package directory exists after cancellation: %v", err)
+	}
+}
+
+func TestFetchDependencies(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/app/1.0.0/dependencies", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(DependenciesResponse{
+			Dependencies: []DependencyInfo{{Namespace: "preview", Name: "util", Version: "0.2.0"}},
+		})
+	})
+	mux.HandleFunc("/api/v1/packages/preview/broken/1.0.0/dependencies", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	setupServer(t, mux)
+
+	got, err := FetchDependencies("preview", "app", "1.0.0")
+	if err != nil {
+		t.Fatalf("FetchDependencies() error = %v", err)
+	}
+	want := []DependencyInfo{{Namespace: "preview", Name: "util", Version: "0.2.0"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("FetchDependencies() = %v, want %v", got, want)
+	}
+
+	// Older packages have no dependency data
+	got, err = FetchDependencies("preview", "old", "0.1.0")
+	if err != nil || len(got) != 0 {
+		t.Errorf("FetchDependencies() for a package without data = %v, %v, want none", got, err)
+	}
+
+	if _, err := FetchDependencies("preview", "broken", "1.0.0"); err == nil {
+		t.Error("FetchDependencies() expected error for a server error")
+	}
+}
+
+func TestSearchPackagesQuery(t *testing.T) {
+	var got url.Values
+	setupServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		json.NewEncoder(w).Encode(SearchResponse{})
+	}))
+
+	if _, err := SearchPackages("charts & plots", "my ns", "0.12.0+dev", 5); err != nil {
+		t.Fatalf("SearchPackages() error = %v", err)
+	}
+	want := url.Values{"q": {"charts & plots"}, "namespace": {"my ns"}, "typst": {"0.12.0+dev"}, "limit": {"5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query = %v, want %v", got, want)
+	}
+}
+
+func TestMyPackages(t *testing.T) {
+	var gotNamespace string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/me/packages", func(w http.ResponseWriter, r *http.Request) {
+		gotNamespace = r.URL.Query().Get("namespace")
+		json.NewEncoder(w).Encode(UserPackagesResponse{
+			Packages: []PackageResponse{{Namespace: "preview", Name: "demo"}},
+		})
+	})
+	setupServer(t, mux)
+
+	pkgs, err := MyPackages("preview")
+	if err != nil {
+		t.Fatalf("MyPackages() error = %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "demo" {
+		t.Errorf("MyPackages() = %+v, want the demo package", pkgs)
+	}
+	if gotNamespace != "preview" {
+		t.Errorf("namespace query = %q, want %q", gotNamespace, "preview")
+	}
+
+	// The namespace is escaped in the query
+	if _, err := MyPackages("a&b=c d"); err != nil {
+		t.Fatalf("MyPackages() error = %v", err)
+	}
+	if gotNamespace != "a&b=c d" {
+		t.Errorf("namespace query = %q, want %q", gotNamespace, "a&b=c d")
+	}
+}
+
+func TestMyPackagesUnauthorized(t *testing.T) {
+	setupServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	if _, err := MyPackages(""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("MyPackages() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>not found</html>", http.StatusNotFound)
+	})
+	mux.HandleFunc("/api/v1/packages/preview/private", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>forbidden</html>", http.StatusForbidden)
+	})
+	mux.HandleFunc("/api/v1/packages/preview/busy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/api/v1/packages/preview/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database unavailable", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/api/v1/download/preview/demo/9.9.9", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>not found</html>", http.StatusNotFound)
+	})
+	setupServer(t, mux)
+
+	origSleep := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		t.Errorf("slept %v, a wait this long is not retried", d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	tests := []struct {
+		name    string
+		target  error
+		wantMsg string
+	}{
+		{"missing", ErrPackageNotFound, "package @preview/missing not found"},
+		{"private", ErrNotAuthorized, "failed to get package: not authorized, run 'tpix login'"},
+		{"busy", ErrRateLimited, "failed to get package: rate limited by the server, try again in 2m0s"},
+		{"broken", nil, "failed to get package: database unavailable"},
+	}
+	for _, tt := range tests {
+		_, err := FetchPackage("preview", tt.name)
+		if err == nil {
+			t.Errorf("FetchPackage(%s) expected error", tt.name)
+			continue
+		}
+		if err.Error() != tt.wantMsg {
+			t.Errorf("FetchPackage(%s) error = %q, want %q", tt.name, err, tt.wantMsg)
+		}
+		if tt.target != nil && !errors.Is(err, tt.target) {
+			t.Errorf("FetchPackage(%s) error = %v, want %v", tt.name, err, tt.target)
+		}
+	}
+
+	_, err := downloadArchive(context.Background(), "preview", "demo", "9.9.9", "", nil)
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || err.Error() != "version 9.9.9 of @preview/demo not found" {
+		t.Errorf("downloadArchive() error = %v, want version not found", err)
+	}
+	if errors.Is(err, ErrPackageNotFound) {
+		t.Error("a missing version matches ErrPackageNotFound")
+	}
+}
+
+func TestGetRetriesOnRateLimit(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(PackageVersionsResponse{Versions: []PackageVersionInfo{{Version: "1.0.0"}}})
+	})
+	mux.HandleFunc("/api/v1/packages/preview/busy/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	setupServer(t, mux)
+
+	var slept, reported []time.Duration
+	origSleep, origOnRateLimit := sleep, OnRateLimit
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	OnRateLimit = func(wait time.Duration) { reported = append(reported, wait) }
+	t.Cleanup(func() { sleep, OnRateLimit = origSleep, origOnRateLimit })
+
+	published, err := VersionPublished("preview", "demo", "1.0.0")
+	if err != nil || !published {
+		t.Fatalf("VersionPublished() = %v, %v, want true", published, err)
+	}
+	want := []time.Duration{2 * time.Second, 2 * time.Second}
+	if requests != 3 || !slices.Equal(slept, want) || !slices.Equal(reported, want) {
+		t.Errorf("sent %d requests, waited %v and reported %v, want 3 requests and %v", requests, slept, reported, want)
+	}
+
+	// Without Retry-After, requests back off exponentially and give up
+	slept = nil
+	_, err = VersionPublished("preview", "busy", "1.0.0")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("VersionPublished() error = %v, want %v", err, ErrRateLimited)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; !slices.Equal(slept, want) {
+		t.Errorf("waited %v, want %v", slept, want)
+	}
+}
+
+func TestRateLimitWaitCancelled(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/busy/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/api/v1/packages/upload", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	setupServer(t, mux)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := makeRequestContext(ctx, "GET", "/api/v1/packages/preview/busy/versions", nil, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("makeRequestContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	path := filepath.Join(t.TempDir(), "demo.tar.gz")
+	os.WriteFile(path, buildArchive(t, map[string]string{"lib.typ": ""}), 0644)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := UploadPackage(ctx, path, "preview", UploadOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UploadPackage() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %v for the rate limit despite the cancelled context", elapsed)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// LogRequests passes a one-line summary of every request sent to the TPIX
+// server, with its status and timing, to logf. The Authorization header is
+// never logged, only whether it was sent. It can be combined with TraceTo.
+func LogRequests(logf func(format string, args ...any)) {
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = &logTransport{next: next, logf: logf}
+}
+
+// logTransport is an http.RoundTripper that logs a line per request.
+type logTransport struct {
+	next http.RoundTripper
+	logf func(format string, args ...any)
+}
+
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	auth := ""
+	if req.Header.Get("Authorization") != "" {
+		auth = " (Authorization: [REDACTED])"
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		t.logf("HTTP %s %s%s: %v (%s)\n", req.Method, req.URL.Redacted(), auth, err, elapsed)
+		return nil, err
+	}
+	t.logf("HTTP %s %s%s: %s (%s)\n", req.Method, req.URL.Redacted(), auth, resp.Status, elapsed)
+	return resp, nil
+}
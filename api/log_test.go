@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/typstify/tpix-cli/config"
+)
+
+func TestLogRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	setupServer(t, mux)
+	loadConfig = func() (config.Config, error) {
+		return config.Config{AccessToken: "secret-token"}, nil
+	}
+
+	origClient := httpClient
+	httpClient = &http.Client{}
+	t.Cleanup(func() { httpClient = origClient })
+
+	var lines []string
+	LogRequests(func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+
+	FetchPackage("preview", "demo")
+
+	if len(lines) == 0 {
+		t.Fatal("no requests logged")
+	}
+	want := "HTTP GET " + serverURL + "/api/v1/packages/preview/demo (Authorization: [REDACTED]): 404 Not Found ("
+	if !strings.HasPrefix(lines[0], want) {
+		t.Errorf("logged %q, want prefix %q", lines[0], want)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "secret-token") {
+			t.Errorf("log contains the access token: %q", line)
+		}
+	}
+}
@@ -29,6 +29,9 @@ type PackageResponse struct {
 	UpdatedAt     *time.Time           `json:"updated_at"`
 	LatestVersion PackageVersionInfo   `json:"latest_version"`
 	Versions      []PackageVersionInfo `json:"versions"`
+	// Downloads is the total download count of all versions, nil if the
+	// server does not report it.
+	Downloads *int64 `json:"downloads,omitempty"`
 }
 
 // PackageVersionInfo represents package version information
@@ -37,6 +40,12 @@ type PackageVersionInfo struct {
 	TypstVersion string     `json:"typst_version"`
 	SHA256       string     `json:"sha256"`
 	PublishedAt  *time.Time `json:"published_at"`
+	// Size is the size of the archive in bytes, zero if the server does not
+	// report it.
+	Size int64 `json:"size,omitempty"`
+	// Downloads is the download count of the version, nil if the server
+	// does not report it.
+	Downloads *int64 `json:"downloads,omitempty"`
 }
 
 // PackageVersionsResponse represents the response from the versions endpoint
@@ -44,6 +53,22 @@ type PackageVersionsResponse struct {
 	Versions []PackageVersionInfo `json:"versions"`
 }
 
+// BatchPackagesRequest is the body of a batch package request
+type BatchPackagesRequest struct {
+	Packages []string `json:"packages"`
+}
+
+// BatchPackagesResponse represents the batch package endpoint response
+type BatchPackagesResponse struct {
+	Packages []PackageResponse `json:"packages"`
+}
+
+// HealthResponse represents the response from the health endpoint
+type HealthResponse struct {
+	Status     string `json:"status"`
+	APIVersion string `json:"api_version"`
+}
+
 // UploadResponse represents an upload response.
 // When the package validation does not pass, only ValidateReport
 // is returned.
@@ -54,6 +79,8 @@ type UploadResponse struct {
 	Version        string   `json:"version"`
 	Size           int64    `json:"size"`
 	ValidateReport []string `json:"report"`
+	// Status is the HTTP status code of the upload response.
+	Status int `json:"-"`
 }
 
 // DependencyInfo represents a single package dependency
@@ -70,6 +97,18 @@ type DependenciesResponse struct {
 	Dependencies []DependencyInfo `json:"dependencies"`
 }
 
+// UserResponse represents the account an access token belongs to
+type UserResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// UserPackagesResponse represents the packages published by the current user
+type UserPackagesResponse struct {
+	Packages []PackageResponse `json:"packages"`
+}
+
 // ErrorResponse represents a standard error response
 type ErrorResponse struct {
 	Error       string `json:"error"`
@@ -81,6 +120,8 @@ type DeviceCodeResponse struct {
 	UserCode        string `json:"user_code"`
 	VerificationURI string `json:"verification_uri"`
 	ExpiresIn       int    `json:"expires_in"`
+	// Interval is the minimum number of seconds between token polls.
+	Interval int `json:"interval"`
 }
 
 type TokenResponse struct {
@@ -89,3 +130,12 @@ type TokenResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 }
+
+// Expiry returns when the access token expires, or the zero time if the
+// server did not say.
+func (t *TokenResponse) Expiry() time.Time {
+	if t.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ConfigureTLS sets up how the certificate of the TPIX server is verified,
+// for API calls and package downloads alike. Certificates in the PEM file
+// caCertFile, if not empty, are trusted in addition to the system ones,
+// for servers using a private CA. insecure skips verification entirely and
+// is only meant for testing. It must be called before TraceTo and
+// LogRequests.
+func ConfigureTLS(caCertFile string, insecure bool) error {
+	if caCertFile == "" && !insecure {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caCertFile != "" {
+		data, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no PEM certificates found in %s", caCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient.Transport = transport
+	return nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageResponse{Namespace: "preview", Name: "demo"})
+	}))
+	t.Cleanup(srv.Close)
+	setupServer(t, http.NotFoundHandler())
+	serverURL = srv.URL
+
+	origClient := httpClient
+	t.Cleanup(func() { httpClient = origClient })
+
+	fetch := func() error {
+		resetPackageCache()
+		_, err := FetchPackage("preview", "demo")
+		return err
+	}
+
+	// The test server's certificate is signed by an unknown CA
+	httpClient = &http.Client{}
+	if err := fetch(); err == nil {
+		t.Fatal("FetchPackage() succeeded without trusting the test CA")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	os.WriteFile(caFile, cert, 0644)
+	if err := ConfigureTLS(caFile, false); err != nil {
+		t.Fatalf("ConfigureTLS() error = %v", err)
+	}
+	if err := fetch(); err != nil {
+		t.Errorf("FetchPackage() with the CA certificate error = %v", err)
+	}
+
+	httpClient = &http.Client{}
+	if err := ConfigureTLS("", true); err != nil {
+		t.Fatalf("ConfigureTLS() error = %v", err)
+	}
+	if err := fetch(); err != nil {
+		t.Errorf("FetchPackage() with verification disabled error = %v", err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0644)
+	if err := ConfigureTLS(notPEM, false); err == nil {
+		t.Error("ConfigureTLS() expected error for a file without certificates")
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TraceTo logs every request sent to the TPIX server and its response to w.
+// Credentials are masked, and bodies are only logged by size, so the trace
+// can be attached to bug reports.
+func TraceTo(w io.Writer) {
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = &traceTransport{next: next, w: w}
+}
+
+// traceTransport is an http.RoundTripper that writes a plain text log of
+// the traffic passing through it.
+type traceTransport struct {
+	next http.RoundTripper
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintf(t.w, "%s --> %s %s\n", start.Format(time.RFC3339), req.Method, req.URL)
+	writeHeaders(t.w, req.Header)
+	fmt.Fprintf(t.w, "    body: %s\n", bodySize(req.ContentLength))
+
+	if err != nil {
+		fmt.Fprintf(t.w, "<-- error: %v (%s)\n\n", err, elapsed.Round(time.Millisecond))
+		return nil, err
+	}
+
+	fmt.Fprintf(t.w, "<-- %s (%s)\n", resp.Status, elapsed.Round(time.Millisecond))
+	writeHeaders(t.w, resp.Header)
+	fmt.Fprintf(t.w, "    body: %s\n\n", bodySize(resp.ContentLength))
+
+	return resp, nil
+}
+
+// redactedHeaders are never written to a trace.
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+func writeHeaders(w io.Writer, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			if redactedHeaders[name] {
+				value = "[REDACTED]"
+			}
+			fmt.Fprintf(w, "    %s: %s\n", name, value)
+		}
+	}
+}
+
+func bodySize(n int64) string {
+	if n < 0 {
+		return "unknown size"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
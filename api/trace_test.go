@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/typstify/tpix-cli/config"
+	"github.com/typstify/tpix-cli/version"
+)
+
+func TestTraceTo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/preview/demo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PackageResponse{Namespace: "preview", Name: "demo"})
+	})
+	mux.HandleFunc("/api/v1/packages/preview/demo/versions", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	setupServer(t, mux)
+	loadConfig = func() (config.Config, error) {
+		return config.Config{AccessToken: "secret-token"}, nil
+	}
+
+	origClient := httpClient
+	httpClient = &http.Client{}
+	t.Cleanup(func() { httpClient = origClient })
+
+	var trace bytes.Buffer
+	TraceTo(&trace)
+
+	if _, err := FetchPackage("preview", "demo"); err != nil {
+		t.Fatalf("FetchPackage() error = %v", err)
+	}
+
+	got := trace.String()
+	for _, want := range []string{
+		"--> GET " + serverURL + "/api/v1/packages/preview/demo\n",
+		"<-- 200 OK",
+		"--> GET " + serverURL + "/api/v1/packages/preview/demo/versions\n",
+		"<-- 404 Not Found",
+		"    Authorization: [REDACTED]\n",
+		"    User-Agent: " + version.UserAgent() + "\n",
+		"    body: 10 bytes\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("trace does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "secret-token") {
+		t.Errorf("trace contains the access token:\n%s", got)
+	}
+}
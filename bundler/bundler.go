@@ -2,17 +2,70 @@ package bundler
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 )
 
+// Archive formats a package can be created in.
+const (
+	// FormatTarGz is a gzip compressed tar archive, the format the TPIX
+	// server accepts.
+	FormatTarGz = "tar.gz"
+	// FormatZip is a zip archive, for tools that do not read tar.gz.
+	FormatZip = "zip"
+)
+
+// TypstignoreFile is the name of the file at the package root listing
+// files to leave out of the package, in gitignore syntax.
+const TypstignoreFile = ".typstignore"
+
+// DefaultExcludes are the exclude patterns applied to every package unless
+// NoDefaultExcludes is set: version control directories and files left
+// behind by operating systems and editors, at any depth.
+var DefaultExcludes = []string{
+	"**/.git",
+	"**/.hg",
+	"**/.svn",
+	"**/.bzr",
+	"**/.DS_Store",
+	"**/Thumbs.db",
+	"**/desktop.ini",
+	"**/*.swp",
+	"**/*.swo",
+	"**/*~",
+	"**/.#*",
+}
+
 // PackageCreator creates a Typst package from a directory
 type PackageCreator struct {
 	exclude []string
+
+	// NoDefaultExcludes disables the DefaultExcludes patterns.
+	NoDefaultExcludes bool
+
+	// Format is the archive format, FormatTarGz if empty.
+	Format string
+
+	// UseGitignore applies the rules of .gitignore files found in the
+	// source directory and its subdirectories.
+	UseGitignore bool
+
+	// Reproducible strips timestamps and ownership from the archive so the
+	// same source tree always produces a byte-identical package.
+	Reproducible bool
+
+	// OnFile, if set, is called for every file added to the package with
+	// its path relative to the source directory and its size.
+	OnFile func(path string, size int64)
 }
 
 // NewPackageCreator creates a new PackageCreator
@@ -22,44 +75,162 @@ func NewPackageCreator(exclude []string) *PackageCreator {
 	}
 }
 
-// CreatePackage creates a tar.gz package from the source directory
+// CreatePackage creates a package from the source directory, a tar.gz
+// archive unless another Format is set. An outputPath of "-" writes the
+// package to stdout.
 func (p *PackageCreator) CreatePackage(srcDir, outputPath string) error {
+	pkg, err := p.Prepare(srcDir)
+	if err != nil {
+		return err
+	}
+	return pkg.Create(outputPath)
+}
+
+// WritePackage writes the package of the source directory to w, as
+// CreatePackage does. The archive writers are flushed and closed before
+// it returns, but w itself is not closed.
+func (p *PackageCreator) WritePackage(srcDir string, w io.Writer) error {
+	pkg, err := p.Prepare(srcDir)
+	if err != nil {
+		return err
+	}
+	return pkg.Write(w)
+}
+
+// PreparedPackage is a package whose manifest has been validated and whose
+// files have been selected, ready to be written.
+type PreparedPackage struct {
+	write   func(io.Writer, []fileEntry) error
+	entries []fileEntry
+}
+
+// Prepare validates the manifest of srcDir and selects the files to package
+// once, so that they can be checked before the package is written.
+func (p *PackageCreator) Prepare(srcDir string) (*PreparedPackage, error) {
+	write, entries, err := p.prepare(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedPackage{write: write, entries: entries}, nil
+}
+
+// Create writes the package to outputPath, or to stdout if it is "-".
+func (pkg *PreparedPackage) Create(outputPath string) error {
+	if outputPath == "-" {
+		return pkg.Write(os.Stdout)
+	}
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	if err := pkg.Write(outputFile); err != nil {
+		return err
+	}
+	return outputFile.Close()
+}
+
+// Write writes the package to w, as WritePackage does.
+func (pkg *PreparedPackage) Write(w io.Writer) error {
+	if err := pkg.write(w, pkg.entries); err != nil {
+		return fmt.Errorf("failed to create package: %w", err)
+	}
+	return nil
+}
+
+// prepare validates the manifest of srcDir and returns the writer for the
+// archive format along with the entries to package.
+func (p *PackageCreator) prepare(srcDir string) (func(io.Writer, []fileEntry) error, []fileEntry, error) {
+	write := p.writeTarGz
+	switch p.Format {
+	case "", FormatTarGz:
+	case FormatZip:
+		write = p.writeZip
+	default:
+		return nil, nil, fmt.Errorf("unsupported archive format %q, use %s or %s", p.Format, FormatTarGz, FormatZip)
+	}
+
 	// Read and validate manifest
 	manifestPath := filepath.Join(srcDir, "typst.toml")
 	manifestData, err := os.ReadFile(manifestPath)
 	if err != nil {
-		return fmt.Errorf("failed to read typst.toml: %w", err)
+		return nil, nil, fmt.Errorf("failed to read typst.toml: %w", err)
 	}
 
 	var manifest Manifest
 	if err := DecodeBytes(manifestData, &manifest); err != nil {
-		return fmt.Errorf("failed to parse typst.toml: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse typst.toml: %w", err)
 	}
 
 	// Validate required fields
 	if err := p.validateManifest(&manifest); err != nil {
-		return err
+		return nil, nil, err
+	}
+	if errs := checkManifestFiles(srcDir, &manifest); len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid typst.toml: %w", errors.Join(errs...))
 	}
 
-	// Merge exclude patterns from manifest
-	excludePatterns := p.exclude
+	// Merge exclude patterns from manifest and the defaults
+	excludePatterns := slices.Clone(p.exclude)
 	if len(manifest.Package.Exclude) > 0 {
 		excludePatterns = append(excludePatterns, manifest.Package.Exclude...)
 	}
+	if !p.NoDefaultExcludes {
+		excludePatterns = append(excludePatterns, DefaultExcludes...)
+	}
 
-	outputFile, err := os.Create(outputPath)
+	entries, err := p.collectFiles(srcDir, excludePatterns)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return nil, nil, fmt.Errorf("failed to create package: %w", err)
 	}
-	defer outputFile.Close()
 
-	gzw := gzip.NewWriter(outputFile)
-	defer gzw.Close()
+	return write, entries, nil
+}
 
-	tw := tar.NewWriter(gzw)
-	defer tw.Close()
+// fileEntry is a file or directory selected for inclusion in a package.
+type fileEntry struct {
+	// path is the location of the entry on disk.
+	path string
+	// name is the slash-separated path of the entry inside the archive.
+	name string
+	info os.FileInfo
+}
+
+// collectFiles walks srcDir and returns the entries to package, sorted by
+// their archive name so the result does not depend on the filesystem.
+func (p *PackageCreator) collectFiles(srcDir string, excludePatterns []string) ([]fileEntry, error) {
+	var entries []fileEntry
+
+	// Rules of the .typstignore file at the package root. They take
+	// precedence over .gitignore, so that they can re-include files.
+	typstRules, err := parseIgnoreFile(filepath.Join(srcDir, TypstignoreFile), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", TypstignoreFile, err)
+	}
+
+	// Rules from .gitignore files, collected as directories are visited.
+	var ignoreRules []ignoreRule
+	loadGitignore := func(dir, base string) error {
+		if !p.UseGitignore {
+			return nil
+		}
+		rules, err := parseIgnoreFile(filepath.Join(dir, ".gitignore"), base)
+		if err != nil {
+			return fmt.Errorf("failed to read .gitignore: %w", err)
+		}
+		ignoreRules = append(ignoreRules, rules...)
+		return nil
+	}
+
+	isIgnored := func(relPath string, isDir bool) bool {
+		if ignored, matched := ignoreDecision(typstRules, relPath, isDir); matched {
+			return ignored
+		}
+		return ignoredBy(ignoreRules, relPath, isDir)
+	}
 
-	// Walk the source directory and add files to tar
 	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
@@ -73,51 +244,146 @@ func (p *PackageCreator) CreatePackage(srcDir, outputPath string) error {
 
 		// Skip the root directory itself
 		if relPath == "." {
-			return nil
+			return loadGitignore(path, "")
 		}
 
 		// Check if file should be excluded
-		if p.shouldExclude(relPath, excludePatterns) {
+		if p.shouldExclude(relPath, excludePatterns) || isIgnored(filepath.ToSlash(relPath), info.IsDir()) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		// Create tar header
-		header, err := tar.FileInfoHeader(info, "")
+		if info.IsDir() {
+			if err := loadGitignore(path, filepath.ToSlash(relPath)); err != nil {
+				return err
+			}
+		}
+
+		// Use forward slashes for the archive
+		entries = append(entries, fileEntry{path: path, name: filepath.ToSlash(relPath), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	return entries, nil
+}
+
+// writeTarGz writes entries as a gzip compressed tar archive to w.
+func (p *PackageCreator) writeTarGz(w io.Writer, entries []fileEntry) error {
+	// The gzip header carries no name or modification time, so it is
+	// identical for every archive.
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	for _, entry := range entries {
+		header, err := tar.FileInfoHeader(entry.info, "")
 		if err != nil {
 			return err
 		}
+		header.Name = entry.name
 
-		// Use forward slashes for the archive
-		header.Name = filepath.ToSlash(relPath)
+		if p.Reproducible {
+			normalizeHeader(header)
+		}
 
 		if err := tw.WriteHeader(header); err != nil {
 			return err
 		}
 
 		// Write file content (skip directories)
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
+		if !entry.info.IsDir() {
+			if err := copyFile(tw, entry.path); err != nil {
 				return err
 			}
-			defer file.Close()
 
-			if _, err := io.Copy(tw, file); err != nil {
+			if p.OnFile != nil {
+				p.OnFile(entry.name, entry.info.Size())
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// zipEpoch is the modification time of entries in reproducible zip
+// archives, the earliest time the format can represent.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// writeZip writes entries as a zip archive to w.
+func (p *PackageCreator) writeZip(w io.Writer, entries []fileEntry) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		header, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.name
+		if entry.info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		if p.Reproducible {
+			header.Modified = zipEpoch
+		}
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		// Write file content (skip directories)
+		if !entry.info.IsDir() {
+			if err := copyFile(fw, entry.path); err != nil {
 				return err
 			}
+
+			if p.OnFile != nil {
+				p.OnFile(entry.name, entry.info.Size())
+			}
 		}
+	}
 
-		return nil
-	})
+	return zw.Close()
+}
 
+// normalizeHeader strips the metadata that varies between machines and
+// checkouts, so that bundling the same tree always yields the same bytes.
+// Only the name, type, size and permission bits are kept.
+func normalizeHeader(header *tar.Header) {
+	header.ModTime = time.Unix(0, 0)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.PAXRecords = nil
+}
+
+// copyFile copies the content of the file at path to w.
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to create package: %w", err)
+		return err
 	}
+	defer file.Close()
 
-	return nil
+	_, err = io.Copy(w, file)
+	return err
 }
 
 // validateManifest validates that the manifest has required fields
@@ -154,14 +420,20 @@ func (p *PackageCreator) shouldExclude(path string, patterns []string) bool {
 			return true
 		}
 
-		// Directory match (exclude all contents of directory)
+		// Directory match (exclude the directory and all of its contents)
 		if strings.HasSuffix(pattern, "/") {
 			dir := strings.TrimSuffix(pattern, "/")
-			if strings.HasPrefix(path, dir+"/") {
+			if path == dir || strings.HasPrefix(path, dir+"/") {
 				return true
 			}
 		}
 
+		// Recursive glob match, where a ** segment spans any number of
+		// directories, e.g. **/*.tmp, build/** or docs/**/*.png
+		if strings.Contains(pattern, "**") && matchGlob(pattern, path) {
+			return true
+		}
+
 		// Wildcard match at the end
 		if strings.HasSuffix(pattern, "*") {
 			prefix := strings.TrimSuffix(pattern, "*")
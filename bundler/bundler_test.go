@@ -0,0 +1,537 @@
+package bundler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testManifest = `[package]
+name = "demo"
+version = "0.1.0"
+entrypoint = "lib.typ"
+`
+
+// writeTree creates the given files below dir. Parent directories are
+// created as needed.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+}
+
+// archiveHeaders returns the headers of all entries in a tar.gz archive.
+func archiveHeaders(t *testing.T, archivePath string) []*tar.Header {
+	t.Helper()
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	defer gzr.Close()
+
+	var headers []*tar.Header
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		headers = append(headers, header)
+	}
+
+	return headers
+}
+
+// archiveFiles returns the sorted names of the regular files in a tar.gz.
+func archiveFiles(t *testing.T, archivePath string) []string {
+	t.Helper()
+
+	var names []string
+	for _, header := range archiveHeaders(t, archivePath) {
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// bundle packages srcDir with creator and returns the bundled file names.
+func bundle(t *testing.T, creator *PackageCreator, srcDir string) []string {
+	t.Helper()
+
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := creator.CreatePackage(srcDir, output); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+
+	return archiveFiles(t, output)
+}
+
+func TestCreatePackageGitignore(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":        testManifest,
+		"lib.typ":           "",
+		".gitignore":        "*.pdf\n!keep.pdf\nbuild/\n",
+		"out.pdf":           "",
+		"keep.pdf":          "",
+		"build/cache.bin":   "",
+		"docs/manual.pdf":   "",
+		"docs/.gitignore":   "/draft.typ\n",
+		"docs/draft.typ":    "",
+		"docs/final.typ":    "",
+		"src/draft.typ":     "",
+		"src/build/out.txt": "",
+	})
+
+	creator := NewPackageCreator(nil)
+	creator.UseGitignore = true
+
+	got := bundle(t, creator, srcDir)
+	want := []string{
+		".gitignore",
+		"docs/.gitignore",
+		"docs/final.typ",
+		"keep.pdf",
+		"lib.typ",
+		"src/draft.typ",
+		"typst.toml",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bundled files = %v, want %v", got, want)
+	}
+}
+
+func TestCreatePackageGitignoreDisabled(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml": testManifest,
+		"lib.typ":    "",
+		".gitignore": "*.pdf\n",
+		"out.pdf":    "",
+	})
+
+	got := bundle(t, NewPackageCreator(nil), srcDir)
+	if !contains(got, "out.pdf") {
+		t.Errorf("bundled files = %v, want out.pdf included", got)
+	}
+}
+
+func TestParseIgnoreRules(t *testing.T) {
+	input := `# comment
+
+*.log
+!important.log
+/root.txt
+build/
+docs/**/*.png
+\#literal
+`
+	rules, err := parseIgnoreRules(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("parseIgnoreRules() error = %v", err)
+	}
+
+	want := []ignoreRule{
+		{pattern: "*.log"},
+		{pattern: "important.log", negate: true},
+		{pattern: "root.txt", anchored: true},
+		{pattern: "build", dirOnly: true},
+		{pattern: "docs/**/*.png", anchored: true},
+		{pattern: "#literal"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("parseIgnoreRules() = %+v, want %+v", rules, want)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreatePackageReproducible(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":      testManifest,
+		"lib.typ":         "#let x = 1",
+		"src/a.typ":       "a",
+		"src/nested/b.md": "b",
+	})
+
+	creator := NewPackageCreator(nil)
+	creator.Reproducible = true
+
+	first := filepath.Join(t.TempDir(), "first.tar.gz")
+	if err := creator.CreatePackage(srcDir, first); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+
+	// Touch every file so that only the modification times differ.
+	later := time.Now().Add(time.Hour)
+	filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		return os.Chtimes(path, later, later)
+	})
+
+	second := filepath.Join(t.TempDir(), "second.tar.gz")
+	if err := creator.CreatePackage(srcDir, second); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+
+	firstData, _ := os.ReadFile(first)
+	secondData, _ := os.ReadFile(second)
+	if !bytes.Equal(firstData, secondData) {
+		t.Error("bundling the same tree twice produced different archives")
+	}
+}
+
+func TestShouldExclude(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"README.md", "README.md", true},
+		{"node_modules/", "node_modules", true},
+		{"node_modules/", "node_modules/a/b.js", true},
+		{"*.test", "a.test", true},
+		{"**/*.tmp", "a.tmp", true},
+		{"**/*.tmp", "x/y/a.tmp", true},
+		{"**/*.tmp", "x/y/a.typ", false},
+		{"build/**", "build", true},
+		{"build/**", "build/out/a.pdf", true},
+		{"build/**", "src/build/a.pdf", false},
+		{"docs/**/*.png", "docs/a.png", true},
+		{"docs/**/*.png", "docs/img/deep/a.png", true},
+		{"docs/**/*.png", "src/docs/a.png", false},
+		{"docs/**/*.png", "docs/img/a.svg", false},
+		{"**/cache/**", "a/cache/b/c.bin", true},
+	}
+
+	p := NewPackageCreator(nil)
+	for _, tt := range tests {
+		if got := p.shouldExclude(tt.path, []string{tt.pattern}); got != tt.want {
+			t.Errorf("shouldExclude(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCreatePackageRecursiveExclude(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":           testManifest,
+		"lib.typ":              "",
+		"a.pdf":                "",
+		"src/deep/b.pdf":       "",
+		"src/deep/c.typ":       "",
+		"build/out/manual.typ": "",
+		"docs/img/logo.png":    "",
+		"docs/img/logo.svg":    "",
+	})
+
+	creator := NewPackageCreator([]string{"**/*.pdf", "build/**", "docs/**/*.png"})
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := creator.CreatePackage(srcDir, output); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+
+	got := archiveFiles(t, output)
+	want := []string{"docs/img/logo.svg", "lib.typ", "src/deep/c.typ", "typst.toml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bundled files = %v, want %v", got, want)
+	}
+
+	// The excluded build directory must be skipped as a whole rather than
+	// being added as an empty directory.
+	for _, header := range archiveHeaders(t, output) {
+		if strings.HasPrefix(header.Name, "build") {
+			t.Errorf("excluded directory entry %q was bundled", header.Name)
+		}
+	}
+}
+
+func TestCreatePackageExcludeFrom(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":     testManifest,
+		"lib.typ":        "",
+		"notes.txt":      "",
+		"draft/a.typ":    "",
+		"assets/big.pdf": "",
+	})
+
+	excludeFile := filepath.Join(t.TempDir(), "exclude.txt")
+	os.WriteFile(excludeFile, []byte("# local files\nnotes.txt\n\n  draft/  \n**/*.pdf\n"), 0644)
+
+	patterns, err := ReadExcludeFile(excludeFile)
+	if err != nil {
+		t.Fatalf("ReadExcludeFile() error = %v", err)
+	}
+
+	wantPatterns := []string{"notes.txt", "draft/", "**/*.pdf"}
+	if !reflect.DeepEqual(patterns, wantPatterns) {
+		t.Errorf("ReadExcludeFile() = %v, want %v", patterns, wantPatterns)
+	}
+
+	got := bundle(t, NewPackageCreator(patterns), srcDir)
+	want := []string{"lib.typ", "typst.toml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bundled files = %v, want %v", got, want)
+	}
+}
+
+func TestCreatePackageZip(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":    testManifest,
+		"lib.typ":       "#let x = 1",
+		"src/a.typ":     "a",
+		"build/out.pdf": "",
+	})
+
+	creator := NewPackageCreator([]string{"build/"})
+	creator.Format = FormatZip
+	creator.Reproducible = true
+
+	output := filepath.Join(t.TempDir(), "out.zip")
+	if err := creator.CreatePackage(srcDir, output); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatalf("zip.OpenReader() error = %v", err)
+	}
+	defer zr.Close()
+
+	var names []string
+	for _, f := range zr.File {
+		if !f.Modified.Equal(zipEpoch) {
+			t.Errorf("%s modified = %v, want %v", f.Name, f.Modified, zipEpoch)
+		}
+		if !f.FileInfo().IsDir() {
+			names = append(names, f.Name)
+		}
+	}
+	sort.Strings(names)
+	want := []string{"lib.typ", "src/a.typ", "typst.toml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("zipped files = %v, want %v", names, want)
+	}
+}
+
+func TestCreatePackageUnknownFormat(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{"typst.toml": testManifest, "lib.typ": ""})
+
+	creator := NewPackageCreator(nil)
+	creator.Format = "rar"
+	if err := creator.CreatePackage(srcDir, filepath.Join(t.TempDir(), "out.rar")); err == nil {
+		t.Error("CreatePackage() expected error for an unknown format")
+	}
+}
+
+func TestWritePackage(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{"typst.toml": testManifest, "lib.typ": "#let x = 1"})
+
+	creator := NewPackageCreator(nil)
+	creator.Reproducible = true
+
+	var buf bytes.Buffer
+	if err := creator.WritePackage(srcDir, &buf); err != nil {
+		t.Fatalf("WritePackage() error = %v", err)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := creator.CreatePackage(srcDir, output); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+	data, _ := os.ReadFile(output)
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("WritePackage() output differs from the file written by CreatePackage()")
+	}
+}
+
+func TestCreatePackageDefaultExcludes(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":         testManifest,
+		"lib.typ":            "",
+		".git/HEAD":          "",
+		".DS_Store":          "",
+		"src/.DS_Store":      "",
+		"src/Thumbs.db":      "",
+		"src/.lib.typ.swp":   "",
+		"src/utils.typ":      "",
+		"src/utils.typ~":     "",
+		"docs/.hg/store/x":   "",
+		"docs/manual.typ":    "",
+		"docs/.#manual.typ":  "",
+		"examples/.gitkeep":  "",
+		"examples/basic.typ": "",
+	})
+
+	got := bundle(t, NewPackageCreator(nil), srcDir)
+	want := []string{
+		"docs/manual.typ",
+		"examples/.gitkeep",
+		"examples/basic.typ",
+		"lib.typ",
+		"src/utils.typ",
+		"typst.toml",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bundled files = %v, want %v", got, want)
+	}
+
+	creator := NewPackageCreator(nil)
+	creator.NoDefaultExcludes = true
+	if got := bundle(t, creator, srcDir); !slices.Contains(got, ".git/HEAD") || !slices.Contains(got, "src/.DS_Store") {
+		t.Errorf("bundled files = %v, want VCS and OS files with NoDefaultExcludes", got)
+	}
+}
+
+func TestCreatePackageMissingFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "missing entrypoint",
+			files: map[string]string{
+				"typst.toml": "[package]\nname = \"demo\"\nversion = \"0.1.0\"\nentrypoint = \"src/lib.typ\"\n",
+				"lib.typ":    "",
+			},
+			wantErr: `entrypoint "src/lib.typ" does not exist`,
+		},
+		{
+			name: "entrypoint outside the package",
+			files: map[string]string{
+				"typst.toml": "[package]\nname = \"demo\"\nversion = \"0.1.0\"\nentrypoint = \"../lib.typ\"\n",
+			},
+			wantErr: `entrypoint "../lib.typ" is outside the package directory`,
+		},
+		{
+			name: "missing template entrypoint",
+			files: map[string]string{
+				"typst.toml":        testManifest + "\n[template]\npath = \"template\"\nentrypoint = \"main.typ\"\nthumbnail = \"thumbnail.png\"\n",
+				"lib.typ":           "",
+				"template/other.md": "",
+				"thumbnail.png":     "",
+			},
+			wantErr: `template entrypoint "template/main.typ" does not exist`,
+		},
+		{
+			name: "missing template directory and thumbnail",
+			files: map[string]string{
+				"typst.toml": testManifest + "\n[template]\npath = \"template\"\nentrypoint = \"main.typ\"\nthumbnail = \"thumbnail.png\"\n",
+				"lib.typ":    "",
+			},
+			wantErr: `template thumbnail "thumbnail.png" does not exist`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeTree(t, srcDir, tt.files)
+
+			output := filepath.Join(t.TempDir(), "out.tar.gz")
+			err := NewPackageCreator(nil).CreatePackage(srcDir, output)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CreatePackage() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(output); !os.IsNotExist(err) {
+				t.Error("CreatePackage() created an archive for an invalid package")
+			}
+		})
+	}
+}
+
+func TestCreatePackageTemplate(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":        testManifest + "\n[template]\npath = \"template\"\nentrypoint = \"main.typ\"\nthumbnail = \"thumbnail.png\"\n",
+		"lib.typ":           "",
+		"template/main.typ": "",
+		"thumbnail.png":     "",
+	})
+
+	got := bundle(t, NewPackageCreator(nil), srcDir)
+	want := []string{"lib.typ", "template/main.typ", "thumbnail.png", "typst.toml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bundled files = %v, want %v", got, want)
+	}
+}
+
+func TestCreatePackageTypstignore(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":       testManifest + "exclude = [\"notes.md\"]\n",
+		"lib.typ":          "",
+		".gitignore":       "*.pdf\n",
+		".typstignore":     "tests/\n*.png\n!thumbnail.png\n!docs/manual.pdf\n",
+		"tests/test.typ":   "",
+		"images/logo.png":  "",
+		"thumbnail.png":    "",
+		"docs/manual.pdf":  "",
+		"docs/draft.pdf":   "",
+		"docs/manual.typ":  "",
+		"notes.md":         "",
+		"src/.typstignore": "",
+	})
+
+	creator := NewPackageCreator(nil)
+	creator.UseGitignore = true
+
+	got := bundle(t, creator, srcDir)
+	want := []string{
+		".gitignore",
+		".typstignore",
+		"docs/manual.pdf",
+		"docs/manual.typ",
+		"lib.typ",
+		"src/.typstignore",
+		"thumbnail.png",
+		"typst.toml",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bundled files = %v, want %v", got, want)
+	}
+}
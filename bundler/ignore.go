@@ -0,0 +1,190 @@
+package bundler
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreRule is a single pattern read from a gitignore-style file.
+type ignoreRule struct {
+	// base is the slash-separated directory containing the ignore file,
+	// relative to the source directory. It is empty for the root.
+	base    string
+	pattern string
+	// negate re-includes paths matched by an earlier rule (`!pattern`).
+	negate bool
+	// dirOnly restricts the rule to directories (`pattern/`).
+	dirOnly bool
+	// anchored rules contain a slash and match the path relative to base.
+	// Other rules match the file name at any depth below base.
+	anchored bool
+}
+
+// parseIgnoreFile reads the rules of a gitignore-style file located in
+// the base directory. A missing file yields no rules.
+func parseIgnoreFile(filename, base string) ([]ignoreRule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseIgnoreRules(file, base)
+}
+
+// parseIgnoreRules parses gitignore syntax from r. Blank lines and lines
+// starting with `#` are skipped.
+func parseIgnoreRules(r io.Reader, base string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// match reports whether the rule applies to the slash-separated path,
+// relative to the source directory.
+func (r ignoreRule) match(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	rel := p
+	if r.base != "" {
+		if !strings.HasPrefix(p, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(p, r.base+"/")
+	}
+
+	if r.anchored {
+		return matchGlob(r.pattern, rel)
+	}
+
+	matched, _ := path.Match(r.pattern, path.Base(rel))
+	return matched
+}
+
+// ignoredBy evaluates rules in order and reports whether the path is
+// ignored. As in git, the last matching rule wins, so a negated rule can
+// re-include a path excluded by an earlier one.
+func ignoredBy(rules []ignoreRule, p string, isDir bool) bool {
+	ignored, _ := ignoreDecision(rules, p, isDir)
+	return ignored
+}
+
+// ignoreDecision is like ignoredBy, but also reports whether any rule
+// matched the path at all.
+func ignoreDecision(rules []ignoreRule, p string, isDir bool) (ignored, matched bool) {
+	for _, rule := range rules {
+		if rule.match(p, isDir) {
+			ignored = !rule.negate
+			matched = true
+		}
+	}
+	return ignored, matched
+}
+
+// matchGlob matches a slash-separated path against a glob pattern where
+// each segment follows path.Match syntax and a `**` segment matches zero
+// or more path segments.
+func matchGlob(pattern, p string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive ** and try every possible split.
+			rest := pattern[1:]
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		matched, err := path.Match(pattern[0], segments[0])
+		if err != nil || !matched {
+			return false
+		}
+
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// ReadExcludeFile reads exclude patterns from a file, one per line, in the
+// same syntax as the --exclude flag. Blank lines and lines starting with `#`
+// are ignored.
+func ReadExcludeFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
@@ -0,0 +1,71 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/typstify/tpix-cli/deps"
+)
+
+// localNamespace is Typst's namespace for locally installed packages, which
+// are never published to a registry.
+const localNamespace = "local"
+
+// VersionLookup returns the published versions of a package.
+type VersionLookup func(namespace, name string) ([]string, error)
+
+// UnresolvedImport is a package import that cannot be satisfied by the registry.
+type UnresolvedImport struct {
+	Dependency deps.Dependency
+	Reason     string
+}
+
+// ValidateImports scans the .typ files in srcDir for package imports and
+// checks each of them against the registry using lookup. Imports from the
+// @local namespace and imports of the package itself are skipped.
+func ValidateImports(srcDir string, lookup VersionLookup) ([]UnresolvedImport, error) {
+	manifestData, err := os.ReadFile(filepath.Join(srcDir, "typst.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read typst.toml: %w", err)
+	}
+
+	var manifest Manifest
+	if err := DecodeBytes(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse typst.toml: %w", err)
+	}
+
+	imports, err := deps.ExtractFromDirectory(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for imports: %w", err)
+	}
+
+	var unresolved []UnresolvedImport
+	for _, dep := range imports {
+		if dep.Namespace == localNamespace {
+			continue
+		}
+		if manifest.Package != nil && dep.Name == manifest.Package.Name {
+			continue
+		}
+
+		versions, err := lookup(dep.Namespace, dep.Name)
+		if err != nil {
+			unresolved = append(unresolved, UnresolvedImport{Dependency: dep, Reason: err.Error()})
+			continue
+		}
+
+		found := false
+		for _, v := range versions {
+			if v == dep.Version {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unresolved = append(unresolved, UnresolvedImport{Dependency: dep, Reason: "version not published"})
+		}
+	}
+
+	return unresolved, nil
+}
@@ -0,0 +1,47 @@
+package bundler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestValidateImports(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml": testManifest,
+		"lib.typ": `#import "@preview/cetz:0.3.0": canvas
+#import "@preview/missing:1.0.0": *
+#import "@preview/cetz:9.9.9": draw
+#import "@local/mine:0.1.0": *
+#import "@preview/demo:0.1.0": *`,
+	})
+
+	registry := map[string][]string{
+		"@preview/cetz": {"0.2.0", "0.3.0"},
+	}
+	lookup := func(namespace, name string) ([]string, error) {
+		versions, ok := registry["@"+namespace+"/"+name]
+		if !ok {
+			return nil, fmt.Errorf("package not found")
+		}
+		return versions, nil
+	}
+
+	unresolved, err := ValidateImports(srcDir, lookup)
+	if err != nil {
+		t.Fatalf("ValidateImports() error = %v", err)
+	}
+
+	want := map[string]string{
+		"@preview/missing:1.0.0": "package not found",
+		"@preview/cetz:9.9.9":    "version not published",
+	}
+	if len(unresolved) != len(want) {
+		t.Fatalf("ValidateImports() = %+v, want %d unresolved", unresolved, len(want))
+	}
+	for _, u := range unresolved {
+		if reason, ok := want[u.Dependency.Key()]; !ok || reason != u.Reason {
+			t.Errorf("unexpected unresolved import %s (%s)", u.Dependency.Key(), u.Reason)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package bundler
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// packageNamePattern matches kebab-case package names, as required by the
+// Typst package repository.
+var packageNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// starterEntrypoint is written to the entrypoint of a new package.
+const starterEntrypoint = `// Entrypoint of the package. Everything defined here can be imported.
+
+#let hello(name) = [Hello, #name!]
+`
+
+// Scaffold creates a new package in dir: a typst.toml for pkg and, unless
+// it exists already, a starter entrypoint file. An existing typst.toml is
+// only replaced if force is set; otherwise an error wrapping fs.ErrExist is
+// returned.
+func Scaffold(dir string, pkg *Package, force bool) error {
+	if !packageNamePattern.MatchString(pkg.Name) {
+		return fmt.Errorf("package name %q must be lowercase letters, digits and hyphens, starting with a letter", pkg.Name)
+	}
+	if !isStrictSemver(pkg.Version) {
+		return fmt.Errorf("package version %q is not a valid semantic version (MAJOR.MINOR.PATCH)", pkg.Version)
+	}
+	entrypoint := filepath.FromSlash(pkg.Entrypoint)
+	if pkg.Entrypoint == "" || !filepath.IsLocal(entrypoint) {
+		return fmt.Errorf("entrypoint %q must be a relative path inside the package", pkg.Entrypoint)
+	}
+
+	manifestPath := filepath.Join(dir, "typst.toml")
+	if _, err := os.Stat(manifestPath); err == nil && !force {
+		return fmt.Errorf("%s: %w", manifestPath, fs.ErrExist)
+	}
+
+	data, err := EncodeManifest(&Manifest{Package: pkg})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create package directory: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write typst.toml: %w", err)
+	}
+
+	entrypointPath := filepath.Join(dir, entrypoint)
+	if isFile(entrypointPath) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(entrypointPath), 0755); err != nil {
+		return fmt.Errorf("failed to create entrypoint directory: %w", err)
+	}
+	if err := os.WriteFile(entrypointPath, []byte(starterEntrypoint), 0644); err != nil {
+		return fmt.Errorf("failed to write entrypoint: %w", err)
+	}
+
+	return nil
+}
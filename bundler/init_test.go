@@ -0,0 +1,84 @@
+package bundler
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScaffold(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "demo")
+	pkg := &Package{
+		Name:        "demo",
+		Version:     "0.1.0",
+		Entrypoint:  "src/lib.typ",
+		Authors:     []string{"Jane"},
+		License:     "MIT",
+		Description: "A demo package",
+	}
+
+	if err := Scaffold(dir, pkg, false); err != nil {
+		t.Fatalf("Scaffold() error = %v", err)
+	}
+
+	report, err := Validate(dir)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if len(report.Errors) > 0 || len(report.Warnings) > 0 {
+		t.Errorf("Validate() errors = %v, warnings = %v", report.Errors, report.Warnings)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "typst.toml"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var manifest Manifest
+	if err := DecodeBytes(data, &manifest); err != nil {
+		t.Fatalf("DecodeBytes() error = %v", err)
+	}
+	if manifest.Package.Description != pkg.Description || manifest.Package.Entrypoint != pkg.Entrypoint {
+		t.Errorf("manifest package = %+v, want %+v", manifest.Package, pkg)
+	}
+
+	// An existing typst.toml is kept unless forced, the entrypoint always
+	if err := os.WriteFile(filepath.Join(dir, "src", "lib.typ"), []byte("custom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Scaffold(dir, pkg, false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Scaffold() error = %v, want fs.ErrExist", err)
+	}
+	pkg.Version = "0.2.0"
+	if err := Scaffold(dir, pkg, true); err != nil {
+		t.Fatalf("Scaffold(force) error = %v", err)
+	}
+	entrypoint, _ := os.ReadFile(filepath.Join(dir, "src", "lib.typ"))
+	if string(entrypoint) != "custom" {
+		t.Errorf("entrypoint = %q, want it left unchanged", entrypoint)
+	}
+}
+
+func TestScaffoldInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  Package
+	}{
+		{"uppercase name", Package{Name: "Demo", Version: "0.1.0", Entrypoint: "lib.typ"}},
+		{"short version", Package{Name: "demo", Version: "1.0", Entrypoint: "lib.typ"}},
+		{"entrypoint outside", Package{Name: "demo", Version: "0.1.0", Entrypoint: "../lib.typ"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := Scaffold(dir, &tt.pkg, false); err == nil {
+				t.Fatal("Scaffold() expected error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "typst.toml")); !os.IsNotExist(err) {
+				t.Errorf("typst.toml written for invalid package: %v", err)
+			}
+		})
+	}
+}
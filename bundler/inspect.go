@@ -0,0 +1,108 @@
+package bundler
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// ArchiveInfo describes a package archive created by CreatePackage.
+type ArchiveInfo struct {
+	Manifest *Manifest `json:"manifest"`
+	Files    int       `json:"files"`
+	// Entries lists the regular files in the archive in archive order.
+	Entries []ArchiveEntry `json:"entries"`
+	// Size is the total uncompressed size of the files.
+	Size int64 `json:"size"`
+	// ArchiveSize is the size of the archive itself.
+	ArchiveSize int64 `json:"archiveSize"`
+	// SHA256 is the checksum of the archive, as reported by the server
+	// after uploading it.
+	SHA256 string `json:"sha256"`
+}
+
+// ArchiveEntry is a file in a package archive.
+type ArchiveEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// InspectArchive reads the manifest of a package archive and lists the
+// files in it, without extracting it.
+func InspectArchive(archivePath string) (*ArchiveInfo, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The checksum covers the whole file, read once by the decompressor
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	r := io.TeeReader(f, io.MultiWriter(hasher, counter))
+
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gzr.Close()
+
+	info := &ArchiveInfo{}
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		info.Files++
+		info.Entries = append(info.Entries, ArchiveEntry{Name: header.Name, Size: header.Size})
+		info.Size += header.Size
+		if path.Clean(header.Name) != "typst.toml" {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read typst.toml: %w", err)
+		}
+		var manifest Manifest
+		if err := DecodeBytes(data, &manifest); err != nil {
+			return nil, err
+		}
+		info.Manifest = &manifest
+	}
+
+	if info.Manifest == nil {
+		return nil, fmt.Errorf("archive does not contain typst.toml")
+	}
+
+	// Include any padding after the end of the tar stream in the checksum
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	info.ArchiveSize = counter.n
+	info.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+
+	return info, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
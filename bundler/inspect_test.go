@@ -0,0 +1,49 @@
+package bundler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectArchive(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":   testManifest,
+		"lib.typ":      "#let x = 1",
+		"src/util.typ": "",
+	})
+
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := NewPackageCreator(nil).CreatePackage(srcDir, output); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	sum := sha256.Sum256(data)
+
+	info, err := InspectArchive(output)
+	if err != nil {
+		t.Fatalf("InspectArchive() error = %v", err)
+	}
+
+	if info.Manifest.Package.Name != "demo" || info.Manifest.Package.Version != "0.1.0" {
+		t.Errorf("Manifest = %+v", info.Manifest.Package)
+	}
+	if info.Files != 3 || len(info.Entries) != 3 {
+		t.Errorf("Files = %d, Entries = %v, want 3 files", info.Files, info.Entries)
+	}
+	if want := int64(len(testManifest) + len("#let x = 1")); info.Size != want {
+		t.Errorf("Size = %d, want %d", info.Size, want)
+	}
+	if info.ArchiveSize != int64(len(data)) {
+		t.Errorf("ArchiveSize = %d, want %d", info.ArchiveSize, len(data))
+	}
+	if want := hex.EncodeToString(sum[:]); info.SHA256 != want {
+		t.Errorf("SHA256 = %s, want %s", info.SHA256, want)
+	}
+}
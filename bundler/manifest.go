@@ -22,21 +22,21 @@ type Package struct {
 
 	// Required for repository submission
 	Authors     []string `toml:"authors" json:"authors"`
-	License     string   `toml:"license" json:"license"`
-	Description string   `toml:"description" json:"description"`
+	License     string   `toml:"license,omitempty" json:"license"`
+	Description string   `toml:"description,omitempty" json:"description"`
 
 	// Optional fields
-	Homepage   string   `toml:"homepage" json:"homepage"`
-	Repository string   `toml:"repository" json:"repository"`
-	Keywords   []string `toml:"keywords" json:"keywords"`
+	Homepage   string   `toml:"homepage,omitempty" json:"homepage"`
+	Repository string   `toml:"repository,omitempty" json:"repository"`
+	Keywords   []string `toml:"keywords,omitempty" json:"keywords"`
 
 	// Discovery metadata
-	Categories  []string `toml:"categories" json:"categories"`
-	Disciplines []string `toml:"disciplines" json:"disciplines"`
+	Categories  []string `toml:"categories,omitempty" json:"categories"`
+	Disciplines []string `toml:"disciplines,omitempty" json:"disciplines"`
 
 	// Technical metadata
-	Compiler string   `toml:"compiler" json:"compiler"`
-	Exclude  []string `toml:"exclude" json:"exclude"`
+	Compiler string   `toml:"compiler,omitempty" json:"compiler"`
+	Exclude  []string `toml:"exclude,omitempty" json:"exclude"`
 }
 
 // Template represents template-specific configuration
@@ -54,3 +54,16 @@ func DecodeBytes(manifestData []byte, val any) error {
 
 	return nil
 }
+
+// EncodeManifest serializes a manifest as the content of typst.toml.
+// Optional fields that are not set are left out.
+func EncodeManifest(manifest *Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := toml.NewEncoder(&buf)
+	encoder.SetIndentTables(false)
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to encode TOML: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
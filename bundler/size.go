@@ -0,0 +1,72 @@
+package bundler
+
+import (
+	"sort"
+)
+
+// Default thresholds for CheckSize. Typst packages are mostly source files,
+// so anything above them is likely a document, image or dataset bundled by
+// accident.
+const (
+	DefaultMaxFileSize    int64 = 5 << 20
+	DefaultMaxPackageSize int64 = 20 << 20
+)
+
+// maxLargestFiles is how many of the largest files a SizeReport lists.
+const maxLargestFiles = 5
+
+// SizeLimits are the thresholds above which a package is considered too
+// large. A zero limit disables the check.
+type SizeLimits struct {
+	MaxFileSize    int64
+	MaxPackageSize int64
+}
+
+// SizeReport is the result of CheckSize.
+type SizeReport struct {
+	// Total is the uncompressed size of all files.
+	Total int64
+	// TotalExceeded is set if Total is above MaxPackageSize.
+	TotalExceeded bool
+	// Oversized lists the files above MaxFileSize, largest first.
+	Oversized []ArchiveEntry
+	// Largest lists the largest files of the package, largest first.
+	Largest []ArchiveEntry
+}
+
+// OK reports whether the package is within the limits.
+func (r *SizeReport) OK() bool {
+	return !r.TotalExceeded && len(r.Oversized) == 0
+}
+
+// CheckSize checks the files of a package against limits.
+func CheckSize(entries []ArchiveEntry, limits SizeLimits) *SizeReport {
+	sorted := make([]ArchiveEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Size > sorted[j].Size
+	})
+
+	report := &SizeReport{}
+	for _, entry := range sorted {
+		report.Total += entry.Size
+		if limits.MaxFileSize > 0 && entry.Size > limits.MaxFileSize {
+			report.Oversized = append(report.Oversized, entry)
+		}
+	}
+	report.TotalExceeded = limits.MaxPackageSize > 0 && report.Total > limits.MaxPackageSize
+	report.Largest = sorted[:min(len(sorted), maxLargestFiles)]
+
+	return report
+}
+
+// Files lists the files of the package, with their sizes.
+func (pkg *PreparedPackage) Files() []ArchiveEntry {
+	var files []ArchiveEntry
+	for _, entry := range pkg.entries {
+		if entry.info.Mode().IsRegular() {
+			files = append(files, ArchiveEntry{Name: entry.name, Size: entry.info.Size()})
+		}
+	}
+	return files
+}
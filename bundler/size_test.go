@@ -0,0 +1,66 @@
+package bundler
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckSize(t *testing.T) {
+	entries := []ArchiveEntry{
+		{Name: "lib.typ", Size: 100},
+		{Name: "docs/manual.pdf", Size: 8000},
+		{Name: "data.csv", Size: 3000},
+		{Name: "typst.toml", Size: 50},
+	}
+
+	report := CheckSize(entries, SizeLimits{MaxFileSize: 2000, MaxPackageSize: 10000})
+	if report.OK() {
+		t.Error("OK() = true, want false")
+	}
+	if report.Total != 11150 || !report.TotalExceeded {
+		t.Errorf("Total = %d, TotalExceeded = %v, want 11150, true", report.Total, report.TotalExceeded)
+	}
+	wantOversized := []ArchiveEntry{{Name: "docs/manual.pdf", Size: 8000}, {Name: "data.csv", Size: 3000}}
+	if !reflect.DeepEqual(report.Oversized, wantOversized) {
+		t.Errorf("Oversized = %v, want %v", report.Oversized, wantOversized)
+	}
+	if len(report.Largest) != 4 || report.Largest[0].Name != "docs/manual.pdf" {
+		t.Errorf("Largest = %v, want all files, largest first", report.Largest)
+	}
+
+	if report := CheckSize(entries, SizeLimits{}); !report.OK() {
+		t.Error("OK() = false without limits, want true")
+	}
+}
+
+func TestPreparedPackageFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, map[string]string{
+		"typst.toml":   testManifest,
+		"lib.typ":      "#let x = 1",
+		"src/util.typ": "",
+	})
+
+	pkg, err := NewPackageCreator(nil).Prepare(srcDir)
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	want := []ArchiveEntry{
+		{Name: "lib.typ", Size: 10},
+		{Name: "src/util.typ", Size: 0},
+		{Name: "typst.toml", Size: int64(len(testManifest))},
+	}
+	if files := pkg.Files(); !reflect.DeepEqual(files, want) {
+		t.Errorf("Files() = %v, want %v", files, want)
+	}
+
+	// The package holds the files that were listed
+	output := filepath.Join(t.TempDir(), "out.tar.gz")
+	if err := pkg.Create(output); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got, want := archiveFiles(t, output), []string{"lib.typ", "src/util.typ", "typst.toml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archive files = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package bundler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/mod/semver"
+)
+
+// ValidationReport lists the problems found in a package directory.
+// Errors would make the server reject the package, warnings only affect
+// submission to the Typst package repository.
+type ValidationReport struct {
+	Errors   []string
+	Warnings []string
+}
+
+// OK reports whether the package has no hard errors.
+func (r *ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *ValidationReport) errorf(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *ValidationReport) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the typst.toml manifest in srcDir and the files it refers
+// to without creating a package. An error is only returned if the manifest
+// cannot be read; problems with its content are recorded in the report.
+func Validate(srcDir string) (*ValidationReport, error) {
+	manifestData, err := os.ReadFile(filepath.Join(srcDir, "typst.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read typst.toml: %w", err)
+	}
+
+	report := &ValidationReport{}
+
+	var manifest Manifest
+	if err := DecodeBytes(manifestData, &manifest); err != nil {
+		report.errorf("%v", err)
+		return report, nil
+	}
+
+	if err := (&PackageCreator{}).validateManifest(&manifest); err != nil {
+		report.errorf("%v", err)
+	}
+
+	pkg := manifest.Package
+	if pkg == nil {
+		return report, nil
+	}
+
+	if pkg.Version != "" && !isStrictSemver(pkg.Version) {
+		report.errorf("package version %q is not a valid semantic version (MAJOR.MINOR.PATCH)", pkg.Version)
+	}
+
+	for _, err := range checkManifestFiles(srcDir, &manifest) {
+		report.errorf("%v", err)
+	}
+
+	// Required for submission to the Typst package repository
+	if len(pkg.Authors) == 0 {
+		report.warnf("package authors are missing")
+	}
+	if pkg.License == "" {
+		report.warnf("package license is missing")
+	}
+	if pkg.Description == "" {
+		report.warnf("package description is missing")
+	}
+
+	return report, nil
+}
+
+// isStrictSemver reports whether v is a full MAJOR.MINOR.PATCH version,
+// as required for Typst packages.
+func isStrictSemver(v string) bool {
+	return semver.IsValid("v"+v) && semver.Canonical("v"+v) == "v"+v
+}
+
+// checkManifestFiles checks that the files the manifest refers to exist
+// below srcDir: the package entrypoint and, for templates, the template
+// directory, its entrypoint and the thumbnail. Empty fields are skipped.
+func checkManifestFiles(srcDir string, manifest *Manifest) []error {
+	var errs []error
+	check := func(field, name string, dir bool) {
+		if name == "" {
+			return
+		}
+		local := filepath.FromSlash(name)
+		if !filepath.IsLocal(local) {
+			errs = append(errs, fmt.Errorf("%s %q is outside the package directory", field, name))
+			return
+		}
+		path := filepath.Join(srcDir, local)
+		if dir {
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				errs = append(errs, fmt.Errorf("%s %q is not a directory", field, name))
+			}
+		} else if !isFile(path) {
+			errs = append(errs, fmt.Errorf("%s %q does not exist", field, name))
+		}
+	}
+
+	if manifest.Package != nil {
+		check("entrypoint", manifest.Package.Entrypoint, false)
+	}
+	if t := manifest.Template; t != nil {
+		check("template path", t.Path, true)
+		// The template entrypoint is relative to the template directory
+		if t.Entrypoint != "" {
+			check("template entrypoint", path.Join(filepath.ToSlash(t.Path), t.Entrypoint), false)
+		}
+		check("template thumbnail", t.Thumbnail, false)
+	}
+	return errs
+}
+
+// isFile reports whether path exists and is a regular file.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,88 @@
+package bundler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantErrors   []string
+		wantWarnings []string
+	}{
+		{
+			name: "complete package",
+			files: map[string]string{
+				"typst.toml": `[package]
+name = "demo"
+version = "0.1.0"
+entrypoint = "lib.typ"
+authors = ["Jane"]
+license = "MIT"
+description = "A demo package"
+`,
+				"lib.typ": "",
+			},
+		},
+		{
+			name: "missing metadata",
+			files: map[string]string{
+				"typst.toml": testManifest,
+				"lib.typ":    "",
+			},
+			wantWarnings: []string{
+				"package authors are missing",
+				"package license is missing",
+				"package description is missing",
+			},
+		},
+		{
+			name: "missing entrypoint and bad version",
+			files: map[string]string{
+				"typst.toml": `[package]
+name = "demo"
+version = "1.0"
+entrypoint = "src/lib.typ"
+authors = ["Jane"]
+license = "MIT"
+description = "A demo package"
+`,
+			},
+			wantErrors: []string{
+				`package version "1.0" is not a valid semantic version (MAJOR.MINOR.PATCH)`,
+				`entrypoint "src/lib.typ" does not exist`,
+			},
+		},
+		{
+			name: "missing package section",
+			files: map[string]string{
+				"typst.toml": "[template]\npath = \"template\"\n",
+			},
+			wantErrors: []string{"missing [package] section in typst.toml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeTree(t, srcDir, tt.files)
+
+			report, err := Validate(srcDir)
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(report.Errors, tt.wantErrors) {
+				t.Errorf("Errors = %q, want %q", report.Errors, tt.wantErrors)
+			}
+			if !reflect.DeepEqual(report.Warnings, tt.wantWarnings) {
+				t.Errorf("Warnings = %q, want %q", report.Warnings, tt.wantWarnings)
+			}
+			if report.OK() != (len(tt.wantErrors) == 0) {
+				t.Errorf("OK() = %v", report.OK())
+			}
+		})
+	}
+}
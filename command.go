@@ -1,49 +1,121 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/typstify/tpix-cli/api"
 	"github.com/typstify/tpix-cli/bundler"
 	"github.com/typstify/tpix-cli/config"
 	"github.com/typstify/tpix-cli/deps"
+	"github.com/typstify/tpix-cli/resolver"
+	"github.com/typstify/tpix-cli/utils"
 	"github.com/typstify/tpix-cli/version"
 )
 
 // parsePkgSpec parses a package spec in the format @namespace/name:version
-// Returns namespace, name, and version (version may be empty)
-func parsePkgSpec(pkgSpec string) (namespace, name, version string) {
+// Returns namespace, name, and version (version may be empty if the spec
+// has no colon). Whitespace around the spec and its components is ignored,
+// e.g. a trailing newline from a pipe. Components that would leave their
+// directory in the package cache, such as "..", are rejected.
+func parsePkgSpec(pkgSpec string) (namespace, name, version string, err error) {
 	// Remove leading @ and split on /
-	s := strings.TrimPrefix(pkgSpec, "@")
+	s := strings.TrimPrefix(strings.TrimSpace(pkgSpec), "@")
 	parts := strings.SplitN(s, "/", 2)
 	if len(parts) < 2 {
-		return
+		return "", "", "", fmt.Errorf("invalid package spec %q: use format @namespace/name[:version]", pkgSpec)
 	}
-	namespace = parts[0]
+	namespace = strings.TrimSpace(parts[0])
 
 	// Split name and version on :
 	nameVer := strings.SplitN(parts[1], ":", 2)
-	name = nameVer[0]
+	name = strings.TrimSpace(nameVer[0])
 	if len(nameVer) > 1 {
-		version = nameVer[1]
+		version = strings.TrimSpace(nameVer[1])
+		if version == "" {
+			return "", "", "", fmt.Errorf("invalid package spec %q: empty version after ':'", pkgSpec)
+		}
+	}
+
+	for _, part := range []string{namespace, name, version} {
+		if strings.ContainsAny(part, "/: \t\r\n") {
+			return "", "", "", fmt.Errorf("invalid package spec %q: use format @namespace/name[:version]", pkgSpec)
+		}
+		// The components are joined into paths in the package cache
+		if part == "." || part == ".." || strings.ContainsRune(part, '\\') {
+			return "", "", "", fmt.Errorf("invalid package spec %q: %q is not a valid namespace, name or version", pkgSpec, part)
+		}
+	}
+	if namespace == "" || name == "" {
+		return "", "", "", fmt.Errorf("invalid package spec %q: namespace and name are required", pkgSpec)
+	}
+	return namespace, name, version, nil
+}
+
+// parseExactPkgSpec parses a package spec that must include a version.
+func parseExactPkgSpec(pkgSpec string) (deps.Dependency, error) {
+	namespace, name, version, err := parsePkgSpec(pkgSpec)
+	if err != nil {
+		return deps.Dependency{}, err
+	}
+	if version == "" {
+		return deps.Dependency{}, fmt.Errorf("invalid package spec %q: a version is required, use format @namespace/name:version", pkgSpec)
 	}
-	return
+	return deps.Dependency{Namespace: namespace, Name: name, Version: version}, nil
 }
 
 func loginCmd() *cobra.Command {
+	var noBrowser bool
+	var token string
+	var as string
+
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Login the tpix server",
-		Long:  "Login the tpix server. User is required to login for all other operations",
-		Args:  cobra.ExactArgs(0),
+		Long: `Login the tpix server. User is required to login for all other operations.
+
+By default the device flow is used, which asks you to confirm the login in a
+browser. Alternatively, pass a personal access token created in the web UI
+with --token. Use "--token -" to read it from stdin, which keeps it out of
+your shell history.`,
+		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			tokenResp, err := api.DeviceLogin()
+			if as != "" {
+				if err := config.UseProfile(as); err != nil {
+					return err
+				}
+			}
+
+			if token != "" {
+				return loginWithToken(cmd.InOrStdin(), token)
+			}
+
+			// There is no browser to open in CI
+			openBrowser := !noBrowser && !utils.IsCI()
+			tokenResp, err := api.DeviceLogin(openBrowser)
 			if err != nil {
-				fmt.Printf("Login failed: %v\n", err)
+				errorf("login failed: %v\n", err)
 				return err
 			}
 
@@ -54,499 +126,3711 @@ func loginCmd() *cobra.Command {
 
 			cfg.AccessToken = tokenResp.AccessToken
 			cfg.RefreshToken = tokenResp.RefreshToken
-			config.Save(cfg)
-			fmt.Printf("\n\nSuccess! Access token saved\n")
+			cfg.TokenExpiry = tokenResp.Expiry()
+			cfg.TokenFromEnv = false
+			if err := config.Save(cfg); err != nil {
+				return err
+			}
+			summaryf("\n\nSuccess! Access token saved\n")
 
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&noBrowser, "no-browser", false, "Only print the verification URL and code instead of opening a browser")
+	cmd.Flags().StringVar(&token, "token", "", "Login with a personal access token, or - to read it from stdin")
+	cmd.Flags().StringVar(&as, "as", "", "Store the credentials under a named profile instead of the default ones")
+
 	return cmd
 }
 
-// searchPkgCmd searches Typst packages from TPIX server.
-func searchPkgCmd() *cobra.Command {
-	var namespace string
-	var limit int
+// minTokenLength is the length below which a string cannot be an access
+// token issued by the server.
+const minTokenLength = 16
+
+// loginWithToken validates a personal access token with the server and
+// stores it. A token of "-" is read from in.
+func loginWithToken(in io.Reader, token string) error {
+	token, err := readToken(in, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := api.CurrentUser(token)
+	if err != nil {
+		return fmt.Errorf("token validation failed: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// Personal access tokens are long-lived and cannot be refreshed
+	cfg.AccessToken = token
+	cfg.RefreshToken = ""
+	cfg.TokenExpiry = time.Time{}
+	cfg.TokenFromEnv = false
+	if err := config.Save(cfg); err != nil {
+		return err
+	}
+
+	summaryf("Logged in as %s, access token saved\n", user.Username)
+	return nil
+}
+
+// readToken returns the token passed to --token, reading it from in if it
+// is "-". Values that cannot be a token are rejected.
+func readToken(in io.Reader, token string) (string, error) {
+	if token == "-" {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read token: %w", err)
+		}
+		token = strings.TrimSpace(line)
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("no token given")
+	}
+	if len(token) < minTokenLength {
+		return "", fmt.Errorf("token is too short to be valid")
+	}
+	for _, c := range token {
+		if c <= ' ' || c > '~' {
+			return "", fmt.Errorf("token contains invalid characters")
+		}
+	}
+	return token, nil
+}
+
+// logoutCmd removes the stored credentials.
+func logoutCmd() *cobra.Command {
+	var as string
 
 	cmd := &cobra.Command{
-		Use:   "search <query>",
-		Short: "Search for Typst packages",
-		Args:  cobra.ExactArgs(1),
+		Use:   "logout",
+		Short: "Logout from the tpix server",
+		Long:  "Logout from the tpix server and remove the stored credentials",
+		Args:  cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			query := args[0]
+			if as != "" {
+				if err := config.UseProfile(as); err != nil {
+					return err
+				}
+			}
 
-			result, err := api.SearchPackages(query, namespace, limit)
+			cfg, err := config.Load()
 			if err != nil {
-				fmt.Printf("failed to search packages: %v", err)
-				return nil
+				return err
 			}
 
-			fmt.Printf("Found %d results for '%s':\n\n", result.Count, query)
-			for _, r := range result.Results {
-				fmt.Printf("@%s/%s - %s\n", r.Namespace, r.Name, r.Description)
+			cfg.AccessToken = ""
+			cfg.RefreshToken = ""
+			cfg.TokenExpiry = time.Time{}
+			cfg.TokenFromEnv = false
+			if err := config.Save(cfg); err != nil {
+				return err
 			}
 
+			summaryf("Logged out, credentials removed\n")
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Filter by namespace")
-	cmd.Flags().IntVarP(&limit, "limit", "l", 20, "Limit number of results")
+	cmd.Flags().StringVar(&as, "as", "", "Remove the credentials of a named profile instead of the default ones")
 
 	return cmd
 }
 
-// isPackageCached checks if a package version is already in the local cache.
-func isPackageCached(cacheDir, namespace, name, version string) bool {
-	pkgDir := filepath.Join(cacheDir, namespace, name, version)
-	info, err := os.Stat(pkgDir)
-	return err == nil && info.IsDir()
+// addProfileFlag adds the --as flag, which selects the credentials used by
+// a single command.
+func addProfileFlag(cmd *cobra.Command, as *string) {
+	cmd.Flags().StringVar(as, "as", "", "Use the credentials of a named profile, see 'tpix login --as'")
 }
 
-// fetchWithDeps downloads a package and its transitive dependencies.
-// visited tracks already-processed packages to prevent infinite loops.
-func fetchWithDeps(namespace, name, version, cacheDir string, visited map[string]bool, noDeps bool) error {
-	key := fmt.Sprintf("@%s/%s:%s", namespace, name, version)
-	if visited[key] {
-		return nil
+// profileFor returns the profile whose credentials are used for an
+// operation on namespace: the one given with --as, otherwise the one
+// configured for the namespace. An empty result selects the default
+// credentials.
+func profileFor(cfg config.Config, as, namespace string) string {
+	if as != "" {
+		return as
 	}
-	visited[key] = true
+	return cfg.NamespaceProfiles[namespace]
+}
 
-	if isPackageCached(cacheDir, namespace, name, version) {
-		fmt.Printf("  Already cached: %s\n", key)
-		// Do not return early, check if dependencies are satisfied.
-	} else {
-		fmt.Printf("  Downloading %s...\n", key)
-		if err := api.DownloadPackage(namespace, name, version); err != nil {
-			return fmt.Errorf("failed to download %s: %w", key, err)
+// useProfile selects the credentials for an operation on namespace, as
+// described for profileFor.
+func useProfile(as, namespace string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if name := profileFor(cfg, as, namespace); name != "" {
+		return config.UseProfile(name)
+	}
+	return nil
+}
+
+// compatibleVersion returns the newest version of pkg that compiles with
+// the given Typst version, or "" if there is none. Versions that do not
+// declare a minimum Typst version are considered compatible.
+func compatibleVersion(pkg *api.PackageResponse, typst string) string {
+	var best string
+	for _, v := range pkg.Versions {
+		if v.TypstVersion != "" {
+			if ok, err := version.AtLeast(typst, v.TypstVersion); err != nil || !ok {
+				continue
+			}
+		}
+		if best == "" {
+			best = v.Version
+		} else if c, err := version.Compare(v.Version, best); err == nil && c > 0 {
+			best = v.Version
 		}
 	}
+	return best
+}
 
-	if noDeps {
-		return nil
+// compatibleResults formats the search results that have a version
+// compatible with typst, given the package details in fetched. Results
+// missing from fetched cannot be checked and are listed as well, noting that
+// their compatibility is unknown; unknown counts them.
+func compatibleResults(results []api.SearchResult, fetched map[string]*api.PackageResponse, typst string) (lines []string, unknown int) {
+	for _, r := range results {
+		spec := fmt.Sprintf("@%s/%s", r.Namespace, r.Name)
+		pkg, ok := fetched[spec]
+		if !ok {
+			lines = append(lines, fmt.Sprintf("%s - %s (compatibility unknown)", spec, r.Description))
+			unknown++
+			continue
+		}
+		if v := compatibleVersion(pkg, typst); v != "" {
+			lines = append(lines, fmt.Sprintf("%s - %s (%s works with Typst %s)", spec, r.Description, v, typst))
+		}
+	}
+	return lines, unknown
+}
+
+// localTypstVersion returns the Typst version set in the config, otherwise
+// the version of the typst binary on the PATH. It returns "" if neither is
+// known.
+func localTypstVersion(cfg config.Config) string {
+	if cfg.TypstVersion != "" {
+		return cfg.TypstVersion
 	}
+	return installedTypstVersion()
+}
 
-	// Fetch and resolve transitive dependencies
-	depInfos, err := api.FetchDependencies(namespace, name, version)
+// installedTypstVersion returns the version of the typst binary on the
+// PATH, or "" if it cannot be found or its version cannot be read.
+func installedTypstVersion() string {
+	path, err := lookPath("typst")
 	if err != nil {
-		// Non-fatal: the server may not have dependency data for older packages
-		return nil
+		return ""
 	}
+	return parseTypstVersion(typstVersion(path))
+}
 
-	for _, dep := range depInfos {
-		if err := fetchWithDeps(dep.Namespace, dep.Name, dep.Version, cacheDir, visited, false); err != nil {
-			return err
-		}
+// parseTypstVersion extracts the version from the output of
+// "typst --version", e.g. "typst 0.12.0 (737895d7)".
+func parseTypstVersion(out string) string {
+	fields := strings.Fields(out)
+	if len(fields) < 2 || fields[0] != "typst" {
+		return ""
+	}
+	if _, err := version.Compare(fields[1], fields[1]); err != nil {
+		return ""
 	}
+	return fields[1]
+}
 
-	return nil
+// typstCompatWarning returns a warning if v requires a newer Typst than
+// typst, or "" if it does not or either version is unknown.
+func typstCompatWarning(v *api.PackageVersionInfo, typst string) string {
+	if v.TypstVersion == "" || typst == "" {
+		return ""
+	}
+	if ok, err := version.AtLeast(typst, v.TypstVersion); err != nil || ok {
+		return ""
+	}
+	return fmt.Sprintf("version %s requires Typst %s, but Typst %s is installed; it may not compile", v.Version, v.TypstVersion, typst)
 }
 
-// getPkgCmd download Typst packages from TPIX server.
-func getPkgCmd() *cobra.Command {
-	var noDeps bool
+// checkTypstCompat warns if the given package version requires a newer
+// Typst than the local one. The check is advisory: lookup failures are
+// ignored.
+func checkTypstCompat(cfg config.Config, namespace, name, pkgVersion string) {
+	typst := localTypstVersion(cfg)
+	if typst == "" {
+		debugf("Typst version unknown, skipping the compatibility check\n")
+		return
+	}
+	pkg, err := api.FetchPackage(namespace, name)
+	if err != nil {
+		debugf("Skipping the compatibility check: %v\n", err)
+		return
+	}
+	v, err := findVersion(pkg, pkgVersion)
+	if err != nil {
+		return
+	}
+	if msg := typstCompatWarning(v, typst); msg != "" {
+		warnf("@%s/%s: %s\n", namespace, name, msg)
+	}
+}
+
+// searchPkgCmd searches Typst packages from TPIX server.
+func searchPkgCmd() *cobra.Command {
+	var namespace string
+	var limit int
+	var typst string
 
 	cmd := &cobra.Command{
-		Use:   "get <namespace/name:version>",
-		Short: "Download a package from TPIX server",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			pkgSpec := args[0]
+		Use:   "search <query>",
+		Short: "Search for Typst packages",
+		Long: `Search for Typst packages on the TPIX server.
 
-			// Parse namespace/name:version
-			namespace, name, version := parsePkgSpec(pkgSpec)
+With --typst, only packages with at least one version that compiles with the
+given Typst version are listed, along with the newest such version. Without
+the flag, the typstVersion from the config or the version of the installed
+typst binary is used if known; pass --typst any to list all packages.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := args[0]
 
-			if version == "" {
-				// Get latest version first
-				pkg, err := api.FetchPackage(namespace, name)
+			if !cmd.Flags().Changed("typst") {
+				cfg, err := config.Load()
 				if err != nil {
 					return err
 				}
-				if len(pkg.Versions) == 0 {
-					return fmt.Errorf("no versions available for package")
-				}
-				version = pkg.Versions[len(pkg.Versions)-1].Version
+				typst = localTypstVersion(cfg)
+			} else if typst == "any" {
+				typst = ""
+			} else if _, err := version.Compare(typst, typst); err != nil {
+				return fmt.Errorf("invalid Typst version %q: %w", typst, err)
 			}
 
-			cfg, err := config.Load()
+			result, err := api.SearchPackages(query, namespace, typst, limit)
 			if err != nil {
-				return err
+				errorf("failed to search packages: %v\n", err)
+				return nil
 			}
-			cacheDir := cfg.TypstCachePkgPath
-			if cacheDir == "" {
-				return fmt.Errorf("typst cache directory not configured")
+
+			if typst == "" {
+				fmt.Printf("Found %d results for '%s':\n\n", result.Count, query)
+				for _, r := range result.Results {
+					fmt.Printf("@%s/%s - %s\n", r.Namespace, r.Name, r.Description)
+				}
+				return nil
 			}
 
-			fmt.Printf("Resolving @%s/%s:%s...\n", namespace, name, version)
-			visited := make(map[string]bool)
-			if err := fetchWithDeps(namespace, name, version, cacheDir, visited, noDeps); err != nil {
-				return err
+			specs := make([]string, len(result.Results))
+			for i, r := range result.Results {
+				specs[i] = fmt.Sprintf("@%s/%s", r.Namespace, r.Name)
+			}
+			fetched, err := api.BatchFetchPackages(specs)
+			if err != nil {
+				warnf("some packages could not be checked: %v\n", err)
+			}
+
+			lines, unknown := compatibleResults(result.Results, fetched, typst)
+			if unknown > 0 {
+				fmt.Printf("Found %d results for '%s' compatible with Typst %s, %d of unknown compatibility:\n\n", len(lines)-unknown, query, typst, unknown)
+			} else {
+				fmt.Printf("Found %d results for '%s' compatible with Typst %s:\n\n", len(lines), query, typst)
+			}
+			for _, line := range lines {
+				fmt.Println(line)
 			}
 
-			fmt.Printf("Done. %d package(s) resolved.\n", len(visited))
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVar(&noDeps, "no-deps", false, "Skip fetching transitive dependencies")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Filter by namespace")
+	cmd.Flags().IntVarP(&limit, "limit", "l", 20, "Limit number of results")
+	cmd.Flags().StringVar(&typst, "typst", "", "Only list packages compatible with this Typst version (default: the installed version, \"any\" for all)")
 
 	return cmd
 }
 
-// pullCmd scans the current project for .typ imports and fetches all dependencies.
-func pullCmd() *cobra.Command {
-	var dryRun bool
+// publishedPackage is a package published by the current user.
+type publishedPackage struct {
+	Package   string     `json:"package"`
+	Latest    string     `json:"latest"`
+	Published *time.Time `json:"published,omitempty"`
+}
 
+// publishedPackages summarizes pkgs with the latest version of each, sorted
+// by package name.
+func publishedPackages(pkgs []api.PackageResponse) []publishedPackage {
+	result := make([]publishedPackage, 0, len(pkgs))
+	for i := range pkgs {
+		pkg := &pkgs[i]
+		p := publishedPackage{
+			Package: fmt.Sprintf("@%s/%s", pkg.Namespace, pkg.Name),
+			Latest:  latestVersion(pkg),
+		}
+		if p.Latest == pkg.LatestVersion.Version {
+			p.Published = pkg.LatestVersion.PublishedAt
+		} else if v, err := findVersion(pkg, p.Latest); err == nil {
+			p.Published = v.PublishedAt
+		}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Package < result[j].Package
+	})
+	return result
+}
+
+// myCmd groups the commands about the logged in user.
+func myCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "pull",
-		Short: "Fetch all package dependencies for the current project",
-		Long: `Scan the current directory recursively for .typ files, discover all
-#import "@namespace/name:version" references, and download each package
-along with its transitive dependencies.
+		Use:   "my",
+		Short: "Show what belongs to the logged in user",
+	}
+
+	cmd.AddCommand(myPackagesCmd())
+
+	return cmd
+}
+
+// myPackagesCmd lists the packages published by the logged in user.
+func myPackagesCmd() *cobra.Command {
+	var namespace string
+	var as string
+	var jsonOutput bool
 
-Use --dry-run to see what would be fetched without downloading anything.`,
+	cmd := &cobra.Command{
+		Use:   "packages",
+		Short: "List the packages you have published",
+		Long: `List the packages published by the logged in user with the latest version of
+each and when it was published. Use --namespace to only list the packages
+in one namespace.`,
 		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := useProfile(as, namespace); err != nil {
+				return err
+			}
+
 			cfg, err := config.Load()
 			if err != nil {
 				return err
 			}
-			cacheDir := cfg.TypstCachePkgPath
-			if cacheDir == "" {
-				return fmt.Errorf("typst cache directory not configured")
+			if cfg.AccessToken == "" {
+				return fmt.Errorf("not logged in. Please run 'tpix login' first")
 			}
 
-			// Scan current directory for .typ imports
-			cwd, err := os.Getwd()
-			if err != nil {
-				return fmt.Errorf("failed to get working directory: %w", err)
+			pkgs, err := api.MyPackages(namespace)
+			if errors.Is(err, api.ErrInvalidToken) {
+				return fmt.Errorf("%w, please run 'tpix login' again", err)
 			}
-
-			fmt.Printf("Scanning %s for package imports...\n", cwd)
-			discovered, err := deps.ExtractFromDirectory(cwd)
 			if err != nil {
-				return fmt.Errorf("failed to scan for imports: %w", err)
+				return err
 			}
+			published := publishedPackages(pkgs)
 
-			if len(discovered) == 0 {
-				fmt.Println("No package imports found.")
-				return nil
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(published)
 			}
 
-			fmt.Printf("Found %d direct dependency(ies).\n", len(discovered))
-
-			if dryRun {
-				for _, dep := range discovered {
-					cached := isPackageCached(cacheDir, dep.Namespace, dep.Name, dep.Version)
-					status := "missing"
-					if cached {
-						status = "cached"
-					}
-					fmt.Printf("  %s [%s]\n", dep.Key(), status)
-				}
+			if len(published) == 0 {
+				fmt.Println("No published packages.")
 				return nil
 			}
 
-			visited := make(map[string]bool)
-			for _, dep := range discovered {
-				if err := fetchWithDeps(dep.Namespace, dep.Name, dep.Version, cacheDir, visited, false); err != nil {
-					return err
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PACKAGE\tLATEST\tPUBLISHED")
+			for _, p := range published {
+				date := "unknown"
+				if p.Published != nil {
+					date = p.Published.Format(time.DateOnly)
 				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", p.Package, p.Latest, date)
 			}
-
-			fmt.Printf("Done. %d package(s) resolved.\n", len(visited))
-			return nil
+			return w.Flush()
 		},
 	}
 
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be fetched without downloading")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Only list packages in this namespace")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as JSON")
+	addProfileFlag(cmd, &as)
 
 	return cmd
 }
 
-// listCachedCmd lists locally cached/downloaded packages.
-func listCachedCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "list",
-		Short: "List locally cached packages",
-		Long:  "List all packages downloaded and cached in the local package cache",
-		Args:  cobra.ExactArgs(0),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load()
-			if err != nil {
-				return err
-			}
-
-			cacheDir := cfg.TypstCachePkgPath
-			if cacheDir == "" {
-				return fmt.Errorf("typst cache directory not configured")
-			}
-
-			entries, err := os.ReadDir(cacheDir)
-			if err != nil {
-				return fmt.Errorf("failed to read cache directory: %w", err)
-			}
+// printResolveEvent prints the per-package progress of a resolver.
+func printResolveEvent(e resolver.Event) {
+	switch e.Kind {
+	case resolver.PackageCached:
+		progressf("  Already cached: %s\n", e.Package.Key())
+	case resolver.PackageStarted:
+		progressf("  Downloading %s...\n", e.Package.Key())
+	case resolver.PackageCompleted:
+		debugf("  Extracted %s\n", e.Package.Key())
+	case resolver.PackageMissing:
+		progressf("  Would download %s\n", e.Package.Key())
+	case resolver.PackageSkipped:
+		progressf("  Skipped (%s): %s\n", e.Reason, e.Package.Key())
+	case resolver.PackageFailed:
+		warnf("failed to download %s, continuing: %v\n", e.Package.Key(), e.Err)
+	}
+}
 
-			var count int
-			fmt.Printf("Cached packages in %s:\n\n", cacheDir)
+// printDownloadSummary lists the packages r resolved and those that failed
+// to download, for pull --continue-on-error.
+func printDownloadSummary(r *resolver.Resolver, downloadErr *resolver.DownloadError) {
+	failed := make(map[string]bool)
+	for _, f := range downloadErr.Failed {
+		failed[f.Package.Key()] = true
+	}
 
-			for _, namespace := range entries {
-				if !namespace.IsDir() {
-					continue
-				}
-				namespacePath := filepath.Join(cacheDir, namespace.Name())
-				pkgs, err := os.ReadDir(namespacePath)
-				if err != nil {
-					continue
-				}
-				for _, pkg := range pkgs {
-					if !pkg.IsDir() {
-						continue
-					}
-					pkgPath := filepath.Join(namespacePath, pkg.Name())
-					versions, err := os.ReadDir(pkgPath)
-					if err != nil {
-						continue
-					}
-					for _, version := range versions {
-						if !version.IsDir() {
-							continue
-						}
-						count++
-						fmt.Printf("@%s/%s:%s\n", namespace.Name(), pkg.Name(), version.Name())
-					}
-				}
-			}
+	pkgs := r.Packages()
+	summaryf("Done. %d package(s) resolved, %d failed.\n", len(pkgs)-len(failed), len(failed))
+	summaryf("\nSucceeded:\n")
+	for _, pkg := range pkgs {
+		if !failed[pkg.Key()] {
+			summaryf("  %s\n", pkg.Key())
+		}
+	}
+	summaryf("\nFailed:\n")
+	for _, f := range downloadErr.Failed {
+		summaryf("  %s: %v\n", f.Package.Key(), f.Err)
+	}
+}
 
-			fmt.Printf("\nTotal: %d packages\n", count)
+// printResolvedSet prints the effective version of every package in the
+// resolved graph, along with other versions requested along the way.
+func printResolvedSet(r *resolver.Resolver) {
+	summaryf("\nResolved packages:\n")
+	for _, pkg := range r.Resolved() {
+		line := fmt.Sprintf("  @%s/%s:%s", pkg.Namespace, pkg.Name, pkg.Version)
+		if len(pkg.Requested) > 1 {
+			line += fmt.Sprintf(" (requested: %s)", strings.Join(pkg.Requested, ", "))
+		}
+		summaryf("%s\n", line)
+	}
+}
 
-			return nil
-		},
+// checkConflicts warns about the packages r resolved at more than one
+// version. With fail set, they are an error instead.
+func checkConflicts(r *resolver.Resolver, fail bool) error {
+	conflicts := r.Conflicts()
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if fail {
+		return &resolver.ConflictError{Conflicts: conflicts}
 	}
+	for _, c := range conflicts {
+		warnf("%s\n", c)
+	}
+	return nil
+}
 
-	return cmd
+// licenseOptions controls how get and pull handle packages that are not
+// allowed by the configured license policy.
+type licenseOptions struct {
+	strict bool
+	accept bool
 }
 
-// removeCachedCmd removes a cached package.
-func removeCachedCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "remove <namespace/name:version>",
-		Short: "Remove a cached package",
-		Long:  "Remove a locally cached package from the cache directory",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			pkgSpec := args[0]
-			namespace, name, version := parsePkgSpec(pkgSpec)
+func (o *licenseOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.strict, "strict", false, "Fail instead of prompting when a package license is not allowed")
+	cmd.Flags().BoolVar(&o.accept, "accept-license", false, "Install packages even if their license is not allowed")
+}
 
-			if namespace == "" || name == "" || version == "" {
-				return fmt.Errorf("invalid package spec: use format @namespace/name:version")
-			}
+// apply sets up r to enforce the license policy from cfg, if any.
+func (o *licenseOptions) apply(r *resolver.Resolver, cfg config.Config) {
+	if cfg.Licenses == nil {
+		return
+	}
 
-			cfg, err := config.Load()
+	r.LicensePolicy = &resolver.LicensePolicy{Allow: cfg.Licenses.Allow, Deny: cfg.Licenses.Deny}
+	r.ConfirmLicense = func(pkg deps.Dependency, license string, verdict resolver.LicenseVerdict) bool {
+		if license == "" {
+			license = "no declared license"
+		}
+		fmt.Printf("  %s: %s (%s by license policy)\n", pkg.Key(), license, verdict)
+
+		if o.accept {
+			return true
+		}
+		if o.strict {
+			return false
+		}
+		return confirm("  Install anyway?")
+	}
+}
+
+// confirm asks the user a yes/no question. It returns false without asking
+// if stdin is not a terminal.
+func confirm(prompt string) bool {
+	if !stdinIsTerminal() {
+		return false
+	}
+
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// stdinIsTerminal reports whether the user can answer prompts.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// archivePath returns where get --archive saves the archive of a package.
+// If dest is a directory, or ends with a path separator, the archive is
+// named name-version.tar.gz inside it.
+func archivePath(dest, name, version string) (string, error) {
+	isDir := strings.HasSuffix(dest, "/") || strings.HasSuffix(dest, string(filepath.Separator))
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		isDir = true
+	}
+	if !isDir {
+		return dest, nil
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return filepath.Join(dest, fmt.Sprintf("%s-%s.tar.gz", name, version)), nil
+}
+
+// saveArchives saves the archive of pkg as described for archivePath and,
+// with withDeps, those of its transitive dependencies in the same
+// directory, without installing anything.
+func saveArchives(ctx context.Context, pkg deps.Dependency, dest string, withDeps bool) error {
+	pkgs := []deps.Dependency{pkg}
+	if withDeps {
+		// Several archives can only be saved to a directory
+		dest = strings.TrimRight(dest, `/\`) + string(filepath.Separator)
+		g, err := resolver.FetchGraph(pkg)
+		if err != nil {
+			return err
+		}
+		pkgs = g.Packages
+	}
+
+	for _, p := range pkgs {
+		path, err := archivePath(dest, p.Name, p.Version)
+		if err != nil {
+			return err
+		}
+		progressf("Downloading %s...\n", p.Key())
+		if err := api.DownloadArchive(ctx, p.Namespace, p.Name, p.Version, path, nil); err != nil {
+			return fmt.Errorf("failed to download %s: %w", p.Key(), err)
+		}
+		summaryf("Saved archive to %s\n", path)
+	}
+	return nil
+}
+
+// getPkgCmd download Typst packages from TPIX server.
+func getPkgCmd() *cobra.Command {
+	var noDeps bool
+	var showResolved bool
+	var noCacheWrite bool
+	var archive string
+	var noExtract bool
+	var withDeps bool
+	var failOnConflict bool
+	var maxDepth int
+	var as string
+	var licenses licenseOptions
+	var noCompatCheck bool
+
+	cmd := &cobra.Command{
+		Use:   "get <namespace/name:version>",
+		Short: "Download a package from TPIX server",
+		Long: `Download a package and its dependencies from the TPIX server into the
+Typst package cache.
+
+With --archive, the verified .tar.gz archive of the package is saved to the
+given file, or as name-version.tar.gz in the given directory, in addition to
+installing the package.
+
+--no-extract, which requires --archive, only saves the archive: the package
+cache is left untouched and dependencies are not fetched. Add --with-deps to
+save the archives of all transitive dependencies to the --archive directory
+as well.
+
+A warning is printed if the package requires a newer Typst than the one
+installed, or the typstVersion set in the config. Use --no-compat-check to
+skip this check.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgSpec := args[0]
+
+			if noExtract && archive == "" {
+				return fmt.Errorf("--no-extract requires --archive")
+			}
+			if withDeps && !noExtract {
+				return fmt.Errorf("--with-deps requires --no-extract, dependencies are installed by default")
+			}
+
+			// Parse namespace/name:version
+			namespace, name, version, err := parsePkgSpec(pkgSpec)
+			if err != nil {
+				return err
+			}
+
+			if err := useProfile(as, namespace); err != nil {
+				return err
+			}
+
+			if version == "" {
+				// Get latest version first
+				pkg, err := api.FetchPackage(namespace, name)
+				if err != nil {
+					return err
+				}
+				if len(pkg.Versions) == 0 {
+					return fmt.Errorf("no versions available for package")
+				}
+				version = pkg.Versions[len(pkg.Versions)-1].Version
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			if !noCompatCheck {
+				checkTypstCompat(cfg, namespace, name, version)
+			}
+
+			pkg := deps.Dependency{Namespace: namespace, Name: name, Version: version}
+			if noExtract {
+				return saveArchives(cmd.Context(), pkg, archive, withDeps)
+			}
+
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
+				return fmt.Errorf("typst cache directory not configured")
+			}
+
+			debugf("Using package cache %s\n", cacheDir)
+			progressf("Resolving @%s/%s:%s...\n", namespace, name, version)
+			r := resolver.New(cacheDir)
+			r.NoDeps = noDeps
+			r.MaxDepth = maxDepth
+			r.ReadOnly = r.ReadOnly || noCacheWrite
+			r.OnEvent = printResolveEvent
+			licenses.apply(r, cfg)
+			if err := r.ResolveContext(cmd.Context(), pkg); err != nil {
+				return err
+			}
+			if err := checkConflicts(r, failOnConflict); err != nil {
+				return err
+			}
+
+			summaryf("Done. %d package(s) resolved.\n", r.Count())
+			if showResolved {
+				printResolvedSet(r)
+			}
+
+			if archive != "" {
+				if err := saveArchives(cmd.Context(), pkg, archive, false); err != nil {
+					return err
+				}
+			}
+
+			// Keep an existing project lock file up to date
+			lockPath := deps.LockFilename
+			if _, err := os.Stat(lockPath); err == nil {
+				return writeLockfile(r, lockPath, true)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noDeps, "no-deps", false, "Skip fetching transitive dependencies")
+	cmd.Flags().BoolVar(&showResolved, "show-resolved", false, "Print the effective version of each resolved package")
+	cmd.Flags().BoolVar(&noCacheWrite, "no-cache-write", false, "Never write to the package cache, only report missing packages")
+	cmd.Flags().StringVar(&archive, "archive", "", "Also save the package archive to this file or directory")
+	cmd.Flags().BoolVar(&noExtract, "no-extract", false, "Only save the archive given with --archive, without installing the package")
+	cmd.Flags().BoolVar(&withDeps, "with-deps", false, "With --no-extract, also save the archives of all dependencies")
+	cmd.Flags().BoolVar(&failOnConflict, "fail-on-conflict", false, "Fail if a package is required at more than one version")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", resolver.DefaultMaxDepth, "Fail if dependencies are nested deeper than this, 0 for no limit")
+	cmd.Flags().BoolVar(&noCompatCheck, "no-compat-check", false, "Do not warn if the package requires a newer Typst version")
+	addSummaryOnlyFlag(cmd)
+	addProfileFlag(cmd, &as)
+	licenses.addFlags(cmd)
+
+	return cmd
+}
+
+// writeLockfile records the packages resolved by r in the lock file at
+// path. With merge set, the entries are added to an existing lock file
+// instead of replacing it.
+func writeLockfile(r *resolver.Resolver, path string, merge bool) error {
+	entries, err := r.Lock()
+	if err != nil {
+		return err
+	}
+
+	lock := deps.NewLockfile(nil)
+	if merge {
+		if existing, err := deps.ReadLockfile(path); err == nil {
+			lock = existing
+		}
+	}
+	lock.Merge(entries)
+
+	if err := lock.Write(path); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	summaryf("Wrote %s\n", path)
+	return nil
+}
+
+// scanOptions holds the flags that select which files of a project are
+// scanned for imports.
+type scanOptions struct {
+	extensions []string
+	include    []string
+	exclude    []string
+}
+
+func (o *scanOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&o.extensions, "ext", nil, "File extensions to scan for imports (default .typ)")
+	cmd.Flags().StringSliceVar(&o.include, "include", nil, "Only scan these directories")
+	cmd.Flags().StringSliceVar(&o.exclude, "exclude", nil, "Do not scan these directories")
+}
+
+// options returns the scan options selected by the flags. The packages in
+// cacheDir, if not empty, are never scanned, in case the cache is nested in
+// the project.
+func (o *scanOptions) options(cacheDir string) []deps.ScanOption {
+	exclude := slices.Clone(o.exclude)
+	if cacheDir != "" {
+		exclude = append(exclude, cacheDir)
+	}
+
+	opts := []deps.ScanOption{
+		deps.WithInclude(o.include...),
+		deps.WithExclude(exclude...),
+	}
+	if len(o.extensions) > 0 {
+		opts = append(opts, deps.WithExtensions(o.extensions...))
+	}
+	return opts
+}
+
+// pullCmd scans the current project for .typ imports and fetches all dependencies.
+func pullCmd() *cobra.Command {
+	var dryRun bool
+	var noCacheWrite bool
+	var watch bool
+	var noPreview bool
+	var failOnConflict bool
+	var maxDepth int
+	var continueOnError bool
+	var scan scanOptions
+	var licenses licenseOptions
+
+	cmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Fetch all package dependencies for the current project",
+		Long: `Scan the current directory recursively for .typ files, discover all
+#import "@namespace/name:version" references, and download each package
+along with its transitive dependencies. The resolved packages are pinned in
+tpix.lock, which can be installed elsewhere with 'tpix install'.
+
+Use --dry-run to see what would be fetched without downloading anything.
+With --no-cache-write, or if the cache directory is read-only, packages
+missing from the cache are reported and the command fails instead of
+downloading them.
+
+With --watch, the project keeps being watched after the initial pull, and
+packages imported while editing are fetched as soon as the file is saved.
+
+With --continue-on-error, a package that fails to download does not stop
+the others from being fetched. The packages that succeeded and failed are
+listed at the end, and the command fails if any did.`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
 			if err != nil {
+				return err
+			}
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
 				return fmt.Errorf("typst cache directory not configured")
 			}
 
+			// Scan current directory for .typ imports
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+
+			scanOpts := scan.options(cacheDir)
+
+			debugf("Using package cache %s\n", cacheDir)
+			progressf("Scanning %s for package imports...\n", cwd)
+			discovered, err := deps.ExtractFromDirectory(cwd, scanOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to scan for imports: %w", err)
+			}
+
+			if len(discovered) == 0 && !watch {
+				summaryf("No package imports found.\n")
+				return nil
+			}
+
+			progressf("Found %d direct dependency(ies).\n", len(discovered))
+
+			newResolver := func() *resolver.Resolver {
+				r := resolver.New(cacheDir)
+				r.NoPreview = noPreview
+				r.MaxDepth = maxDepth
+				r.ContinueOnError = continueOnError
+				r.ReadOnly = r.ReadOnly || noCacheWrite
+				licenses.apply(r, cfg)
+				return r
+			}
+
+			if dryRun {
+				r := newResolver()
+				for _, dep := range discovered {
+					status := "missing"
+					if reason := r.SkipReason(dep); reason != "" {
+						status = "skipped (" + reason + ")"
+					} else if resolver.IsCached(cacheDir, dep) {
+						status = "cached"
+					}
+					fmt.Printf("  %s [%s]\n", dep.Key(), status)
+				}
+				return nil
+			}
+			lockPath := filepath.Join(cwd, deps.LockFilename)
+
+			if len(discovered) > 0 {
+				r := newResolver()
+				r.OnEvent = printResolveEvent
+				if err := r.ResolveContext(cmd.Context(), discovered...); err != nil {
+					var downloadErr *resolver.DownloadError
+					if errors.As(err, &downloadErr) {
+						printDownloadSummary(r, downloadErr)
+					}
+					return err
+				}
+				if err := checkConflicts(r, failOnConflict); err != nil {
+					return err
+				}
+
+				summaryf("Done. %d package(s) resolved.\n", r.Count())
+				if err := writeLockfile(r, lockPath, false); err != nil {
+					return err
+				}
+			}
+
+			if !watch {
+				return nil
+			}
+
+			progressf("Watching %s for new imports, press Ctrl+C to stop...\n", cwd)
+			w := newImportWatcher(cwd, discovered, scanOpts, func(added []deps.Dependency) error {
+				r := newResolver()
+				r.OnEvent = func(e resolver.Event) {
+					if e.Kind == resolver.PackageCompleted {
+						summaryf("Fetched %s\n", e.Package.Key())
+					}
+				}
+				if err := r.ResolveContext(cmd.Context(), added...); err != nil {
+					return err
+				}
+				return writeLockfile(r, lockPath, true)
+			})
+			return w.run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be fetched without downloading")
+	cmd.Flags().BoolVar(&noCacheWrite, "no-cache-write", false, "Never write to the package cache, only report missing packages")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Keep watching the project and fetch newly imported packages")
+	cmd.Flags().BoolVar(&noPreview, "no-preview", false, "Skip packages of the @preview namespace")
+	cmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep fetching the other packages when one fails to download")
+	cmd.Flags().BoolVar(&failOnConflict, "fail-on-conflict", false, "Fail if a package is required at more than one version")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", resolver.DefaultMaxDepth, "Fail if dependencies are nested deeper than this, 0 for no limit")
+	scan.addFlags(cmd)
+	addSummaryOnlyFlag(cmd)
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "watch")
+	licenses.addFlags(cmd)
+
+	return cmd
+}
+
+// installCmd installs the packages pinned in the project's lock file.
+func installCmd() *cobra.Command {
+	var frozen bool
+	var scan scanOptions
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the exact package versions pinned in tpix.lock",
+		Long: `Install every package pinned in the tpix.lock file of the current directory,
+verifying each download against the locked checksum, so that different
+machines end up with identical caches.
+
+If the lock file is missing or does not cover all imports of the project, the
+dependencies are resolved as with 'tpix pull' and the lock file is rewritten.
+With --frozen, a missing or stale lock file is an error instead.`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
 			cacheDir := cfg.TypstCachePkgPath
 			if cacheDir == "" {
 				return fmt.Errorf("typst cache directory not configured")
 			}
 
-			pkgDir := filepath.Join(cacheDir, namespace, name, version)
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
 
-			// Check if the package exists
-			info, err := os.Stat(pkgDir)
+			discovered, err := deps.ExtractFromDirectory(cwd, scan.options(cacheDir)...)
 			if err != nil {
-				if os.IsNotExist(err) {
-					return fmt.Errorf("package @%s/%s:%s not found in cache", namespace, name, version)
+				return fmt.Errorf("failed to scan for imports: %w", err)
+			}
+
+			lockPath := filepath.Join(cwd, deps.LockFilename)
+			lock, err := deps.ReadLockfile(lockPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			// @local packages are never resolved, so never pinned
+			stale := lock == nil || !lock.Covers(withoutLocal(discovered))
+
+			r := resolver.New(cacheDir)
+			r.OnEvent = printResolveEvent
+
+			if stale {
+				if frozen {
+					if lock == nil {
+						return fmt.Errorf("%s not found; run 'tpix pull' to create it", deps.LockFilename)
+					}
+					return fmt.Errorf("%s is out of date; run 'tpix pull' to update it", deps.LockFilename)
 				}
-				return fmt.Errorf("failed to check package: %v", err)
+
+				progressf("%s is missing or out of date, resolving dependencies...\n", deps.LockFilename)
+				if err := r.ResolveContext(cmd.Context(), discovered...); err != nil {
+					return err
+				}
+				summaryf("Done. %d package(s) resolved.\n", r.Count())
+				return writeLockfile(r, lockPath, false)
 			}
-			if !info.IsDir() {
-				return fmt.Errorf("package @%s/%s:%s is not a directory", namespace, name, version)
+
+			progressf("Installing %d locked package(s)...\n", len(lock.Packages))
+			if err := r.InstallContext(cmd.Context(), lock.Packages); err != nil {
+				return err
 			}
 
-			if err := os.RemoveAll(pkgDir); err != nil {
-				return fmt.Errorf("failed to remove package: %v", err)
+			summaryf("Done. %d package(s) installed.\n", r.Count())
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&frozen, "frozen", false, "Fail if tpix.lock is missing or out of date")
+	scan.addFlags(cmd)
+
+	return cmd
+}
+
+// dependencyStatus is a project dependency and whether it is in the cache.
+// @local packages are installed by the user rather than cached, and are
+// never missing.
+type dependencyStatus struct {
+	Package string `json:"package"`
+	Cached  bool   `json:"cached"`
+	Local   bool   `json:"local,omitempty"`
+}
+
+// state returns "cached", "local" or "missing".
+func (s dependencyStatus) state() string {
+	switch {
+	case s.Local:
+		return "local"
+	case s.Cached:
+		return "cached"
+	}
+	return "missing"
+}
+
+// dependencyStatuses checks which of pkgs are in cacheDir.
+func dependencyStatuses(pkgs []deps.Dependency, cacheDir string) []dependencyStatus {
+	statuses := make([]dependencyStatus, 0, len(pkgs))
+	for _, dep := range pkgs {
+		local := dep.Namespace == resolver.LocalNamespace
+		statuses = append(statuses, dependencyStatus{
+			Package: dep.Key(),
+			Cached:  !local && resolver.IsCached(cacheDir, dep),
+			Local:   local,
+		})
+	}
+	return statuses
+}
+
+// withoutLocal returns pkgs without the @local packages, which the resolver
+// skips as they are never published.
+func withoutLocal(pkgs []deps.Dependency) []deps.Dependency {
+	return slices.DeleteFunc(slices.Clone(pkgs), func(dep deps.Dependency) bool {
+		return dep.Namespace == resolver.LocalNamespace
+	})
+}
+
+// projectStatus summarizes the state of a project, the cache and the login.
+type projectStatus struct {
+	Project      string             `json:"project"`
+	Dependencies []dependencyStatus `json:"dependencies"`
+	// Lockfile is "missing", "current" or "out of date".
+	Lockfile string `json:"lockfile"`
+	LoggedIn bool   `json:"loggedIn"`
+	Server   string `json:"server"`
+	CacheDir string `json:"cacheDir"`
+}
+
+// getProjectStatus collects the status of the project in projectDir, scanned
+// for imports with scanOpts.
+func getProjectStatus(projectDir string, cfg config.Config, scanOpts ...deps.ScanOption) (*projectStatus, error) {
+	discovered, err := deps.ExtractFromDirectory(projectDir, scanOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for imports: %w", err)
+	}
+
+	status := &projectStatus{
+		Project:      projectDir,
+		Dependencies: dependencyStatuses(discovered, cfg.TypstCachePkgPath),
+		Lockfile:     "missing",
+		LoggedIn:     cfg.AccessToken != "",
+		Server:       api.ServerURL(),
+		CacheDir:     cfg.TypstCachePkgPath,
+	}
+
+	lock, err := deps.ReadLockfile(filepath.Join(projectDir, deps.LockFilename))
+	switch {
+	case err == nil && lock.Covers(withoutLocal(discovered)):
+		status.Lockfile = "current"
+	case err == nil:
+		status.Lockfile = "out of date"
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// statusCmd prints an overview of the current project, the cache and the login.
+func statusCmd() *cobra.Command {
+	var jsonOutput bool
+	var scan scanOptions
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the dependency, lock file and login status of the project",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+
+			status, err := getProjectStatus(cwd, cfg, scan.options(cfg.TypstCachePkgPath)...)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(status)
+			}
+
+			fmt.Printf("Project: %s\n", status.Project)
+			fmt.Printf("Server: %s\n", status.Server)
+			fmt.Printf("Cache: %s\n", status.CacheDir)
+			if status.LoggedIn {
+				fmt.Println("Login: logged in")
+			} else {
+				fmt.Println("Login: not logged in")
+			}
+			fmt.Printf("Lock file: %s\n", status.Lockfile)
+
+			missing := 0
+			fmt.Printf("\nDependencies (%d):\n", len(status.Dependencies))
+			for _, dep := range status.Dependencies {
+				state := dep.state()
+				if state == "missing" {
+					missing++
+				}
+				fmt.Printf("  %s [%s]\n", dep.Package, state)
+			}
+			if missing > 0 {
+				fmt.Printf("\n%d dependency(ies) missing, run 'tpix pull' to fetch them.\n", missing)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the status as JSON")
+	scan.addFlags(cmd)
+
+	return cmd
+}
+
+// projectDependencies lists the direct dependencies of a project.
+type projectDependencies struct {
+	Project      string             `json:"project"`
+	Dependencies []dependencyStatus `json:"dependencies"`
+	Total        int                `json:"total"`
+	Cached       int                `json:"cached"`
+	Missing      int                `json:"missing"`
+}
+
+// getProjectDependencies scans projectDir for imports with scanOpts, sorted
+// by package, and checks which are in cacheDir.
+func getProjectDependencies(projectDir, cacheDir string, scanOpts ...deps.ScanOption) (*projectDependencies, error) {
+	discovered, err := deps.ExtractFromDirectory(projectDir, scanOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for imports: %w", err)
+	}
+	sort.Slice(discovered, func(i, j int) bool {
+		return discovered[i].Key() < discovered[j].Key()
+	})
+
+	result := &projectDependencies{
+		Project:      projectDir,
+		Dependencies: dependencyStatuses(discovered, cacheDir),
+		Total:        len(discovered),
+	}
+	for _, dep := range result.Dependencies {
+		switch dep.state() {
+		case "cached":
+			result.Cached++
+		case "missing":
+			result.Missing++
+		}
+	}
+	return result, nil
+}
+
+// depsCmd prints the packages imported by a project.
+func depsCmd() *cobra.Command {
+	var jsonOutput bool
+	var scan scanOptions
+
+	cmd := &cobra.Command{
+		Use:   "deps [path]",
+		Short: "List the direct dependencies of a project",
+		Long: `Scan a project directory, the current one by default, for package imports
+and print each imported package with whether it is in the cache. Nothing is
+downloaded, use 'tpix pull' for that.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			projectDir := "."
+			if len(args) == 1 {
+				projectDir = args[0]
+			}
+			projectDir, err = filepath.Abs(projectDir)
+			if err != nil {
+				return err
+			}
+
+			result, err := getProjectDependencies(projectDir, cfg.TypstCachePkgPath, scan.options(cfg.TypstCachePkgPath)...)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(result)
+			}
+
+			for _, dep := range result.Dependencies {
+				fmt.Printf("%s [%s]\n", dep.Package, dep.state())
+			}
+			summaryf("\n%d dependency(ies), %d cached, %d missing\n", result.Total, result.Cached, result.Missing)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the dependencies as JSON")
+	scan.addFlags(cmd)
+
+	return cmd
+}
+
+// cachedPackages returns every package version in the cache directory.
+func cachedPackages(cacheDir string) ([]deps.Dependency, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var cached []deps.Dependency
+	for _, namespace := range entries {
+		if !namespace.IsDir() {
+			continue
+		}
+		namespacePath := filepath.Join(cacheDir, namespace.Name())
+		pkgs, err := os.ReadDir(namespacePath)
+		if err != nil {
+			continue
+		}
+		for _, pkg := range pkgs {
+			if !pkg.IsDir() {
+				continue
+			}
+			pkgPath := filepath.Join(namespacePath, pkg.Name())
+			versions, err := os.ReadDir(pkgPath)
+			if err != nil {
+				continue
+			}
+			for _, version := range versions {
+				// Hidden directories are extractions in progress
+				if !version.IsDir() || strings.HasPrefix(version.Name(), ".") {
+					continue
+				}
+				cached = append(cached, deps.Dependency{
+					Namespace: namespace.Name(),
+					Name:      pkg.Name(),
+					Version:   version.Name(),
+				})
+			}
+		}
+	}
+
+	return cached, nil
+}
+
+// packageFilter selects packages by namespace, name and version. Each part
+// is a path.Match pattern, an empty part matches everything.
+type packageFilter struct {
+	namespace string
+	name      string
+	version   string
+}
+
+// newPackageFilter builds the filter of list from its optional argument and
+// --namespace. The argument is a namespace, or a package spec such as
+// @preview/cetz or "@preview/*". With --namespace, an argument without a
+// namespace is a package name.
+func newPackageFilter(arg, namespace string) (packageFilter, error) {
+	f := packageFilter{namespace: namespace}
+	switch {
+	case arg == "":
+	case strings.HasPrefix(arg, "@") || strings.Contains(arg, "/"):
+		ns, name, version, err := parsePkgSpec(arg)
+		if err != nil {
+			return f, fmt.Errorf("invalid package filter %q: use a namespace or @namespace/name[:version]", arg)
+		}
+		if namespace != "" && namespace != ns {
+			return f, fmt.Errorf("package filter %q does not match --namespace %s", arg, namespace)
+		}
+		f = packageFilter{namespace: ns, name: name, version: version}
+	case namespace != "":
+		f.name = arg
+	default:
+		f.namespace = arg
+	}
+
+	for _, pattern := range []string{f.namespace, f.name, f.version} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return f, fmt.Errorf("invalid package filter %q: %w", pattern, err)
+		}
+	}
+	return f, nil
+}
+
+// match reports whether pkg is selected by the filter.
+func (f packageFilter) match(pkg deps.Dependency) bool {
+	return matchPattern(f.namespace, pkg.Namespace) &&
+		matchPattern(f.name, pkg.Name) &&
+		matchPattern(f.version, pkg.Version)
+}
+
+func matchPattern(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, s)
+	return matched
+}
+
+// cachedPackage is a package version in the cache, with its size on disk
+// if requested.
+type cachedPackage struct {
+	deps.Dependency
+	size int64
+}
+
+// listCachedPackages returns the cached packages selected by filter. With
+// sizes, the size of each version directory is computed as well.
+func listCachedPackages(cacheDir string, filter packageFilter, sizes bool) ([]cachedPackage, error) {
+	cached, err := cachedPackages(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []cachedPackage
+	for _, pkg := range cached {
+		if !filter.match(pkg) {
+			continue
+		}
+		entry := cachedPackage{Dependency: pkg}
+		if sizes {
+			dir := filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version)
+			if entry.size, err = utils.DirSize(dir); err != nil {
+				return nil, fmt.Errorf("failed to compute size of %s: %w", pkg.Key(), err)
+			}
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// readCachedManifest reads the [package] section of the typst.toml of a
+// cached package in dir.
+func readCachedManifest(dir string) (*bundler.Package, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "typst.toml"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest bundler.Manifest
+	if err := bundler.DecodeBytes(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Package == nil {
+		return nil, fmt.Errorf("missing [package] section")
+	}
+	return manifest.Package, nil
+}
+
+// manifestColumns returns the license and description of the cached
+// package in dir as tab separated columns for list --long.
+func manifestColumns(dir string) string {
+	pkg, err := readCachedManifest(dir)
+	if err != nil {
+		return "(no manifest)\t"
+	}
+	license := pkg.License
+	if license == "" {
+		license = "-"
+	}
+	return license + "\t" + pkg.Description
+}
+
+// listCachedCmd lists locally cached/downloaded packages.
+func listCachedCmd() *cobra.Command {
+	var namespace string
+	var showSize bool
+	var sortBy string
+	var long bool
+
+	cmd := &cobra.Command{
+		Use:   "list [namespace | @namespace/name[:version]]",
+		Short: "List locally cached packages",
+		Long: `List the packages downloaded and cached in the local package cache.
+
+The packages can be filtered by namespace, name and version, each of which may
+contain glob patterns, e.g. "tpix list preview" or "tpix list '@preview/ce*'".
+
+With --size, the disk space used by each package version and in total is
+shown. Use --sort size to list the largest packages first.
+
+With --long, the license and description from the typst.toml of each package
+are shown as well. Nothing is fetched from the server.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch sortBy {
+			case "name":
+			case "size":
+				showSize = true
+			default:
+				return fmt.Errorf("invalid sort order %q, expected name or size", sortBy)
+			}
+
+			var arg string
+			if len(args) == 1 {
+				arg = args[0]
+			}
+			filter, err := newPackageFilter(arg, namespace)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
+				return fmt.Errorf("typst cache directory not configured")
+			}
+
+			cached, err := listCachedPackages(cacheDir, filter, showSize)
+			if err != nil {
+				return err
+			}
+			if sortBy == "size" {
+				sort.SliceStable(cached, func(i, j int) bool {
+					return cached[i].size > cached[j].size
+				})
+			}
+
+			fmt.Printf("Cached packages in %s:\n\n", cacheDir)
+			if !showSize && !long {
+				for _, pkg := range cached {
+					fmt.Println(pkg.Key())
+				}
+				fmt.Printf("\nTotal: %d packages\n", len(cached))
+				return nil
+			}
+
+			var total int64
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, pkg := range cached {
+				fmt.Fprint(w, pkg.Key())
+				if showSize {
+					fmt.Fprintf(w, "\t%s", utils.FormatSize(pkg.size))
+					total += pkg.size
+				}
+				if long {
+					fmt.Fprintf(w, "\t%s", manifestColumns(filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version)))
+				}
+				fmt.Fprintln(w)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if !showSize {
+				fmt.Printf("\nTotal: %d packages\n", len(cached))
+				return nil
+			}
+			fmt.Printf("\nTotal: %d packages, %s\n", len(cached), utils.FormatSize(total))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Only list packages in this namespace")
+	cmd.Flags().BoolVar(&showSize, "size", false, "Show the disk space used by each package")
+	cmd.Flags().StringVar(&sortBy, "sort", "name", "Sort order: name or size (largest first, implies --size)")
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "Show the license and description of each package")
+
+	return cmd
+}
+
+// outdatedPackage is a dependency for which a newer version is published.
+type outdatedPackage struct {
+	Package string `json:"package"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+}
+
+// latestVersion returns the highest version published for pkg.
+func latestVersion(pkg *api.PackageResponse) string {
+	latest := pkg.LatestVersion.Version
+	for _, v := range pkg.Versions {
+		if latest == "" {
+			latest = v.Version
+			continue
+		}
+		if c, err := version.Compare(v.Version, latest); err == nil && c > 0 {
+			latest = v.Version
+		}
+	}
+	return latest
+}
+
+// findOutdated checks each package against the versions published on the
+// TPIX server. Packages that cannot be checked are reported with "unknown"
+// as the latest version.
+func findOutdated(pkgs []deps.Dependency) []outdatedPackage {
+	// @local packages are not published on the server
+	pkgs = withoutLocal(pkgs)
+
+	specs := make([]string, len(pkgs))
+	for i, dep := range pkgs {
+		specs[i] = dep.Package()
+	}
+	// Packages that cannot be fetched are missing from the result
+	fetched, _ := api.BatchFetchPackages(specs)
+
+	var outdated []outdatedPackage
+	for _, dep := range pkgs {
+		latest := "unknown"
+		if pkg, ok := fetched[dep.Package()]; ok {
+			if v := latestVersion(pkg); v != "" {
+				latest = v
+			}
+		}
+
+		if latest != "unknown" {
+			if c, err := version.Compare(latest, dep.Version); err == nil && c <= 0 {
+				continue
+			}
+		}
+
+		outdated = append(outdated, outdatedPackage{
+			Package: dep.Package(),
+			Current: dep.Version,
+			Latest:  latest,
+		})
+	}
+	return outdated
+}
+
+// outdatedCmd lists dependencies for which newer versions are available.
+func outdatedCmd() *cobra.Command {
+	var cached bool
+	var jsonOutput bool
+	var scan scanOptions
+
+	cmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "List dependencies with newer versions available",
+		Long: `Check the package imports of the current project for newer versions on the
+TPIX server. With --cached, the packages in the local cache are checked
+instead.
+
+Packages that cannot be looked up are reported with "unknown" as the latest
+version.`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var pkgs []deps.Dependency
+			if cached {
+				cfg, err := config.Load()
+				if err != nil {
+					return err
+				}
+				cacheDir := cfg.TypstCachePkgPath
+				if cacheDir == "" {
+					return fmt.Errorf("typst cache directory not configured")
+				}
+
+				pkgs, err = cachedPackages(cacheDir)
+				if err != nil {
+					return err
+				}
+			} else {
+				cwd, err := os.Getwd()
+				if err != nil {
+					return fmt.Errorf("failed to get working directory: %w", err)
+				}
+
+				cfg, err := config.Load()
+				if err != nil {
+					return err
+				}
+				pkgs, err = deps.ExtractFromDirectory(cwd, scan.options(cfg.TypstCachePkgPath)...)
+				if err != nil {
+					return fmt.Errorf("failed to scan for imports: %w", err)
+				}
+			}
+
+			outdated := findOutdated(pkgs)
+
+			if jsonOutput {
+				if outdated == nil {
+					outdated = []outdatedPackage{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(outdated)
+			}
+
+			if len(outdated) == 0 {
+				fmt.Println("All packages are up to date.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PACKAGE\tCURRENT\tLATEST")
+			for _, pkg := range outdated {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", pkg.Package, pkg.Current, pkg.Latest)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&cached, "cached", false, "Check the packages in the local cache instead of the project")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as JSON")
+	scan.addFlags(cmd)
+
+	return cmd
+}
+
+// defaultExtractDir returns the directory extract unpacks source into if
+// none is given: name-version for a package spec, or the archive name
+// without its extension.
+func defaultExtractDir(source string) string {
+	if strings.HasPrefix(source, "@") {
+		// An invalid spec is reported when extracting
+		_, name, version, _ := parsePkgSpec(source)
+		return name + "-" + version
+	}
+	base := filepath.Base(source)
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if strings.HasSuffix(base, ext) {
+			return strings.TrimSuffix(base, ext)
+		}
+	}
+	return base + ".extracted"
+}
+
+// prepareExtractDir makes sure dest can be extracted into: it must not
+// exist or be an empty directory, unless force is set, in which case it is
+// removed. A file system root or a directory containing the current or home
+// directory is never removed.
+func prepareExtractDir(dest string, force bool) error {
+	entries, err := os.ReadDir(dest)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && len(entries) == 0 {
+		return nil
+	}
+	if !force {
+		if err == nil {
+			return fmt.Errorf("%s is not empty, pass --force to replace it", dest)
+		}
+		return fmt.Errorf("%s already exists, pass --force to replace it", dest)
+	}
+
+	reason, err := protectedDirReason(dest, true)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("refusing to replace %s: %s", dest, reason)
+	}
+	return os.RemoveAll(dest)
+}
+
+// fillEmptyDir runs extract on a new directory inside the existing, empty
+// directory dest and moves what it created into dest. dest itself is kept,
+// as it may be the current directory.
+func fillEmptyDir(dest string, extract func(dir string) error) error {
+	tmpDir, err := os.MkdirTemp(dest, ".tpix-extract-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dir := filepath.Join(tmpDir, "package")
+	if err := extract(dir); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(dest, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractPackage unpacks source to dest. source is either a local tar.gz
+// archive or a package spec, which is copied from the package cache in
+// cacheDir if it is cached and downloaded otherwise.
+func extractPackage(ctx context.Context, cacheDir, source, dest string) error {
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) == 0 {
+		return fillEmptyDir(dest, func(dir string) error {
+			return extractPackage(ctx, cacheDir, source, dir)
+		})
+	}
+
+	if !strings.HasPrefix(source, "@") {
+		if err := utils.ExtractTarGz(source, dest); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", source, err)
+		}
+		return nil
+	}
+
+	pkg, err := parseExactPkgSpec(source)
+	if err != nil {
+		return err
+	}
+
+	if cacheDir != "" && resolver.IsCached(cacheDir, pkg) {
+		debugf("Copying %s from the package cache\n", pkg.Key())
+		return utils.CopyDir(filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version), dest)
+	}
+
+	tmp, err := os.CreateTemp("", "tpix-extract-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	progressf("Downloading %s...\n", pkg.Key())
+	if err := api.DownloadArchive(ctx, pkg.Namespace, pkg.Name, pkg.Version, tmp.Name(), nil); err != nil {
+		return fmt.Errorf("%s is not in the package cache and could not be downloaded: %w", pkg.Key(), err)
+	}
+	if err := utils.ExtractTarGz(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", pkg.Key(), err)
+	}
+	return nil
+}
+
+// extractCmd unpacks a package into a directory of the working tree.
+func extractCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "extract <@namespace/name:version | package.tar.gz> [directory]",
+		Short: "Unpack a package into a directory",
+		Long: `Unpack the files of a package into a directory, e.g. to read or copy its
+source. The package is either a local .tar.gz archive or a package spec,
+which is copied from the package cache or downloaded if it is not cached.
+
+The directory defaults to name-version for a package spec and to the archive
+name without its extension. It must not exist or be empty, unless --force is
+given to replace it.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source := args[0]
+			dest := defaultExtractDir(source)
+			if len(args) > 1 {
+				dest = args[1]
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			if err := prepareExtractDir(dest, force); err != nil {
+				return err
+			}
+
+			if err := extractPackage(cmd.Context(), cfg.TypstCachePkgPath, source, dest); err != nil {
+				return err
+			}
+
+			summaryf("Extracted %s to %s\n", source, dest)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Replace the directory if it is not empty")
+
+	return cmd
+}
+
+// cachedPackageDir returns the directory of the package given by spec in
+// the package cache, or an error suggesting to download it.
+func cachedPackageDir(cacheDir, spec string) (string, error) {
+	pkg, err := parseExactPkgSpec(spec)
+	if err != nil {
+		return "", err
+	}
+
+	if cacheDir == "" || !resolver.IsCached(cacheDir, pkg) {
+		return "", fmt.Errorf("%s is not cached, run 'tpix get %s' first", pkg.Key(), pkg.Key())
+	}
+	return filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version), nil
+}
+
+// packageFilePath returns the path of file inside pkgDir. Paths leaving the
+// package directory, also through symlinks, are refused.
+func packageFilePath(pkgDir, file string) (string, error) {
+	local := filepath.FromSlash(file)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%s is outside the package", file)
+	}
+
+	root, err := filepath.EvalSymlinks(pkgDir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, local))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s not found in the package", file)
+	}
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside the package", file)
+	}
+	return resolved, nil
+}
+
+// catPackageFile writes the content of file in the cached package spec to w.
+func catPackageFile(w io.Writer, cacheDir, spec, file string) error {
+	pkgDir, err := cachedPackageDir(cacheDir, spec)
+	if err != nil {
+		return err
+	}
+	path, err := packageFilePath(pkgDir, file)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", file)
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// catCmd prints a file of a cached package.
+func catCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cat <@namespace/name:version> [--] <file>",
+		Short: "Print a file of a cached package",
+		Long: `Print a file of a package in the package cache, given by its path inside the
+package, without extracting the package. Use -- before a file name that
+starts with a dash.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			return catPackageFile(os.Stdout, cfg.TypstCachePkgPath, args[0], args[1])
+		},
+	}
+
+	return cmd
+}
+
+// listPackageFiles lists the files of source, a local tar.gz archive or a
+// package spec found in the package cache, sorted by path.
+func listPackageFiles(cacheDir, source string) ([]bundler.ArchiveEntry, error) {
+	if !strings.HasPrefix(source, "@") {
+		info, err := bundler.InspectArchive(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		files := info.Entries
+		sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+		return files, nil
+	}
+
+	pkgDir, err := cachedPackageDir(cacheDir, source)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []bundler.ArchiveEntry{}
+	err = filepath.WalkDir(pkgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(pkgDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, bundler.ArchiveEntry{Name: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// lsFilesCmd lists the files of a cached package or a package archive.
+func lsFilesCmd() *cobra.Command {
+	var long bool
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "ls-files <@namespace/name:version | package.tar.gz>",
+		Short: "List the files of a cached package or an archive",
+		Long: `List the files of a package version in the package cache, or of a local
+.tar.gz archive without extracting it, by their path inside the package.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			files, err := listPackageFiles(cfg.TypstCachePkgPath, args[0])
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(files)
+			}
+
+			if !long {
+				for _, f := range files {
+					fmt.Println(f.Name)
+				}
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, f := range files {
+				fmt.Fprintf(w, "%s\t%s\n", f.Name, utils.FormatSize(f.Size))
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "Also show the size of each file")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the files as JSON")
+
+	return cmd
+}
+
+// removeCachedCmd removes a cached package.
+func removeCachedCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "remove <namespace/name:version>",
+		Short: "Remove a cached package",
+		Long: `Remove a locally cached package from the cache directory.
+
+The removal has to be confirmed interactively or with --yes, which is
+required when stdin is not a terminal.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgSpec := args[0]
+			pkg, err := parseExactPkgSpec(pkgSpec)
+			if err != nil {
+				return err
+			}
+			namespace, name, version := pkg.Namespace, pkg.Name, pkg.Version
+
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("typst cache directory not configured")
+			}
+
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
+				return fmt.Errorf("typst cache directory not configured")
+			}
+
+			pkgDir := filepath.Join(cacheDir, namespace, name, version)
+
+			// Check if the package exists
+			info, err := os.Stat(pkgDir)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("package @%s/%s:%s not found in cache", namespace, name, version)
+				}
+				return fmt.Errorf("failed to check package: %v", err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("package @%s/%s:%s is not a directory", namespace, name, version)
+			}
+
+			if !yes {
+				if !stdinIsTerminal() {
+					return fmt.Errorf("stdin is not a terminal, pass --yes to confirm removing @%s/%s:%s", namespace, name, version)
+				}
+				if !confirm(fmt.Sprintf("Remove @%s/%s:%s?", namespace, name, version)) {
+					summaryf("Nothing removed.\n")
+					return nil
+				}
+			}
+
+			if err := os.RemoveAll(pkgDir); err != nil {
+				return fmt.Errorf("failed to remove package: %v", err)
+			}
+
+			// Do not leave empty package and namespace directories behind
+			if err := utils.PruneEmptyParents(filepath.Dir(pkgDir), cacheDir); err != nil {
+				return fmt.Errorf("failed to clean up cache directory: %v", err)
+			}
+
+			summaryf("Removed @%s/%s:%s from cache\n", namespace, name, version)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Remove without asking for confirmation")
+
+	return cmd
+}
+
+// verifyPackage and downloadPackage are replaced in tests.
+var (
+	verifyPackage   = api.VerifyPackage
+	downloadPackage = api.DownloadPackage
+)
+
+// verifyOptions controls how verify handles packages that fail verification.
+type verifyOptions struct {
+	// fix removes packages that do not match or are not published anymore.
+	fix bool
+	// reinstall downloads mismatched packages again instead of removing them.
+	reinstall bool
+}
+
+// verifyResult counts the outcomes of verifying cached packages.
+type verifyResult struct {
+	ok, repaired, removed, failed int
+}
+
+// verifyCache verifies pkgs in cacheDir, printing a line per package, and
+// repairs the ones failing verification as requested by opts.
+func verifyCache(ctx context.Context, cacheDir string, pkgs []deps.Dependency, opts verifyOptions) verifyResult {
+	var res verifyResult
+	for _, pkg := range pkgs {
+		dir := filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version)
+		status, err := verifyPackage(pkg.Namespace, pkg.Name, pkg.Version, dir)
+		if err != nil {
+			fmt.Fprintf(stdout, "  %s: ERROR (%v)\n", pkg.Key(), err)
+			res.failed++
+			continue
+		}
+
+		fmt.Fprintf(stdout, "  %s: %s\n", pkg.Key(), status)
+		switch {
+		case status == api.VerifyOK:
+			res.ok++
+		case !opts.fix:
+			// Packages no longer published cannot be verified, but are not
+			// known to be broken either
+			if status == api.VerifyMismatch {
+				res.failed++
+			}
+		case opts.reinstall && status == api.VerifyMismatch:
+			if err := downloadPackage(ctx, pkg.Namespace, pkg.Name, pkg.Version, nil); err != nil {
+				fmt.Fprintf(stdout, "    failed to re-download: %v\n", err)
+				res.failed++
+				continue
+			}
+			fmt.Fprintln(stdout, "    re-downloaded")
+			res.repaired++
+		case opts.reinstall:
+			fmt.Fprintln(stdout, "    kept, it cannot be downloaded again")
+		default:
+			if err := removeCachedPackage(cacheDir, dir); err != nil {
+				fmt.Fprintf(stdout, "    failed to remove: %v\n", err)
+				res.failed++
+				continue
+			}
+			fmt.Fprintln(stdout, "    removed")
+			res.removed++
+		}
+	}
+	return res
+}
+
+// removeCachedPackage removes the package in dir from the cache, along with
+// package and namespace directories left empty.
+func removeCachedPackage(cacheDir, dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return utils.PruneEmptyParents(filepath.Dir(dir), cacheDir)
+}
+
+// verifyCmd checks cached packages against the archives published on the server.
+func verifyCmd() *cobra.Command {
+	var opts verifyOptions
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "verify [namespace/name:version]",
+		Short: "Verify the integrity of cached packages",
+		Long: `Compare cached packages with the archives published on the TPIX server and
+report each one as OK, MISMATCH or MISSING-ON-SERVER. Without an argument,
+every package in the cache is verified.
+
+The command fails if any package does not match. With --fix, packages that do
+not match or are no longer published are removed from the cache, which has to
+be confirmed with --yes. With --reinstall, mismatched packages are downloaded
+again instead.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.reinstall {
+				opts.fix = true
+			}
+			if opts.fix && !opts.reinstall && !yes {
+				return fmt.Errorf("--fix removes packages from the cache, pass --yes to confirm or use --reinstall to download them again")
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
+				return fmt.Errorf("typst cache directory not configured")
+			}
+
+			var pkgs []deps.Dependency
+			if len(args) == 1 {
+				pkg, err := parseExactPkgSpec(args[0])
+				if err != nil {
+					return err
+				}
+				if !resolver.IsCached(cacheDir, pkg) {
+					return fmt.Errorf("package %s not found in cache", pkg.Key())
+				}
+				pkgs = append(pkgs, pkg)
+			} else {
+				pkgs, err = cachedPackages(cacheDir)
+				if err != nil {
+					return err
+				}
+			}
+
+			res := verifyCache(cmd.Context(), cacheDir, pkgs, opts)
+			if opts.fix {
+				summaryf("Verified %d package(s): %d ok, %d repaired, %d removed, %d failed.\n",
+					len(pkgs), res.ok, res.repaired, res.removed, res.failed)
+			}
+			if res.failed > 0 {
+				return fmt.Errorf("%d of %d package(s) failed verification", res.failed, len(pkgs))
+			}
+
+			if !opts.fix {
+				summaryf("Verified %d package(s).\n", len(pkgs))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.fix, "fix", false, "Remove packages that do not match or are no longer published")
+	cmd.Flags().BoolVar(&opts.reinstall, "reinstall", false, "Download packages that do not match again, implies --fix")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Confirm removing packages with --fix")
+
+	return cmd
+}
+
+// findVersion returns the entry of pkg for the given version. The error
+// lists the published versions if there is none.
+func findVersion(pkg *api.PackageResponse, v string) (*api.PackageVersionInfo, error) {
+	available := make([]string, 0, len(pkg.Versions))
+	for i := range pkg.Versions {
+		if pkg.Versions[i].Version == v {
+			return &pkg.Versions[i], nil
+		}
+		available = append(available, pkg.Versions[i].Version)
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("version %s of @%s/%s not found, no versions are published", v, pkg.Namespace, pkg.Name)
+	}
+	return nil, fmt.Errorf("version %s of @%s/%s not found, available versions: %s", v, pkg.Namespace, pkg.Name, strings.Join(available, ", "))
+}
+
+func printVersionInfo(w io.Writer, v *api.PackageVersionInfo) {
+	fmt.Fprintf(w, "Version: %s\n", v.Version)
+	fmt.Fprintf(w, "Typst: %s\n", v.TypstVersion)
+	fmt.Fprintf(w, "SHA256: %s\n", v.SHA256)
+	if v.PublishedAt != nil {
+		fmt.Fprintf(w, "Published: %s\n", v.PublishedAt.Format(time.RFC3339))
+	} else {
+		fmt.Fprintln(w, "Published: unknown")
+	}
+	if v.Size > 0 {
+		fmt.Fprintf(w, "Size: %s\n", utils.FormatSize(v.Size))
+	} else {
+		fmt.Fprintln(w, "Size: unknown")
+	}
+	if v.Downloads != nil {
+		fmt.Fprintf(w, "Downloads: %d\n", *v.Downloads)
+	}
+}
+
+// printPackageInfo prints the details of pkg and the versions it has
+// published. Download counts are only shown if the server reports them.
+func printPackageInfo(w io.Writer, pkg *api.PackageResponse) {
+	fmt.Fprintf(w, "Description: %s\n", pkg.Description)
+	fmt.Fprintf(w, "Website: %s\n", pkg.HomepageURL)
+	fmt.Fprintf(w, "Repository: %s\n", pkg.RepositoryURL)
+	fmt.Fprintf(w, "License: %s\n", pkg.License)
+	if pkg.Downloads != nil {
+		fmt.Fprintf(w, "Downloads: %d\n", *pkg.Downloads)
+	}
+	fmt.Fprintf(w, "\nVersions:\n")
+	for _, v := range pkg.Versions {
+		if v.Downloads != nil {
+			fmt.Fprintf(w, "  %s (Typst: %s, downloads: %d)\n", v.Version, v.TypstVersion, *v.Downloads)
+		} else {
+			fmt.Fprintf(w, "  %s (Typst: %s)\n", v.Version, v.TypstVersion)
+		}
+	}
+}
+
+// queryPkgCmd query package detail from TPIX server.
+func queryPkgCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "info <namespace/name[:version]>",
+		Short: "Show detailed information about a package",
+		Long: `Show detailed information about a package and the versions it has published.
+With a version, the Typst version, checksum, publication date and size of that
+version are shown instead of the list of versions. Download counts are shown
+if the server reports them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgSpec := args[0]
+
+			// Parse namespace/name
+			namespace, name, pkgVersion, err := parsePkgSpec(pkgSpec)
+			if err != nil {
+				return err
+			}
+
+			pkg, err := api.FetchPackage(namespace, name)
+			if err != nil {
+				return err
+			}
+
+			if pkgVersion != "" {
+				v, err := findVersion(pkg, pkgVersion)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Package: @%s/%s\n\n", namespace, name)
+				printVersionInfo(os.Stdout, v)
+				return nil
+			}
+
+			fmt.Printf("Package: @%s/%s\n\n", namespace, name)
+			printPackageInfo(os.Stdout, pkg)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// defaultPackageName derives a package name from the name of dir, e.g.
+// "My Package" becomes "my-package".
+func defaultPackageName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(abs)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else if b.Len() > 0 && !strings.HasSuffix(b.String(), "-") {
+			b.WriteByte('-')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// ask prompts for a value on stdin, returning def if the answer is empty.
+func ask(r *bufio.Reader, label, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	answer, _ := r.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// initCmd scaffolds a new package.
+func initCmd() *cobra.Command {
+	var (
+		pkg     bundler.Package
+		authors string
+		yes     bool
+		force   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init [directory]",
+		Short: "Create a new package",
+		Long: `Create a typst.toml manifest and a starter entrypoint in a directory,
+the current one by default. Values not given as flags are asked for
+interactively, or taken from the defaults with --yes, which is required
+when stdin is not a terminal. An existing typst.toml is only replaced with
+--force; an existing entrypoint file is never replaced.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			if pkg.Name == "" {
+				pkg.Name = defaultPackageName(dir)
+			}
+
+			if !yes {
+				if !stdinIsTerminal() {
+					return fmt.Errorf("stdin is not a terminal, pass --yes to use the defaults")
+				}
+
+				fields := []struct {
+					flag  string
+					label string
+					value *string
+				}{
+					{"name", "Name", &pkg.Name},
+					{"version", "Version", &pkg.Version},
+					{"entrypoint", "Entrypoint", &pkg.Entrypoint},
+					{"authors", "Authors (comma separated)", &authors},
+					{"license", "License", &pkg.License},
+					{"description", "Description", &pkg.Description},
+				}
+				r := bufio.NewReader(os.Stdin)
+				for _, f := range fields {
+					if !cmd.Flags().Changed(f.flag) {
+						*f.value = ask(r, f.label, *f.value)
+					}
+				}
+			}
+
+			for _, author := range strings.Split(authors, ",") {
+				if author = strings.TrimSpace(author); author != "" {
+					pkg.Authors = append(pkg.Authors, author)
+				}
+			}
+
+			if err := bundler.Scaffold(dir, &pkg, force); err != nil {
+				if errors.Is(err, fs.ErrExist) {
+					return fmt.Errorf("%w, pass --force to overwrite it", err)
+				}
+				return err
+			}
+
+			summaryf("Created package %s %s in %s\n", pkg.Name, pkg.Version, dir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&pkg.Name, "name", "", "Package name (default: derived from the directory name)")
+	cmd.Flags().StringVar(&pkg.Version, "version", "0.1.0", "Package version")
+	cmd.Flags().StringVar(&pkg.Entrypoint, "entrypoint", "lib.typ", "Entrypoint file of the package")
+	cmd.Flags().StringVar(&authors, "authors", "", "Comma-separated list of authors")
+	cmd.Flags().StringVar(&pkg.License, "license", "MIT", "SPDX license identifier")
+	cmd.Flags().StringVar(&pkg.Description, "description", "", "Short description of the package")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Use the defaults for values not given as flags instead of asking")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing typst.toml")
+
+	return cmd
+}
+
+// sizeOptions controls the package size check of bundle and push.
+type sizeOptions struct {
+	maxFileSize    string
+	maxPackageSize string
+	strict         bool
+}
+
+func (o *sizeOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.maxFileSize, "max-file-size", "", fmt.Sprintf("Warn about files larger than this, e.g. 10MB (default %s)", utils.FormatSize(bundler.DefaultMaxFileSize)))
+	cmd.Flags().StringVar(&o.maxPackageSize, "max-package-size", "", fmt.Sprintf("Warn if all files together are larger than this (default %s)", utils.FormatSize(bundler.DefaultMaxPackageSize)))
+	cmd.Flags().BoolVar(&o.strict, "strict", false, "Fail instead of warning if the package is too large")
+}
+
+// limits returns the size limits from the flags, falling back to the
+// config and then to the defaults.
+func (o *sizeOptions) limits(cfg config.Config) (bundler.SizeLimits, error) {
+	limits := bundler.SizeLimits{
+		MaxFileSize:    bundler.DefaultMaxFileSize,
+		MaxPackageSize: bundler.DefaultMaxPackageSize,
+	}
+	for _, l := range []struct {
+		name   string
+		flag   string
+		cfg    string
+		cfgKey string
+		limit  *int64
+	}{
+		{"max-file-size", o.maxFileSize, cfg.MaxFileSize, "maxFileSize", &limits.MaxFileSize},
+		{"max-package-size", o.maxPackageSize, cfg.MaxPackageSize, "maxPackageSize", &limits.MaxPackageSize},
+	} {
+		value := cmp.Or(l.flag, l.cfg)
+		if value == "" {
+			continue
+		}
+		size, err := utils.ParseSize(value)
+		if err != nil && l.flag == "" {
+			return limits, fmt.Errorf("invalid %s in the config file: %w", l.cfgKey, err)
+		}
+		if err != nil {
+			return limits, fmt.Errorf("invalid --%s: %w", l.name, err)
+		}
+		*l.limit = size
+	}
+	return limits, nil
+}
+
+// check warns if the files of a package exceed the size limits, or fails
+// with --strict.
+func (o *sizeOptions) check(files []bundler.ArchiveEntry) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	limits, err := o.limits(cfg)
+	if err != nil {
+		return err
+	}
+
+	report := bundler.CheckSize(files, limits)
+	if report.OK() {
+		return nil
+	}
+
+	msg := formatSizeReport(report, limits)
+	if o.strict {
+		return errors.New(strings.TrimSuffix(msg, "\n"))
+	}
+	warnf("%s", msg)
+	return nil
+}
+
+// formatSizeReport describes why a package is too large, listing the files
+// that contribute most.
+func formatSizeReport(report *bundler.SizeReport, limits bundler.SizeLimits) string {
+	var b strings.Builder
+	offenders := report.Oversized
+	if report.TotalExceeded {
+		fmt.Fprintf(&b, "package is %s, more than the %s limit", utils.FormatSize(report.Total), utils.FormatSize(limits.MaxPackageSize))
+		if len(offenders) == 0 {
+			offenders = report.Largest
+		}
+		b.WriteString(", largest files:\n")
+	} else {
+		fmt.Fprintf(&b, "%d file(s) larger than the %s limit:\n", len(offenders), utils.FormatSize(limits.MaxFileSize))
+	}
+	for _, f := range offenders {
+		fmt.Fprintf(&b, "  %s (%s)\n", f.Name, utils.FormatSize(f.Size))
+	}
+	return b.String()
+}
+
+// bundleCmd creates a Typst package from a directory.
+func bundleCmd() *cobra.Command {
+	var output string
+	var exclude []string
+	var excludeFrom string
+	var useGitignore bool
+	var reproducible bool
+	var validateImports bool
+	var checksum bool
+	var format string
+	var noDefaultExcludes bool
+	var sizes sizeOptions
+
+	cmd := &cobra.Command{
+		Use:   "bundle <directory>",
+		Short: "Create a Typst package from a directory",
+		Long: `Create a .tar.gz Typst package from a directory containing a typst.toml manifest.
+The directory must contain a valid typst.toml file with required fields:
+- package.name
+- package.version
+- package.entrypoint
+
+Files and directories can be excluded using the --exclude flag, a file of
+patterns given with --exclude-from, or the exclude field in typst.toml.
+Patterns from .gitignore files in the directory are also honored, including
+negated (!pattern) entries, unless --use-gitignore=false is given.
+A .typstignore file at the package root, in the same syntax, takes
+precedence over .gitignore and can re-include files it ignores. Nothing can
+re-include files excluded with --exclude, --exclude-from or typst.toml.
+Version control directories such as .git and OS and editor files such as
+.DS_Store or *.swp are excluded by default, unless --no-default-excludes is given.
+
+With --checksum, the SHA256 of the archive is also written to
+<output>.sha256 in the format checked by "sha256sum -c".
+
+--format zip creates a .zip archive instead, for tools that do not read
+tar.gz. The TPIX server only accepts tar.gz packages.
+
+With --output -, the archive is written to stdout to be piped into another
+command.
+
+A warning lists the largest files if a file or the package as a whole is
+larger than --max-file-size or --max-package-size, as servers may reject
+large packages. With --strict, no package is created in that case.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srcDir := args[0]
+
+			// Check if directory exists
+			info, err := os.Stat(srcDir)
+			if err != nil {
+				return fmt.Errorf("failed to access directory: %w", err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", srcDir)
+			}
+			if err := checkManifestExists(srcDir); err != nil {
+				return err
+			}
+
+			if validateImports {
+				// Keep stdout clean for the archive
+				diag := stdout
+				if output == "-" {
+					diag = stderr
+				}
+				if err := checkImports(srcDir, diag); err != nil {
+					return err
+				}
+			}
+
+			if format != bundler.FormatTarGz && format != bundler.FormatZip {
+				return fmt.Errorf("unsupported format %q, use %s or %s", format, bundler.FormatTarGz, bundler.FormatZip)
+			}
+			if output == "-" && checksum {
+				return fmt.Errorf("--checksum cannot be used when writing to stdout")
+			}
+
+			// Determine output path
+			if output == "" {
+				// Use directory name with the extension of the format
+				output = filepath.Base(srcDir) + "." + format
+			}
+
+			if excludeFrom != "" {
+				patterns, err := bundler.ReadExcludeFile(excludeFrom)
+				if err != nil {
+					return fmt.Errorf("failed to read exclude file: %w", err)
+				}
+				exclude = append(exclude, patterns...)
+			}
+
+			// Create package
+			creator := bundler.NewPackageCreator(exclude)
+			creator.UseGitignore = useGitignore
+			creator.Reproducible = reproducible
+			creator.Format = format
+			creator.NoDefaultExcludes = noDefaultExcludes
+
+			pkg, err := creator.Prepare(srcDir)
+			if err != nil {
+				return fmt.Errorf("failed to create package: %w", err)
+			}
+			if err := sizes.check(pkg.Files()); err != nil {
+				return err
+			}
+
+			if err := pkg.Create(output); err != nil {
+				return fmt.Errorf("failed to create package: %w", err)
+			}
+
+			// Keep stdout clean for the archive
+			if output == "-" {
+				return nil
+			}
+			summaryf("Package created: %s\n", output)
+
+			if checksum {
+				sumPath, err := utils.WriteChecksumFile(output)
+				if err != nil {
+					return fmt.Errorf("failed to write checksum file: %w", err)
+				}
+				summaryf("Checksum written: %s\n", sumPath)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file path, - for stdout (default: <directory>.tar.gz or <directory>.zip)")
+	cmd.Flags().StringVar(&format, "format", bundler.FormatTarGz, "Archive format: tar.gz or zip")
+	cmd.Flags().StringSliceVarP(&exclude, "exclude", "e", []string{}, "Additional files/directories to exclude")
+	cmd.Flags().StringVar(&excludeFrom, "exclude-from", "", "Read exclude patterns from a file, one per line")
+	cmd.Flags().BoolVar(&useGitignore, "use-gitignore", true, "Exclude files matched by .gitignore")
+	cmd.Flags().BoolVar(&noDefaultExcludes, "no-default-excludes", false, "Do not exclude VCS directories and OS/editor files ("+strings.Join(bundler.DefaultExcludes, ", ")+")")
+	cmd.Flags().BoolVar(&reproducible, "reproducible", true, "Strip timestamps and ownership for byte-identical archives")
+	cmd.Flags().BoolVar(&validateImports, "validate-imports", false, "Check that every imported package exists on the TPIX server")
+	cmd.Flags().BoolVar(&checksum, "checksum", false, "Also write the SHA256 of the archive to <output>.sha256")
+	sizes.addFlags(cmd)
+
+	return cmd
+}
+
+// checkManifestExists returns an error if srcDir has no typst.toml.
+func checkManifestExists(srcDir string) error {
+	manifestPath := filepath.Join(srcDir, "typst.toml")
+	if _, err := os.Stat(manifestPath); err != nil {
+		return fmt.Errorf("typst.toml not found in %s - a valid manifest is required", srcDir)
+	}
+	return nil
+}
+
+// bundleToTemp bundles the package directory srcDir into a temporary
+// archive named after the directory, as the bundle command does with its
+// default options. The returned cleanup function removes the archive.
+func bundleToTemp(srcDir string) (string, func(), error) {
+	if err := checkManifestExists(srcDir); err != nil {
+		return "", nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tpix-push-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	abs, err := filepath.Abs(srcDir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	output := filepath.Join(tmpDir, filepath.Base(abs)+".tar.gz")
+
+	creator := bundler.NewPackageCreator(nil)
+	creator.UseGitignore = true
+	creator.Reproducible = true
+	if err := creator.CreatePackage(srcDir, output); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create package: %w", err)
+	}
+
+	return output, cleanup, nil
+}
+
+// checkImports verifies that every package imported by the sources in srcDir
+// is published on the TPIX server, reporting the ones that are not to w.
+func checkImports(srcDir string, w io.Writer) error {
+	logf(levelInfo, w, "Validating package imports...\n")
+	unresolved, err := bundler.ValidateImports(srcDir, func(namespace, name string) ([]string, error) {
+		pkg, err := api.FetchPackage(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		versions := make([]string, 0, len(pkg.Versions))
+		for _, v := range pkg.Versions {
+			versions = append(versions, v.Version)
+		}
+		return versions, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(unresolved) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w, "Unresolvable imports:")
+	for _, u := range unresolved {
+		fmt.Fprintf(w, "  %s: %s\n", u.Dependency.Key(), u.Reason)
+	}
+	return fmt.Errorf("%d import(s) cannot be resolved", len(unresolved))
+}
+
+// validateCmd checks a package directory without bundling it.
+func validateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate <directory>",
+		Short: "Check a package directory before bundling or pushing",
+		Long: `Check the typst.toml manifest of a package directory without creating a package.
+Errors (missing required fields, an invalid version or a missing entrypoint file)
+make the command exit with a non-zero status. Missing authors, license or
+description, which are required for repository submission, are reported as warnings.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srcDir := args[0]
+
+			report, err := bundler.Validate(srcDir)
+			if err != nil {
+				return err
+			}
+
+			for _, e := range report.Errors {
+				fmt.Printf("\terror: %s\n", e)
+			}
+			for _, w := range report.Warnings {
+				fmt.Printf("\twarning: %s\n", w)
+			}
+
+			if !report.OK() {
+				return fmt.Errorf("validation failed with %d error(s)", len(report.Errors))
+			}
+
+			summaryf("%s is a valid package\n", srcDir)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// pushPlan describes an upload without performing it.
+type pushPlan struct {
+	Archive    string `json:"archive"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Files      int    `json:"files"`
+	Package    string `json:"package"`
+	Version    string `json:"version"`
+	Entrypoint string `json:"entrypoint"`
+	Namespace  string `json:"namespace"`
+	Server     string `json:"server"`
+}
+
+// planPush inspects the archive at packagePath to show what pushing it to
+// namespace would send. No request is made.
+func planPush(packagePath, namespace string) (*pushPlan, error) {
+	info, err := bundler.InspectArchive(packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &pushPlan{
+		Archive:   packagePath,
+		Size:      info.ArchiveSize,
+		SHA256:    info.SHA256,
+		Files:     info.Files,
+		Namespace: namespace,
+		Server:    api.ServerURL(),
+	}
+	if pkg := info.Manifest.Package; pkg != nil {
+		plan.Package = pkg.Name
+		plan.Version = pkg.Version
+		plan.Entrypoint = pkg.Entrypoint
+	}
+
+	return plan, nil
+}
+
+// reportItem is a line of the validation report of a rejected upload.
+type reportItem struct {
+	Warning bool
+	Field   string
+	Message string
+}
+
+// reportFieldPattern matches the field name a report line may start with,
+// such as "package.version: ...".
+var reportFieldPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.\-\[\]]*):\s+(.*)$`)
+
+// parseValidateReport splits the lines of a server validation report into
+// errors and warnings, which are told apart by an "error:" or "warning:"
+// prefix. Lines without one are errors.
+func parseValidateReport(lines []string) []reportItem {
+	var items []reportItem
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var item reportItem
+		lower := strings.ToLower(line)
+		for _, prefix := range []string{"warning:", "warn:"} {
+			if strings.HasPrefix(lower, prefix) {
+				item.Warning = true
+				line = strings.TrimSpace(line[len(prefix):])
+			}
+		}
+		if strings.HasPrefix(lower, "error:") {
+			line = strings.TrimSpace(line[len("error:"):])
+		}
+
+		if m := reportFieldPattern.FindStringSubmatch(line); m != nil {
+			item.Field, line = m[1], m[2]
+		}
+		item.Message = line
+		items = append(items, item)
+	}
+	return items
+}
+
+// uploadRejected prints the validation report of a rejected upload grouped
+// into errors and warnings, and returns the error push fails with.
+func uploadRejected(w io.Writer, resp *api.UploadResponse) error {
+	items := parseValidateReport(resp.ValidateReport)
+	if len(items) == 0 {
+		return fmt.Errorf("upload failed: the server responded with status %d %s and no report", resp.Status, http.StatusText(resp.Status))
+	}
+
+	var errs, warnings []reportItem
+	for _, item := range items {
+		if item.Warning {
+			warnings = append(warnings, item)
+		} else {
+			errs = append(errs, item)
+		}
+	}
+
+	printGroup := func(title string, group []reportItem) {
+		if len(group) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s:\n", title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, item := range group {
+			if item.Field != "" {
+				fmt.Fprintf(tw, "  %s\t%s\n", item.Field, item.Message)
+			} else {
+				fmt.Fprintf(tw, "  %s\n", item.Message)
+			}
+		}
+		tw.Flush()
+	}
+	fmt.Fprintf(w, "The server rejected the package:\n")
+	printGroup("Errors", errs)
+	printGroup("Warnings", warnings)
+
+	return fmt.Errorf("upload rejected with %d error(s) and %d warning(s)", len(errs), len(warnings))
+}
+
+// printArchiveInfo prints the manifest and contents of a package archive.
+func printArchiveInfo(w io.Writer, info *bundler.ArchiveInfo) {
+	if pkg := info.Manifest.Package; pkg != nil {
+		fmt.Fprintf(w, "Package: %s %s\n", pkg.Name, pkg.Version)
+		fmt.Fprintf(w, "Entrypoint: %s\n", pkg.Entrypoint)
+		if len(pkg.Authors) > 0 {
+			fmt.Fprintf(w, "Authors: %s\n", strings.Join(pkg.Authors, ", "))
+		}
+		if pkg.License != "" {
+			fmt.Fprintf(w, "License: %s\n", pkg.License)
+		}
+		if pkg.Description != "" {
+			fmt.Fprintf(w, "Description: %s\n", pkg.Description)
+		}
+		if pkg.Compiler != "" {
+			fmt.Fprintf(w, "Compiler: %s\n", pkg.Compiler)
+		}
+	}
+	if tmpl := info.Manifest.Template; tmpl != nil {
+		fmt.Fprintf(w, "Template: %s (entrypoint %s)\n", tmpl.Path, tmpl.Entrypoint)
+	}
+
+	fmt.Fprintf(w, "\nFiles:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, entry := range info.Entries {
+		fmt.Fprintf(tw, "  %s\t%s\n", entry.Name, utils.FormatSize(entry.Size))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nTotal: %d files, %s uncompressed, %s compressed\n", info.Files, utils.FormatSize(info.Size), utils.FormatSize(info.ArchiveSize))
+	fmt.Fprintf(w, "SHA256: %s\n", info.SHA256)
+}
+
+// checkChecksum compares the SHA256 of an archive with the expected one,
+// which may be prefixed with "sha256:" and is compared case-insensitively.
+func checkChecksum(actual, expected string) error {
+	expected = strings.TrimPrefix(strings.TrimSpace(expected), "sha256:")
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: expected %s, got %s", api.ErrChecksumMismatch, expected, actual)
+	}
+	return nil
+}
+
+// checksumCmd prints the SHA256 of a local archive.
+func checksumCmd() *cobra.Command {
+	var expected string
+
+	cmd := &cobra.Command{
+		Use:   "checksum <package.tar.gz>",
+		Short: "Print the SHA256 and size of a package archive",
+		Long: `Print the SHA256 and size of a local package archive, in the format the server
+reports after a push, e.g. to confirm that a bundled archive matches the one
+stored on the server.
+
+With --check, the command fails if the SHA256 differs from the given one.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sum, size, err := utils.HashFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read archive: %w", err)
+			}
+
+			fmt.Printf("SHA256: %s\n", sum)
+			fmt.Printf("Size: %d bytes (%s)\n", size, utils.FormatSize(size))
+
+			if cmd.Flags().Changed("check") {
+				if err := checkChecksum(sum, expected); err != nil {
+					return err
+				}
+				summaryf("Checksum OK\n")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&expected, "check", "", "Fail unless the SHA256 matches this one")
+
+	return cmd
+}
+
+// inspectCmd shows what is inside a package archive.
+func inspectCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "inspect <package.tar.gz>",
+		Short: "Show the manifest and files of a package archive",
+		Long: `Show the typst.toml manifest and the files of a package archive, such as one
+created by 'tpix bundle', along with its uncompressed size and SHA256. The
+archive is read without extracting it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := bundler.InspectArchive(args[0])
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+
+			printArchiveInfo(os.Stdout, info)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the information as JSON")
+
+	return cmd
+}
+
+// pushCmd uploads a package to the TPIX server.
+func pushCmd() *cobra.Command {
+	var dryRun bool
+	var jsonOutput bool
+	var compress bool
+	var force bool
+	var wait bool
+	var waitTimeout time.Duration
+	var pollInterval time.Duration
+	var as string
+	var sizes sizeOptions
+
+	cmd := &cobra.Command{
+		Use:   "push <package.tar.gz | directory> <namespace>",
+		Short: "Upload a package to the TPIX server",
+		Long: `Upload a .tar.gz Typst package to the TPIX server.
+The package must be a valid Typst package archive created with the bundle
+command, or a package directory with a typst.toml, which is bundled with the
+default options of the bundle command before uploading.
+
+If the version is already published, the upload is skipped and the command
+succeeds, so publishing can safely be re-run. --force uploads anyway.
+
+Servers may process uploads asynchronously. With --wait the command only
+returns once the new version can be queried, or fails after --wait-timeout.
+
+Packages larger than --max-file-size or --max-package-size are reported
+before uploading, and rejected with --strict.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			packagePath := args[0]
+			namespace := args[1]
+
+			if err := useProfile(as, namespace); err != nil {
+				return err
+			}
+
+			// Check if file exists
+			info, err := os.Stat(packagePath)
+			if err != nil {
+				return fmt.Errorf("failed to access package: %w", err)
+			}
+			if info.IsDir() {
+				progressf("Bundling %s...\n", packagePath)
+				archive, cleanup, err := bundleToTemp(packagePath)
+				if err != nil {
+					return err
+				}
+				defer cleanup()
+				packagePath = archive
+			} else if strings.EqualFold(filepath.Ext(packagePath), ".zip") {
+				warnf("%s looks like a zip archive, the server only accepts tar.gz packages; bundle with --format tar.gz\n", packagePath)
+			}
+
+			// Catch oversized packages before a slow upload
+			if archiveInfo, err := bundler.InspectArchive(packagePath); err != nil {
+				debugf("Skipping the size check: %v\n", err)
+			} else if err := sizes.check(archiveInfo.Entries); err != nil {
+				return err
+			}
+
+			if dryRun {
+				plan, err := planPush(packagePath, namespace)
+				if err != nil {
+					return err
+				}
+				// Show the directory rather than the temporary archive
+				plan.Archive = args[0]
+
+				if jsonOutput {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(plan)
+				}
+
+				fmt.Printf("Archive: %s (%d bytes, %d files)\n", plan.Archive, plan.Size, plan.Files)
+				fmt.Printf("SHA256: %s\n", plan.SHA256)
+				fmt.Printf("Package: @%s/%s:%s\n", plan.Namespace, plan.Package, plan.Version)
+				fmt.Printf("Entrypoint: %s\n", plan.Entrypoint)
+				fmt.Printf("Server: %s\n", plan.Server)
+				fmt.Println("\nDry run, nothing was uploaded.")
+				return nil
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			// Check if user is logged in
+			if cfg.AccessToken == "" {
+				return fmt.Errorf("not logged in. Please run 'tpix login' first")
+			}
+
+			if !force {
+				plan, err := planPush(packagePath, namespace)
+				if err != nil {
+					return err
+				}
+				published, err := api.VersionPublished(namespace, plan.Package, plan.Version)
+				if err != nil {
+					warnf("could not check whether @%s/%s:%s is published: %v\n", namespace, plan.Package, plan.Version, err)
+				} else if published {
+					summaryf("@%s/%s:%s is already published, skipping upload (use --force to upload anyway)\n", namespace, plan.Package, plan.Version)
+					return nil
+				}
+			}
+
+			progressf("Uploading %s to namespace %s...\n", packagePath, namespace)
+
+			resp, err := api.UploadPackage(cmd.Context(), packagePath, namespace, api.UploadOptions{
+				Compress: compress,
+				OnRetry: func(wait time.Duration) {
+					warnf("rate limited by the server, retrying in %s...\n", wait.Round(time.Second))
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("upload failed: %w", err)
+			}
+
+			if resp.SHA256 == "" {
+				return uploadRejected(os.Stdout, resp)
+			}
+
+			if wait {
+				progressf("Uploaded @%s/%s:%s, waiting for it to be published...\n", namespace, resp.Package, resp.Version)
+				err := api.WaitForVersion(namespace, resp.Package, resp.Version, waitTimeout, pollInterval, func(attempt int) {
+					progressf("Not published yet, checking again (attempt %d)...\n", attempt)
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			summaryf("Successfully uploaded package: @%s/%s:%s\n", namespace, resp.Package, resp.Version)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be uploaded without contacting the server")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the --dry-run report as JSON")
+	cmd.Flags().BoolVar(&compress, "compress", false, "Compress the upload with gzip if the server supports it")
+	cmd.Flags().BoolVar(&force, "force", false, "Upload even if the version is already published")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait until the uploaded version is published")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 5*time.Minute, "How long --wait waits for the version to be published")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", 5*time.Second, "How often --wait checks whether the version is published")
+	addProfileFlag(cmd, &as)
+	sizes.addFlags(cmd)
+
+	return cmd
+}
+
+// envInfo describes the environment tpix runs in. It never holds secrets.
+type envInfo struct {
+	Version         string `json:"version"`
+	GoVersion       string `json:"goVersion"`
+	OS              string `json:"os"`
+	Arch            string `json:"arch"`
+	ConfigFile      string `json:"configFile"`
+	Server          string `json:"server"`
+	ServerSource    string `json:"serverSource"`
+	CacheDir        string `json:"cacheDir"`
+	CacheDirSource  string `json:"cacheDirSource"`
+	LoggedIn        bool   `json:"loggedIn"`
+	CredentialsFrom string `json:"credentialsFrom,omitempty"`
+	Typst           string `json:"typst"`
+	TypstVersion    string `json:"typstVersion,omitempty"`
+}
+
+// lookPath finds the typst binary; replaced in tests.
+var lookPath = exec.LookPath
+
+// collectEnv gathers the environment information for cfg.
+func collectEnv(cfg config.Config) *envInfo {
+	info := &envInfo{
+		Version:        version.Version,
+		GoVersion:      runtime.Version(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		ConfigFile:     config.FilePath(),
+		Server:         api.ServerURL(),
+		ServerSource:   "default",
+		CacheDir:       cfg.TypstCachePkgPath,
+		CacheDirSource: config.CachePathSource(cfg),
+		LoggedIn:       cfg.AccessToken != "",
+		Typst:          "not found",
+	}
+
+	if info.Server != api.TpixServer {
+		info.ServerSource = "custom"
+	}
+
+	if info.LoggedIn {
+		info.CredentialsFrom = "credential store"
+		if cfg.TokenFromEnv {
+			info.CredentialsFrom = "environment (TPIX_TOKEN)"
+		}
+	}
+
+	if path, err := lookPath("typst"); err == nil {
+		info.Typst = path
+		info.TypstVersion = typstVersion(path)
+	}
+
+	return info
+}
+
+// typstVersion runs "typst --version", giving up after a few seconds.
+func typstVersion(path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func printEnv(w io.Writer, info *envInfo) {
+	fmt.Fprintf(w, "tpix version: %s\n", info.Version)
+	fmt.Fprintf(w, "Go version: %s\n", info.GoVersion)
+	fmt.Fprintf(w, "OS/Arch: %s/%s\n", info.OS, info.Arch)
+	fmt.Fprintf(w, "Config file: %s\n", info.ConfigFile)
+	fmt.Fprintf(w, "Server: %s (%s)\n", info.Server, info.ServerSource)
+	fmt.Fprintf(w, "Cache dir: %s (%s)\n", info.CacheDir, info.CacheDirSource)
+	if info.LoggedIn {
+		fmt.Fprintf(w, "Logged in: yes, token from %s\n", info.CredentialsFrom)
+	} else {
+		fmt.Fprintln(w, "Logged in: no")
+	}
+	if info.TypstVersion != "" {
+		fmt.Fprintf(w, "Typst: %s (%s)\n", info.Typst, info.TypstVersion)
+	} else {
+		fmt.Fprintf(w, "Typst: %s\n", info.Typst)
+	}
+}
+
+// checkStatus is the outcome of a doctor check.
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	// checkWarn is a problem that only affects some commands.
+	checkWarn
+	// checkFail is a problem that breaks most commands.
+	checkFail
+)
+
+// doctorCheck is the result of one check of the doctor command.
+type doctorCheck struct {
+	Name   string
+	Status checkStatus
+	Detail string
+	// Hint tells how to fix a failed check.
+	Hint string
+}
+
+// checkConfigFile checks that the config file at path is readable and not
+// accessible by other users, as it may hold tokens.
+func checkConfigFile(path string) doctorCheck {
+	check := doctorCheck{Name: "Config file", Detail: path}
+	if _, err := config.Load(); err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error()
+		check.Hint = "make sure " + path + " is readable and valid JSON"
+		return check
+	}
+
+	info, err := os.Stat(path)
+	if err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		check.Status = checkWarn
+		check.Detail = fmt.Sprintf("%s is accessible by other users (%v)", path, info.Mode().Perm())
+		check.Hint = "run 'chmod 600 " + path + "'"
+	}
+	return check
+}
+
+// checkCacheDir checks that the package cache directory is usable.
+func checkCacheDir(dir string) doctorCheck {
+	check := doctorCheck{Name: "Package cache", Detail: dir}
+	if dir == "" {
+		check.Status = checkFail
+		check.Detail = "not configured"
+		check.Hint = "run 'tpix cache path --set <dir>'"
+		return check
+	}
+
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		check.Status = checkWarn
+		check.Detail = dir + " does not exist yet"
+		check.Hint = "it is created by the first download"
+	case err != nil:
+		check.Status = checkFail
+		check.Detail = err.Error()
+	case !info.IsDir():
+		check.Status = checkFail
+		check.Detail = dir + " is not a directory"
+		check.Hint = "remove it or run 'tpix cache path --set <dir>'"
+	case utils.IsReadOnlyDir(dir):
+		check.Status = checkFail
+		check.Detail = dir + " is not writable"
+		check.Hint = "fix its permissions or run 'tpix cache path --set <dir>'"
+	default:
+		backups, err := cacheBackups(dir)
+		if err != nil {
+			check.Status = checkWarn
+			check.Detail = "could not look for interrupted package updates: " + err.Error()
+		} else if len(backups) > 0 {
+			check.Status = checkWarn
+			check.Detail = fmt.Sprintf("%d backup(s) left by interrupted package updates, e.g. %s", len(backups), backups[0])
+			check.Hint = "they are removed when the packages are downloaded again, or remove them yourself"
+		}
+	}
+	return check
+}
+
+// cacheBackups returns the backups of package versions in cacheDir left
+// behind by interrupted updates, see utils.Backups.
+func cacheBackups(cacheDir string) ([]string, error) {
+	pkgDirs, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, pkgDir := range pkgDirs {
+		if info, err := os.Stat(pkgDir); err != nil || !info.IsDir() {
+			continue
+		}
+		found, err := utils.Backups(pkgDir)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, found...)
+	}
+	return backups, nil
+}
+
+// checkServer checks that the TPIX server is reachable and compatible.
+func checkServer() doctorCheck {
+	check := doctorCheck{Name: "Server", Detail: api.ServerURL()}
+	if err := api.CheckCompatibility(); err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error()
+		check.Hint = "check your network connection and proxy settings, or run 'tpix update'"
+	}
+	return check
+}
+
+// checkLogin checks that the stored access token is accepted by the server.
+func checkLogin(cfg config.Config) doctorCheck {
+	check := doctorCheck{Name: "Login"}
+	if cfg.AccessToken == "" {
+		check.Status = checkWarn
+		check.Detail = "not logged in"
+		check.Hint = "run 'tpix login' to push packages"
+		return check
+	}
+
+	user, err := api.CurrentUser(cfg.AccessToken)
+	switch {
+	case errors.Is(err, api.ErrInvalidToken) && cfg.RefreshToken != "" && !cfg.TokenFromEnv:
+		check.Status = checkWarn
+		check.Detail = "access token expired"
+		check.Hint = "it is refreshed by the next request that needs it"
+	case errors.Is(err, api.ErrInvalidToken):
+		check.Status = checkFail
+		check.Detail = err.Error()
+		check.Hint = "run 'tpix login' again"
+		if cfg.TokenFromEnv {
+			check.Hint = "set TPIX_TOKEN to a valid token"
+		}
+	case err != nil:
+		check.Status = checkWarn
+		check.Detail = "could not verify the token: " + err.Error()
+	default:
+		check.Detail = "logged in as " + user.Username
+	}
+	return check
+}
+
+// checkUpdate checks whether a newer tpix-cli release is available.
+func checkUpdate() doctorCheck {
+	check := doctorCheck{Name: "tpix-cli version", Detail: version.Version}
+	if v := os.Getenv(noUpdateCheckEnv); v != "" && v != "0" && v != "false" {
+		check.Detail += " (update check disabled)"
+		return check
+	}
+
+	updater := newUpdater()
+	hasUpdate, err := updater.Check()
+	if err != nil {
+		check.Status = checkWarn
+		check.Detail = "could not check for updates: " + err.Error()
+		return check
+	}
+	if hasUpdate {
+		if latest, err := updater.Latest(); err == nil {
+			check.Status = checkWarn
+			check.Detail = fmt.Sprintf("%s, %s is available", version.Version, latest.Version)
+			check.Hint = "run 'tpix update'"
+		}
+	}
+	return check
+}
+
+// printDoctorReport prints the checks as a checklist and returns an error
+// if any of them failed.
+func printDoctorReport(w io.Writer, checks []doctorCheck) error {
+	failed := 0
+	for _, check := range checks {
+		mark := "✓"
+		switch check.Status {
+		case checkWarn:
+			mark = "!"
+		case checkFail:
+			mark = "✗"
+			failed++
+		}
+
+		fmt.Fprintf(w, "%s %s: %s\n", mark, check.Name, check.Detail)
+		if check.Status != checkOK && check.Hint != "" {
+			fmt.Fprintf(w, "    %s\n", check.Hint)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// doctorCmd diagnoses common setup problems.
+func doctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the setup for common problems",
+		Long: `Check the config file, the package cache, the connection to the server, the
+login and whether a tpix-cli update is available, and print how to fix any
+problem found.
+
+Problems marked with ✗ break most commands and make doctor exit with an
+error. Those marked with ! only affect some commands.`,
+		Args: cobra.ExactArgs(0),
+		// A failed check is not a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checks := []doctorCheck{checkConfigFile(config.FilePath())}
+
+			cfg, err := config.Load()
+			if err == nil {
+				checks = append(checks, checkCacheDir(cfg.TypstCachePkgPath))
+			}
+			server := checkServer()
+			checks = append(checks, server)
+			if err == nil && server.Status == checkOK {
+				checks = append(checks, checkLogin(cfg))
 			}
+			checks = append(checks, checkUpdate())
 
-			fmt.Printf("Removed @%s/%s:%s from cache\n", namespace, name, version)
-			return nil
+			return printDoctorReport(os.Stdout, checks)
 		},
 	}
 
 	return cmd
 }
 
-// queryPkgCmd query package detail from TPIX server.
-func queryPkgCmd() *cobra.Command {
+// envCmd prints information about the environment for bug reports.
+func envCmd() *cobra.Command {
+	var jsonOutput bool
+
 	cmd := &cobra.Command{
-		Use:   "info <namespace/name>",
-		Short: "Show detailed information about a package",
-		Args:  cobra.ExactArgs(1),
+		Use:   "env",
+		Short: "Print environment information for bug reports",
+		Long: `Print the resolved configuration and environment of tpix: versions, platform,
+config file, server and cache directory along with where they come from, and
+the detected Typst binary. Credentials are never printed.`,
+		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			pkgSpec := args[0]
-
-			// Parse namespace/name
-			namespace, name, _ := parsePkgSpec(pkgSpec)
-
-			pkg, err := api.FetchPackage(namespace, name)
+			cfg, err := config.Load()
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("Package: @%s/%s\n\n", namespace, name)
-			fmt.Printf("Description: %s\n", pkg.Description)
-			fmt.Printf("Website: %s\n", pkg.HomepageURL)
-			fmt.Printf("Repository: %s\n", pkg.RepositoryURL)
-			fmt.Printf("License: %s\n", pkg.License)
-			fmt.Printf("\nVersions:\n")
-			for _, v := range pkg.Versions {
-				fmt.Printf("  %s (Typst: %s)\n", v.Version, v.TypstVersion)
+			info := collectEnv(cfg)
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
 			}
 
+			printEnv(os.Stdout, info)
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the information as JSON")
+
 	return cmd
 }
 
-// bundleCmd creates a Typst package from a directory.
-func bundleCmd() *cobra.Command {
-	var output string
-	var exclude []string
+// configView is the effective configuration as printed by config show.
+// Tokens are replaced by their fingerprint.
+type configView struct {
+	ConfigFile        string                `json:"configFile"`
+	CacheDir          string                `json:"cacheDir"`
+	CacheDirSource    string                `json:"cacheDirSource"`
+	Profile           string                `json:"profile,omitempty"`
+	AccessToken       string                `json:"accessToken,omitempty"`
+	RefreshToken      string                `json:"refreshToken,omitempty"`
+	TokenExpiry       time.Time             `json:"tokenExpiry,omitzero"`
+	TokenSource       string                `json:"tokenSource,omitempty"`
+	Licenses          *config.LicensePolicy `json:"licenses,omitempty"`
+	Aliases           map[string]string     `json:"aliases,omitempty"`
+	NamespaceProfiles map[string]string     `json:"namespaceProfiles,omitempty"`
+}
 
-	cmd := &cobra.Command{
-		Use:   "bundle <directory>",
-		Short: "Create a Typst package from a directory",
-		Long: `Create a .tar.gz Typst package from a directory containing a typst.toml manifest.
-The directory must contain a valid typst.toml file with required fields:
-- package.name
-- package.version
-- package.entrypoint
+// tokenFingerprint identifies a token without revealing it, so that two
+// configurations can be compared in a bug report.
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
 
-Files and directories can be excluded using the --exclude flag or the exclude field in typst.toml.`,
-		Args: cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			srcDir := args[0]
+// newConfigView builds the view of cfg printed by config show.
+func newConfigView(cfg config.Config) *configView {
+	view := &configView{
+		ConfigFile:        config.FilePath(),
+		CacheDir:          cfg.TypstCachePkgPath,
+		CacheDirSource:    config.CachePathSource(cfg),
+		Profile:           config.Profile(),
+		AccessToken:       tokenFingerprint(cfg.AccessToken),
+		RefreshToken:      tokenFingerprint(cfg.RefreshToken),
+		TokenExpiry:       cfg.TokenExpiry,
+		Licenses:          cfg.Licenses,
+		Aliases:           cfg.Aliases,
+		NamespaceProfiles: cfg.NamespaceProfiles,
+	}
+	if cfg.AccessToken != "" {
+		view.TokenSource = "credential store"
+		if cfg.TokenFromEnv {
+			view.TokenSource = "environment (TPIX_TOKEN)"
+		}
+	}
+	return view
+}
 
-			// Check if directory exists
-			info, err := os.Stat(srcDir)
-			if err != nil {
-				return fmt.Errorf("failed to access directory: %w", err)
-			}
-			if !info.IsDir() {
-				return fmt.Errorf("%s is not a directory", srcDir)
-			}
+func printConfigView(w io.Writer, view *configView) {
+	orNone := func(s string) string {
+		if s == "" {
+			return "none"
+		}
+		return s
+	}
 
-			// Check for typst.toml
-			manifestPath := filepath.Join(srcDir, "typst.toml")
-			if _, err := os.Stat(manifestPath); err != nil {
-				return fmt.Errorf("typst.toml not found in %s - a valid manifest is required", srcDir)
-			}
+	fmt.Fprintf(w, "Config file: %s\n", view.ConfigFile)
+	fmt.Fprintf(w, "Cache dir: %s (%s)\n", view.CacheDir, view.CacheDirSource)
+	fmt.Fprintf(w, "Profile: %s\n", orNone(view.Profile))
+	if view.TokenSource != "" {
+		fmt.Fprintf(w, "Access token: %s (%s)\n", view.AccessToken, view.TokenSource)
+	} else {
+		fmt.Fprintln(w, "Access token: none")
+	}
+	fmt.Fprintf(w, "Refresh token: %s\n", orNone(view.RefreshToken))
+	if !view.TokenExpiry.IsZero() {
+		fmt.Fprintf(w, "Token expiry: %s\n", view.TokenExpiry.Format(time.RFC3339))
+	}
+	if view.Licenses != nil {
+		fmt.Fprintf(w, "Allowed licenses: %s\n", orNone(strings.Join(view.Licenses.Allow, ", ")))
+		fmt.Fprintf(w, "Denied licenses: %s\n", orNone(strings.Join(view.Licenses.Deny, ", ")))
+	}
+	printMap(w, "Aliases", view.Aliases)
+	printMap(w, "Namespace profiles", view.NamespaceProfiles)
+}
 
-			// Determine output path
-			if output == "" {
-				// Use directory name with .tar.gz extension
-				output = filepath.Base(srcDir) + ".tar.gz"
-			}
+// printMap prints the entries of m sorted by key, under a title.
+func printMap(w io.Writer, title string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-			// Create package
-			creator := bundler.NewPackageCreator(exclude)
-			if err := creator.CreatePackage(srcDir, output); err != nil {
-				return fmt.Errorf("failed to create package: %w", err)
-			}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s = %s\n", k, m[k])
+	}
+}
 
-			fmt.Printf("Package created: %s\n", output)
-			return nil
-		},
+// configCmd groups the commands that inspect the configuration.
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
 	}
 
-	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file path (default: <directory>.tar.gz)")
-	cmd.Flags().StringSliceVarP(&exclude, "exclude", "e", []string{}, "Additional files/directories to exclude")
+	cmd.AddCommand(configShowCmd())
 
 	return cmd
 }
 
-// pushCmd uploads a package to the TPIX server.
-func pushCmd() *cobra.Command {
+// configShowCmd prints the effective configuration.
+func configShowCmd() *cobra.Command {
+	var jsonOutput bool
+
 	cmd := &cobra.Command{
-		Use:   "push <package.tar.gz> <namespace>",
-		Short: "Upload a package to the TPIX server",
-		Long: `Upload a .tar.gz Typst package to the TPIX server.
-The package must be a valid Typst package archive created with the bundle command.`,
-		Args: cobra.ExactArgs(2),
+		Use:   "show",
+		Short: "Print the effective configuration",
+		Long: `Print the configuration as tpix uses it, after applying environment variables
+and defaults: the config file location, the cache directory and where it comes
+from, the credentials and the settings of the config file. Tokens are shown as
+a fingerprint only.`,
+		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			packagePath := args[0]
-			namespace := args[1]
-
-			// Check if file exists
-			info, err := os.Stat(packagePath)
-			if err != nil {
-				return fmt.Errorf("failed to access package: %w", err)
-			}
-			if info.IsDir() {
-				return fmt.Errorf("%s is a directory, not a package file", packagePath)
-			}
-
 			cfg, err := config.Load()
 			if err != nil {
 				return err
 			}
 
-			// Check if user is logged in
-			if cfg.AccessToken == "" {
-				return fmt.Errorf("not logged in. Please run 'tpix login' first")
-			}
-
-			fmt.Printf("Uploading %s to namespace %s...\n", packagePath, namespace)
-
-			resp, err := api.UploadPackage(packagePath, namespace)
-			if err != nil {
-				return fmt.Errorf("upload failed: %w", err)
-			}
-
-			if resp.SHA256 != "" {
-				fmt.Printf("Successfully uploaded package: @%s/%s:%s\n", namespace, resp.Package, resp.Version)
-			} else {
-				fmt.Printf("Upload failed, report: \n")
-				for _, r := range resp.ValidateReport {
-					fmt.Printf("\t%s\n", r)
-				}
+			view := newConfigView(cfg)
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(view)
 			}
 
+			printConfigView(os.Stdout, view)
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the configuration as JSON")
+
 	return cmd
 }
 
+// formatDownloadProgress renders the state of a download, e.g.
+// "45.2% — 3.1 MB/s — ETA 8s". Trailing spaces overwrite the rest of a
+// longer line printed before.
+func formatDownloadProgress(ratio float32, speed float64, eta time.Duration) string {
+	s := fmt.Sprintf("%.1f%%", ratio*100)
+	if speed > 0 {
+		s += fmt.Sprintf(" — %s/s", utils.FormatSize(int64(speed)))
+		if eta > 0 {
+			s += fmt.Sprintf(" — ETA %s", eta.Round(time.Second))
+		}
+	}
+	return s + "    "
+}
+
+// noUpdateCheckEnv disables the update check of the version command when set.
+const noUpdateCheckEnv = "TPIX_NO_UPDATE_CHECK"
+
+// releaseCacheFile caches the latest GitHub release in the config directory.
+const releaseCacheFile = "latest-release.json"
+
+// newUpdater returns an updater that caches release lookups next to the
+// config file, unless --refresh is given.
+func newUpdater() *version.Updater {
+	return &version.Updater{
+		CacheFile: filepath.Join(filepath.Dir(config.FilePath()), releaseCacheFile),
+		Refresh:   api.Refresh,
+	}
+}
+
 // versionCmd shows the current version and checks for updates.
 func versionCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Show version information",
-		Long:  "Show the current version of tpix-cli and check for available updates",
-		Args:  cobra.ExactArgs(0),
+		Long: `Show the current version of tpix-cli and check for available updates.
+The latest release is looked up on GitHub at most once a day unless
+--refresh is given. Set ` + noUpdateCheckEnv + `=1 to skip the check.`,
+		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			fmt.Printf("tpix-cli version %s\n", version.FormatedVersion())
 
+			if v := os.Getenv(noUpdateCheckEnv); v != "" && v != "0" && v != "false" {
+				return nil
+			}
+
 			// Check for updates
-			updater := &version.Updater{}
+			updater := newUpdater()
 			hasUpdate, err := updater.Check()
 			if err != nil {
 				// Don't fail if update check fails, just warn
-				fmt.Printf("\nWarning: could not check for updates: %v\n", err)
+				warnf("could not check for updates: %v\n", err)
 				return nil
 			}
 
 			if hasUpdate {
 				latest, err := updater.Latest()
 				if err != nil {
-					fmt.Printf("\nWarning: could not get latest version info: %v\n", err)
+					warnf("could not get latest version info: %v\n", err)
 					return nil
 				}
 				fmt.Printf("\nA new version is available: %s\n", latest.Version)
@@ -564,54 +3848,88 @@ func versionCmd() *cobra.Command {
 
 // updateCmd upgrades tpix-cli to the latest version.
 func updateCmd() *cobra.Command {
+	var targetVersion string
+	var rollback bool
+
 	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update tpix-cli to the latest version",
-		Long:  "Download and install the latest version of tpix-cli from GitHub releases",
-		Args:  cobra.ExactArgs(0),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Println("Checking for updates...")
-
-			updater := &version.Updater{}
-			hasUpdate, err := updater.Check()
-			if err != nil {
-				return fmt.Errorf("failed to check for updates: %w", err)
-			}
+		Long: `Download and install the latest version of tpix-cli from GitHub releases.
+The latest release is looked up on GitHub at most once a day unless
+--refresh is given.
 
-			if !hasUpdate {
-				fmt.Println("You are already running the latest version.")
+--version installs a specific release instead, which may also be older than
+the running one. The replaced binary is kept, and --rollback restores it.`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rollback {
+				if err := version.Rollback(); err != nil {
+					return fmt.Errorf("rollback failed: %w", err)
+				}
+				summaryf("Restored the previous version of tpix-cli.\n")
 				return nil
 			}
 
-			latest, err := updater.Latest()
-			if err != nil {
-				return fmt.Errorf("failed to get latest version info: %w", err)
+			updater := newUpdater()
+			var latest *version.Release
+			if targetVersion != "" {
+				progressf("Looking up version %s...\n", targetVersion)
+
+				release, err := updater.UseVersion(targetVersion)
+				if err != nil {
+					return fmt.Errorf("version %s is not available: %w", targetVersion, err)
+				}
+				if c, err := version.Compare(release.Version, version.Version); err == nil && c == 0 {
+					summaryf("You are already running version %s.\n", release.Version)
+					return nil
+				}
+				latest = release
+			} else {
+				progressf("Checking for updates...\n")
+
+				hasUpdate, err := updater.Check()
+				if err != nil {
+					return fmt.Errorf("failed to check for updates: %w", err)
+				}
+
+				if !hasUpdate {
+					summaryf("You are already running the latest version.\n")
+					return nil
+				}
+
+				latest, err = updater.Latest()
+				if err != nil {
+					return fmt.Errorf("failed to get latest version info: %w", err)
+				}
 			}
 
-			fmt.Printf("Downloading version %s...\n", latest.Version)
+			progressf("Downloading version %s...\n", latest.Version)
 
-			progress, err := updater.Update()
+			progress, err := updater.Update(cmd.Context())
 			if err != nil {
 				return fmt.Errorf("failed to update: %w", err)
 			}
 
 			// Wait for download to complete
 			for ratio := range progress.Progress() {
-				// Simple progress indicator
-				fmt.Printf("\rDownloading... %.1f%%", ratio*100)
+				progressf("\rDownloading... %s", formatDownloadProgress(ratio, progress.Speed(), progress.ETA()))
 			}
-			fmt.Println("\rDownloading... 100%")
+			progressf("\rDownloading... 100%%%s\n", strings.Repeat(" ", 30))
 
 			if progress.Err != nil {
 				return fmt.Errorf("download failed: %w", progress.Err)
 			}
 
-			fmt.Printf("\nSuccessfully updated to version %s\n", latest.Version)
+			summaryf("\nSuccessfully updated to version %s\n", latest.Version)
 
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&targetVersion, "version", "", "Install this release, e.g. v1.2.3, instead of the latest one")
+	cmd.Flags().BoolVar(&rollback, "rollback", false, "Restore the version replaced by the last update")
+	cmd.MarkFlagsMutuallyExclusive("version", "rollback")
+
 	return cmd
 }
 
@@ -620,12 +3938,12 @@ func cachePathCmd() *cobra.Command {
 	var setPath string
 
 	cmd := &cobra.Command{
-		Use:   "cache-path",
+		Use:   "path",
 		Short: "Print or set the cache directory path",
 		Long: `Print or set the path where Typst packages are cached.
 
 The cache path can be set via:
-  1. The --set flag: tpix cache-path --set /custom/path
+  1. The --set flag: tpix cache path --set /custom/path
   2. The TYPST_PACKAGE_CACHE_PATH environment variable
 
 If neither is set, the default path is used:
@@ -650,7 +3968,7 @@ If neither is set, the default path is used:
 					}
 					cfg, _ = config.Load()
 
-					fmt.Printf("Cache path reset to: %s\n", cfg.TypstCachePkgPath)
+					summaryf("Cache path reset to: %s\n", cfg.TypstCachePkgPath)
 					return nil
 				}
 
@@ -672,7 +3990,7 @@ If neither is set, the default path is used:
 				}
 				cfg, _ = config.Load()
 
-				fmt.Printf("Cache path set to: %s\n", cfg.TypstCachePkgPath)
+				summaryf("Cache path set to: %s\n", cfg.TypstCachePkgPath)
 				return nil
 			}
 
@@ -689,3 +4007,200 @@ If neither is set, the default path is used:
 
 	return cmd
 }
+
+// legacyCachePathCmd is the cache-path command that predates the cache
+// command group.
+func legacyCachePathCmd() *cobra.Command {
+	cmd := cachePathCmd()
+	cmd.Use = "cache-path"
+	cmd.Deprecated = "use 'tpix cache path' instead"
+	return cmd
+}
+
+// cacheCmd groups the commands that manage the package cache as a whole.
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the package cache",
+	}
+
+	cmd.AddCommand(cachePathCmd())
+	cmd.AddCommand(cacheSizeCmd())
+	cmd.AddCommand(cacheCleanCmd())
+
+	return cmd
+}
+
+// cacheSizeCmd prints the disk space used by the package cache.
+func cacheSizeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "size",
+		Short: "Print the disk space used by the package cache",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
+				return fmt.Errorf("cache directory not configured")
+			}
+
+			cached, err := listCachedPackages(cacheDir, packageFilter{}, true)
+			if err != nil {
+				return err
+			}
+
+			var total int64
+			for _, pkg := range cached {
+				total += pkg.size
+			}
+			fmt.Printf("%s (%d bytes) in %d packages\n", utils.FormatSize(total), total, len(cached))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// checkCleanableCacheDir refuses cache directories that cannot sensibly be
+// emptied, such as a file system root or the home directory, which a
+// mistyped cache path could point to.
+func checkCleanableCacheDir(cacheDir string) error {
+	reason, err := protectedDirReason(cacheDir, false)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("refusing to clean %s: %s", cacheDir, reason)
+	}
+	return nil
+}
+
+// protectedDirReason tells why path must never be removed or emptied: it is
+// a file system root or contains the home directory, or, if withCwd is set,
+// the current directory. It returns an empty string for any other path.
+func protectedDirReason(path string, withCwd bool) (string, error) {
+	dir, err := resolvedAbs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.Dir(dir) == dir {
+		return "it is a file system root", nil
+	}
+	// The directory itself or any directory containing it
+	contains := func(other string) bool {
+		rel, err := filepath.Rel(dir, other)
+		return err == nil && !strings.HasPrefix(rel, "..")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if home, err := resolvedAbs(home); err == nil && contains(home) {
+			return "it contains the home directory", nil
+		}
+	}
+	if withCwd {
+		if cwd, err := os.Getwd(); err == nil {
+			if cwd, err := resolvedAbs(cwd); err == nil && contains(cwd) {
+				return "it contains the current directory", nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// resolvedAbs returns the absolute path of path with symlinks resolved, as
+// far as it exists.
+func resolvedAbs(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	return abs, nil
+}
+
+// cleanCache removes everything in cacheDir, keeping the directory itself.
+func cleanCache(cacheDir string) error {
+	if err := checkCleanableCacheDir(cacheDir); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(cacheDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// cacheCleanCmd removes all cached packages.
+func cacheCleanCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove all cached packages",
+		Long: `Remove all packages from the cache directory.
+
+The removal has to be confirmed interactively or with --yes, which is
+required when stdin is not a terminal. Cache directories that are a file
+system root or contain the home directory are never cleaned.`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			cacheDir := cfg.TypstCachePkgPath
+			if cacheDir == "" {
+				return fmt.Errorf("cache directory not configured")
+			}
+			if err := checkCleanableCacheDir(cacheDir); err != nil {
+				return err
+			}
+
+			cached, err := cachedPackages(cacheDir)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					summaryf("Cache is empty.\n")
+					return nil
+				}
+				return err
+			}
+
+			if !yes {
+				if !stdinIsTerminal() {
+					return fmt.Errorf("stdin is not a terminal, pass --yes to confirm removing all cached packages")
+				}
+				if !confirm(fmt.Sprintf("Remove all %d packages in %s?", len(cached), cacheDir)) {
+					summaryf("Nothing removed.\n")
+					return nil
+				}
+			}
+
+			if err := cleanCache(cacheDir); err != nil {
+				return err
+			}
+
+			summaryf("Removed %d packages from %s\n", len(cached), cacheDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Remove without asking for confirmation")
+
+	return cmd
+}
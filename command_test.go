@@ -0,0 +1,1196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/bundler"
+	"github.com/typstify/tpix-cli/config"
+	"github.com/typstify/tpix-cli/deps"
+)
+
+func TestGetProjectStatus(t *testing.T) {
+	projectDir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	source := `#import "@preview/cetz:0.3.0": canvas
+#import "@preview/tablex:0.0.6": tablex
+#import "@local/mytemplate:1.0.0": conf
+`
+	if err := os.WriteFile(filepath.Join(projectDir, "main.typ"), []byte(source), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	os.MkdirAll(filepath.Join(cacheDir, "preview", "cetz", "0.3.0"), 0755)
+
+	cfg := config.Config{AccessToken: "token", TypstCachePkgPath: cacheDir}
+
+	status, err := getProjectStatus(projectDir, cfg)
+	if err != nil {
+		t.Fatalf("getProjectStatus() error = %v", err)
+	}
+
+	wantDeps := []dependencyStatus{
+		{Package: "@preview/cetz:0.3.0", Cached: true},
+		{Package: "@preview/tablex:0.0.6", Cached: false},
+		{Package: "@local/mytemplate:1.0.0", Local: true},
+	}
+	if !reflect.DeepEqual(status.Dependencies, wantDeps) {
+		t.Errorf("Dependencies = %+v, want %+v", status.Dependencies, wantDeps)
+	}
+	if status.Lockfile != "missing" {
+		t.Errorf("Lockfile = %q, want missing", status.Lockfile)
+	}
+	if !status.LoggedIn || status.CacheDir != cacheDir {
+		t.Errorf("LoggedIn = %v, CacheDir = %q", status.LoggedIn, status.CacheDir)
+	}
+
+	lock := deps.NewLockfile([]deps.LockEntry{{Namespace: "preview", Name: "cetz", Version: "0.3.0"}})
+	lockPath := filepath.Join(projectDir, deps.LockFilename)
+	if err := lock.Write(lockPath); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	status, err = getProjectStatus(projectDir, cfg)
+	if err != nil {
+		t.Fatalf("getProjectStatus() error = %v", err)
+	}
+	if status.Lockfile != "out of date" {
+		t.Errorf("Lockfile = %q, want out of date", status.Lockfile)
+	}
+
+	lock.Merge([]deps.LockEntry{{Namespace: "preview", Name: "tablex", Version: "0.0.6"}})
+	if err := lock.Write(lockPath); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	status, err = getProjectStatus(projectDir, cfg)
+	if err != nil {
+		t.Fatalf("getProjectStatus() error = %v", err)
+	}
+	if status.Lockfile != "current" {
+		t.Errorf("Lockfile = %q, want current", status.Lockfile)
+	}
+
+	// @local packages are never looked up on the server
+	if outdated := findOutdated([]deps.Dependency{{Namespace: "local", Name: "mytemplate", Version: "1.0.0"}}); len(outdated) != 0 {
+		t.Errorf("findOutdated() = %+v, want none for @local packages", outdated)
+	}
+}
+
+func TestGetProjectDependencies(t *testing.T) {
+	projectDir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	source := `#import "@preview/tablex:0.0.6": tablex
+#import "@preview/cetz:0.3.0": canvas
+#import "@local/mytemplate:1.0.0": conf
+`
+	if err := os.WriteFile(filepath.Join(projectDir, "main.typ"), []byte(source), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	os.MkdirAll(filepath.Join(cacheDir, "preview", "cetz", "0.3.0"), 0755)
+
+	result, err := getProjectDependencies(projectDir, cacheDir)
+	if err != nil {
+		t.Fatalf("getProjectDependencies() error = %v", err)
+	}
+
+	want := &projectDependencies{
+		Project: projectDir,
+		Dependencies: []dependencyStatus{
+			{Package: "@local/mytemplate:1.0.0", Local: true},
+			{Package: "@preview/cetz:0.3.0", Cached: true},
+			{Package: "@preview/tablex:0.0.6", Cached: false},
+		},
+		Total:   3,
+		Cached:  1,
+		Missing: 1,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("getProjectDependencies() = %+v, want %+v", result, want)
+	}
+}
+
+func TestScanOptions(t *testing.T) {
+	projectDir := t.TempDir()
+	cacheDir := filepath.Join(projectDir, ".cache")
+	files := map[string]string{
+		"main.typ":                          `#import "@preview/cetz:0.3.0": canvas`,
+		"drafts/old.typ":                    `#import "@preview/tablex:0.0.6": tablex`,
+		".cache/preview/demo/0.1.0/lib.typ": `#import "@preview/oxifmt:0.2.1": strfmt`,
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	scan := scanOptions{exclude: []string{"drafts"}}
+	result, err := getProjectDependencies(projectDir, cacheDir, scan.options(cacheDir)...)
+	if err != nil {
+		t.Fatalf("getProjectDependencies() error = %v", err)
+	}
+	if len(result.Dependencies) != 1 || result.Dependencies[0].Package != "@preview/cetz:0.3.0" {
+		t.Errorf("dependencies = %+v, want only @preview/cetz:0.3.0", result.Dependencies)
+	}
+
+	// Without a cache dir, nothing else is excluded
+	result, err = getProjectDependencies(projectDir, "", (&scanOptions{}).options("")...)
+	if err != nil {
+		t.Fatalf("getProjectDependencies() error = %v", err)
+	}
+	if result.Total != 3 {
+		t.Errorf("found %d dependencies without exclusions, want 3", result.Total)
+	}
+}
+
+func TestPlanPush(t *testing.T) {
+	srcDir := t.TempDir()
+	manifest := `[package]
+name = "demo"
+version = "0.1.0"
+entrypoint = "lib.typ"
+`
+	os.WriteFile(filepath.Join(srcDir, "typst.toml"), []byte(manifest), 0644)
+	os.WriteFile(filepath.Join(srcDir, "lib.typ"), []byte("#let x = 1"), 0644)
+
+	archive := filepath.Join(t.TempDir(), "demo.tar.gz")
+	if err := bundler.NewPackageCreator(nil).CreatePackage(srcDir, archive); err != nil {
+		t.Fatalf("CreatePackage() error = %v", err)
+	}
+
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	sum := sha256.Sum256(data)
+
+	plan, err := planPush(archive, "preview")
+	if err != nil {
+		t.Fatalf("planPush() error = %v", err)
+	}
+
+	want := &pushPlan{
+		Archive:    archive,
+		Size:       int64(len(data)),
+		SHA256:     hex.EncodeToString(sum[:]),
+		Files:      2,
+		Package:    "demo",
+		Version:    "0.1.0",
+		Entrypoint: "lib.typ",
+		Namespace:  "preview",
+		Server:     api.ServerURL(),
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("planPush() = %+v, want %+v", plan, want)
+	}
+}
+
+func TestBundleToTemp(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "demo")
+	os.Mkdir(srcDir, 0755)
+	os.WriteFile(filepath.Join(srcDir, "typst.toml"), []byte("[package]\nname = \"demo\"\nversion = \"0.1.0\"\nentrypoint = \"lib.typ\"\n"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "lib.typ"), []byte("#let x = 1"), 0644)
+
+	archive, cleanup, err := bundleToTemp(srcDir)
+	if err != nil {
+		t.Fatalf("bundleToTemp() error = %v", err)
+	}
+	if filepath.Base(archive) != "demo.tar.gz" {
+		t.Errorf("archive = %s, want demo.tar.gz", archive)
+	}
+
+	plan, err := planPush(archive, "preview")
+	if err != nil {
+		t.Fatalf("planPush() error = %v", err)
+	}
+	if plan.Package != "demo" || plan.Files != 2 {
+		t.Errorf("planPush() = %+v, want package demo with 2 files", plan)
+	}
+
+	cleanup()
+	if _, err := os.Stat(filepath.Dir(archive)); !os.IsNotExist(err) {
+		t.Errorf("temporary directory left behind: %v", err)
+	}
+
+	if _, _, err := bundleToTemp(t.TempDir()); err == nil {
+		t.Error("bundleToTemp() expected error for a directory without typst.toml")
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	resp := &api.UploadResponse{
+		Status: http.StatusUnprocessableEntity,
+		ValidateReport: []string{
+			"package.version: 1.0 is not a valid version",
+			"warning: package.description: description is missing",
+			"entrypoint lib.typ not found",
+			"",
+		},
+	}
+
+	var buf bytes.Buffer
+	err := uploadRejected(&buf, resp)
+	if err == nil || err.Error() != "upload rejected with 2 error(s) and 1 warning(s)" {
+		t.Errorf("uploadRejected() error = %v", err)
+	}
+
+	want := `The server rejected the package:
+Errors:
+  package.version  1.0 is not a valid version
+  entrypoint lib.typ not found
+Warnings:
+  package.description  description is missing
+`
+	if got := buf.String(); got != want {
+		t.Errorf("uploadRejected() output =\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	err = uploadRejected(&buf, &api.UploadResponse{Status: http.StatusBadGateway})
+	if err == nil || !strings.Contains(err.Error(), "502 Bad Gateway") {
+		t.Errorf("uploadRejected() without report error = %v, want the HTTP status", err)
+	}
+}
+
+func TestFormatDownloadProgress(t *testing.T) {
+	tests := []struct {
+		ratio float32
+		speed float64
+		eta   time.Duration
+		want  string
+	}{
+		{0.452, 3.1 * 1024 * 1024, 8200 * time.Millisecond, "45.2% — 3.1 MB/s — ETA 8s"},
+		{0, 0, 0, "0.0%"},
+		{1, 2048, 0, "100.0% — 2.0 KB/s"},
+	}
+
+	for _, tt := range tests {
+		got := strings.TrimRight(formatDownloadProgress(tt.ratio, tt.speed, tt.eta), " ")
+		if got != tt.want {
+			t.Errorf("formatDownloadProgress(%v, %v, %v) = %q, want %q", tt.ratio, tt.speed, tt.eta, got, tt.want)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	origLookPath := lookPath
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	t.Cleanup(func() { lookPath = origLookPath })
+
+	cacheDir := t.TempDir()
+	cfg := config.Config{AccessToken: "secret-token", TypstCachePkgPath: cacheDir, TokenFromEnv: true}
+
+	var buf bytes.Buffer
+	printEnv(&buf, collectEnv(cfg))
+	out := buf.String()
+
+	for _, want := range []string{
+		"tpix version: ",
+		"Go version: go",
+		"OS/Arch: ",
+		"Config file: ",
+		"Server: https://tpix.typstify.com (default)\n",
+		"Cache dir: " + cacheDir + " (config file)\n",
+		"Logged in: yes, token from environment (TPIX_TOKEN)\n",
+		"Typst: not found\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret-token") {
+		t.Errorf("output contains the access token:\n%s", out)
+	}
+}
+
+func TestConfigShow(t *testing.T) {
+	cacheDir := t.TempDir()
+	cfg := config.Config{
+		AccessToken:       "secret-token",
+		RefreshToken:      "secret-refresh",
+		TypstCachePkgPath: cacheDir,
+		Aliases:           map[string]string{"i": "get --no-deps"},
+	}
+
+	view := newConfigView(cfg)
+	if view.AccessToken != tokenFingerprint("secret-token") || !strings.HasPrefix(view.AccessToken, "sha256:") {
+		t.Errorf("AccessToken = %q, want the fingerprint", view.AccessToken)
+	}
+
+	var buf bytes.Buffer
+	printConfigView(&buf, view)
+	out := buf.String()
+
+	for _, want := range []string{
+		"Config file: ",
+		"Cache dir: " + cacheDir + " (config file)\n",
+		"Profile: none\n",
+		"Access token: sha256:",
+		"(credential store)\n",
+		"Aliases:\n  i = get --no-deps\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("output contains a token:\n%s", out)
+	}
+}
+
+func TestReadToken(t *testing.T) {
+	const token = "tpix_0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		value   string
+		stdin   string
+		want    string
+		wantErr bool
+	}{
+		{"flag", token, "", token, false},
+		{"stdin", "-", token + "\n", token, false},
+		{"stdin without newline", "-", token, token, false},
+		{"empty stdin", "-", "", "", true},
+		{"too short", "abc", "", "", true},
+		{"whitespace", "tpix_0123 456789abcdef", "", "", true},
+		{"control character", "tpix_0123456789abcdef\x00", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readToken(strings.NewReader(tt.stdin), tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCacheFix(t *testing.T) {
+	statuses := map[string]api.VerifyStatus{
+		"good":    api.VerifyOK,
+		"corrupt": api.VerifyMismatch,
+		"gone":    api.VerifyMissingOnServer,
+	}
+	pkgs := []deps.Dependency{
+		{Namespace: "preview", Name: "good", Version: "1.0.0"},
+		{Namespace: "preview", Name: "corrupt", Version: "1.0.0"},
+		{Namespace: "myns", Name: "gone", Version: "1.0.0"},
+	}
+
+	origVerify, origDownload := verifyPackage, downloadPackage
+	t.Cleanup(func() { verifyPackage, downloadPackage = origVerify, origDownload })
+	verifyPackage = func(namespace, name, version, dir string) (api.VerifyStatus, error) {
+		return statuses[name], nil
+	}
+
+	setup := func(t *testing.T) string {
+		cacheDir := t.TempDir()
+		for _, pkg := range pkgs {
+			dir := filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version)
+			os.MkdirAll(dir, 0755)
+			os.WriteFile(filepath.Join(dir, "lib.typ"), []byte("#let x = 1"), 0644)
+		}
+		return cacheDir
+	}
+	exists := func(cacheDir string, parts ...string) bool {
+		_, err := os.Stat(filepath.Join(append([]string{cacheDir}, parts...)...))
+		return err == nil
+	}
+
+	t.Run("remove", func(t *testing.T) {
+		cacheDir := setup(t)
+		captureOutput(t, levelInfo)
+		downloadPackage = func(ctx context.Context, namespace, name, version string, onProgress api.ProgressFunc) error {
+			t.Errorf("unexpected download of %s", name)
+			return nil
+		}
+
+		res := verifyCache(context.Background(), cacheDir, pkgs, verifyOptions{fix: true})
+		if res != (verifyResult{ok: 1, removed: 2}) {
+			t.Errorf("verifyCache() = %+v, want 1 ok and 2 removed", res)
+		}
+		if !exists(cacheDir, "preview", "good", "1.0.0") {
+			t.Error("verified package was removed")
+		}
+		if exists(cacheDir, "preview", "corrupt") {
+			t.Error("corrupt package was not removed")
+		}
+		if exists(cacheDir, "myns") {
+			t.Error("unpublished package and its empty namespace were not removed")
+		}
+	})
+
+	t.Run("reinstall", func(t *testing.T) {
+		cacheDir := setup(t)
+		captureOutput(t, levelInfo)
+		var downloaded []string
+		downloadPackage = func(ctx context.Context, namespace, name, version string, onProgress api.ProgressFunc) error {
+			downloaded = append(downloaded, name)
+			return nil
+		}
+
+		res := verifyCache(context.Background(), cacheDir, pkgs, verifyOptions{fix: true, reinstall: true})
+		if res != (verifyResult{ok: 1, repaired: 1}) {
+			t.Errorf("verifyCache() = %+v, want 1 ok and 1 repaired", res)
+		}
+		if !reflect.DeepEqual(downloaded, []string{"corrupt"}) {
+			t.Errorf("downloaded %v, want [corrupt]", downloaded)
+		}
+		if !exists(cacheDir, "myns", "gone", "1.0.0") {
+			t.Error("package that cannot be downloaded again was removed")
+		}
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		cacheDir := setup(t)
+		out, _ := captureOutput(t, levelInfo)
+
+		res := verifyCache(context.Background(), cacheDir, pkgs, verifyOptions{})
+		if res != (verifyResult{ok: 1, failed: 1}) {
+			t.Errorf("verifyCache() = %+v, want 1 ok and 1 failed", res)
+		}
+		if !strings.Contains(out.String(), "@preview/corrupt:1.0.0: MISMATCH") {
+			t.Errorf("output = %q, want the mismatch reported", out.String())
+		}
+		if !exists(cacheDir, "preview", "corrupt", "1.0.0") {
+			t.Error("package was removed without --fix")
+		}
+	})
+}
+
+func TestParsePkgSpec(t *testing.T) {
+	tests := []struct {
+		spec                     string
+		namespace, name, version string
+		wantErr                  bool
+	}{
+		{spec: "@preview/cetz:0.3.0", namespace: "preview", name: "cetz", version: "0.3.0"},
+		{spec: "@preview/cetz", namespace: "preview", name: "cetz"},
+		{spec: "preview/cetz:0.3.0", namespace: "preview", name: "cetz", version: "0.3.0"},
+		{spec: " @preview/ cetz : 0.3.0 ", namespace: "preview", name: "cetz", version: "0.3.0"},
+		{spec: "@preview/cetz:0.3.0\n", namespace: "preview", name: "cetz", version: "0.3.0"},
+		{spec: "@preview/cetz:", wantErr: true},
+		{spec: "@preview/", wantErr: true},
+		{spec: "@/cetz", wantErr: true},
+		{spec: "@preview", wantErr: true},
+		{spec: "@preview/cetz/extra:0.3.0", wantErr: true},
+		{spec: "@preview/ce tz:0.3.0", wantErr: true},
+		{spec: "", wantErr: true},
+		{spec: "@../..:..", wantErr: true},
+		{spec: "@./cetz:0.3.0", wantErr: true},
+		{spec: "@preview/..:0.3.0", wantErr: true},
+		{spec: "@preview/cetz:.", wantErr: true},
+		{spec: `@preview/..\..:0.3.0`, wantErr: true},
+		{spec: `@preview\cetz/x:0.3.0`, wantErr: true},
+		{spec: "@preview/cetz:0.3.0..1", namespace: "preview", name: "cetz", version: "0.3.0..1"},
+	}
+	for _, tt := range tests {
+		namespace, name, version, err := parsePkgSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePkgSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if namespace != tt.namespace || name != tt.name || version != tt.version {
+			t.Errorf("parsePkgSpec(%q) = %q, %q, %q, want %q, %q, %q", tt.spec, namespace, name, version, tt.namespace, tt.name, tt.version)
+		}
+	}
+
+	if _, err := parseExactPkgSpec("@preview/cetz"); err == nil {
+		t.Error("parseExactPkgSpec() expected error without a version")
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	cfg := config.Config{NamespaceProfiles: map[string]string{"acme": "work"}}
+
+	tests := []struct {
+		as, namespace, want string
+	}{
+		{"", "acme", "work"},
+		{"", "preview", ""},
+		{"personal", "acme", "personal"},
+		{"personal", "preview", "personal"},
+	}
+	for _, tt := range tests {
+		if got := profileFor(cfg, tt.as, tt.namespace); got != tt.want {
+			t.Errorf("profileFor(%q, %q) = %q, want %q", tt.as, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestPackageFilter(t *testing.T) {
+	pkgs := []deps.Dependency{
+		{Namespace: "preview", Name: "cetz", Version: "0.3.0"},
+		{Namespace: "preview", Name: "cetz", Version: "0.2.2"},
+		{Namespace: "preview", Name: "tablex", Version: "0.0.6"},
+		{Namespace: "acme", Name: "cetz-plot", Version: "1.0.0"},
+	}
+
+	tests := []struct {
+		arg       string
+		namespace string
+		want      []string
+		wantErr   bool
+	}{
+		{arg: "", want: []string{"@preview/cetz:0.3.0", "@preview/cetz:0.2.2", "@preview/tablex:0.0.6", "@acme/cetz-plot:1.0.0"}},
+		{arg: "preview", want: []string{"@preview/cetz:0.3.0", "@preview/cetz:0.2.2", "@preview/tablex:0.0.6"}},
+		{arg: "@preview/cetz", want: []string{"@preview/cetz:0.3.0", "@preview/cetz:0.2.2"}},
+		{arg: "@preview/cetz:0.2.*", want: []string{"@preview/cetz:0.2.2"}},
+		{arg: "@preview/*", want: []string{"@preview/cetz:0.3.0", "@preview/cetz:0.2.2", "@preview/tablex:0.0.6"}},
+		{arg: "@*/cetz*", want: []string{"@preview/cetz:0.3.0", "@preview/cetz:0.2.2", "@acme/cetz-plot:1.0.0"}},
+		{namespace: "acme", want: []string{"@acme/cetz-plot:1.0.0"}},
+		{arg: "tablex", namespace: "preview", want: []string{"@preview/tablex:0.0.6"}},
+		{arg: "@preview/cetz", namespace: "acme", wantErr: true},
+		{arg: "@preview", wantErr: true},
+		{arg: "[", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg+"|"+tt.namespace, func(t *testing.T) {
+			f, err := newPackageFilter(tt.arg, tt.namespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPackageFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got []string
+			for _, pkg := range pkgs {
+				if f.match(pkg) {
+					got = append(got, pkg.Key())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListCachedPackages(t *testing.T) {
+	cacheDir := t.TempDir()
+	write := func(rel string, size int) {
+		path := filepath.Join(cacheDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, make([]byte, size), 0644)
+	}
+	write("preview/cetz/0.3.0/lib.typ", 300)
+	write("preview/cetz/0.3.0/src/draw.typ", 200)
+	write("preview/tablex/0.0.6/tablex.typ", 100)
+	write("acme/lib/1.0.0/lib.typ", 50)
+
+	filter, err := newPackageFilter("preview", "")
+	if err != nil {
+		t.Fatalf("newPackageFilter() error = %v", err)
+	}
+	got, err := listCachedPackages(cacheDir, filter, true)
+	if err != nil {
+		t.Fatalf("listCachedPackages() error = %v", err)
+	}
+
+	want := []cachedPackage{
+		{Dependency: deps.Dependency{Namespace: "preview", Name: "cetz", Version: "0.3.0"}, size: 500},
+		{Dependency: deps.Dependency{Namespace: "preview", Name: "tablex", Version: "0.0.6"}, size: 100},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listCachedPackages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCleanCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	os.MkdirAll(filepath.Join(cacheDir, "preview", "cetz", "0.3.0"), 0755)
+	os.WriteFile(filepath.Join(cacheDir, "preview", "cetz", "0.3.0", "lib.typ"), []byte("x"), 0644)
+
+	if err := cleanCache(cacheDir); err != nil {
+		t.Fatalf("cleanCache() error = %v", err)
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("cache directory was removed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("cache directory still contains %d entries", len(entries))
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	for _, dir := range []string{string(filepath.Separator), home, filepath.Dir(home)} {
+		if err := checkCleanableCacheDir(dir); err == nil {
+			t.Errorf("checkCleanableCacheDir(%q) succeeded, want error", dir)
+		}
+	}
+	if err := checkCleanableCacheDir(filepath.Join(home, ".cache", "typst")); err != nil {
+		t.Errorf("checkCleanableCacheDir() error = %v", err)
+	}
+}
+
+func TestFindVersion(t *testing.T) {
+	published := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	pkg := &api.PackageResponse{
+		Namespace: "preview",
+		Name:      "cetz",
+		Versions: []api.PackageVersionInfo{
+			{Version: "0.3.0", TypstVersion: "0.12.0", SHA256: "abc", PublishedAt: &published, Size: 2048},
+			{Version: "0.2.2", TypstVersion: "0.11.0"},
+		},
+	}
+
+	v, err := findVersion(pkg, "0.3.0")
+	if err != nil {
+		t.Fatalf("findVersion() error = %v", err)
+	}
+	var buf bytes.Buffer
+	printVersionInfo(&buf, v)
+	want := "Version: 0.3.0\nTypst: 0.12.0\nSHA256: abc\nPublished: 2025-01-02T03:04:05Z\nSize: 2.0 KB\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printVersionInfo() = %q, want %q", got, want)
+	}
+
+	_, err = findVersion(pkg, "1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "available versions: 0.3.0, 0.2.2") {
+		t.Errorf("findVersion() error = %v, want the available versions", err)
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		dest string
+		want string
+	}{
+		{dir, filepath.Join(dir, "cetz-0.3.0.tar.gz")},
+		{filepath.Join(dir, "new") + string(filepath.Separator), filepath.Join(dir, "new", "cetz-0.3.0.tar.gz")},
+		{filepath.Join(dir, "cetz.tar.gz"), filepath.Join(dir, "cetz.tar.gz")},
+	}
+
+	for _, tt := range tests {
+		got, err := archivePath(tt.dest, "cetz", "0.3.0")
+		if err != nil {
+			t.Fatalf("archivePath(%q) error = %v", tt.dest, err)
+		}
+		if got != tt.want {
+			t.Errorf("archivePath(%q) = %q, want %q", tt.dest, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultPackageName(t *testing.T) {
+	tests := map[string]string{
+		"chart":            "chart",
+		"/src/My Package":  "my-package",
+		"typst_utils-2":    "typst-utils-2",
+		"--Fancy  Name!--": "fancy-name",
+	}
+
+	for dir, want := range tests {
+		if got := defaultPackageName(dir); got != want {
+			t.Errorf("defaultPackageName(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestCheckChecksum(t *testing.T) {
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	for _, expected := range []string{sum, strings.ToUpper(sum), "sha256:" + sum} {
+		if err := checkChecksum(sum, expected); err != nil {
+			t.Errorf("checkChecksum(%q) error = %v", expected, err)
+		}
+	}
+	if err := checkChecksum(sum, "deadbeef"); !errors.Is(err, api.ErrChecksumMismatch) {
+		t.Errorf("checkChecksum() error = %v, want checksum mismatch", err)
+	}
+}
+
+func TestPublishedPackages(t *testing.T) {
+	latest := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	older := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	pkgs := []api.PackageResponse{
+		{
+			Namespace:     "preview",
+			Name:          "zebra",
+			LatestVersion: api.PackageVersionInfo{Version: "1.0.0", PublishedAt: &latest},
+		},
+		{
+			Namespace: "preview",
+			Name:      "alpha",
+			Versions: []api.PackageVersionInfo{
+				{Version: "0.1.0"},
+				{Version: "0.2.0", PublishedAt: &older},
+			},
+		},
+	}
+
+	got := publishedPackages(pkgs)
+	want := []publishedPackage{
+		{Package: "@preview/alpha", Latest: "0.2.0", Published: &older},
+		{Package: "@preview/zebra", Latest: "1.0.0", Published: &latest},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("publishedPackages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPrintPackageInfoDownloads(t *testing.T) {
+	total, downloads := int64(1500), int64(1200)
+	pkg := &api.PackageResponse{
+		License:   "MIT",
+		Downloads: &total,
+		Versions: []api.PackageVersionInfo{
+			{Version: "0.2.0", TypstVersion: "0.12.0", Downloads: &downloads},
+			{Version: "0.1.0", TypstVersion: "0.11.0"},
+		},
+	}
+
+	var buf bytes.Buffer
+	printPackageInfo(&buf, pkg)
+	out := buf.String()
+	for _, want := range []string{"Downloads: 1500\n", "  0.2.0 (Typst: 0.12.0, downloads: 1200)\n", "  0.1.0 (Typst: 0.11.0)\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printPackageInfo() = %q, want it to contain %q", out, want)
+		}
+	}
+
+	// Without download counts from the server, no download lines are shown
+	buf.Reset()
+	printPackageInfo(&buf, &api.PackageResponse{Versions: []api.PackageVersionInfo{{Version: "0.1.0"}}})
+	if strings.Contains(buf.String(), "ownloads") {
+		t.Errorf("printPackageInfo() = %q, want no download counts", buf.String())
+	}
+
+	buf.Reset()
+	printVersionInfo(&buf, &pkg.Versions[0])
+	if !strings.Contains(buf.String(), "Downloads: 1200\n") {
+		t.Errorf("printVersionInfo() = %q, want the download count", buf.String())
+	}
+}
+
+func TestCompatibleVersion(t *testing.T) {
+	pkg := &api.PackageResponse{
+		Versions: []api.PackageVersionInfo{
+			{Version: "0.1.0"},
+			{Version: "0.2.0", TypstVersion: "0.11.0"},
+			{Version: "0.3.0", TypstVersion: "0.12.0"},
+		},
+	}
+
+	tests := []struct {
+		typst string
+		want  string
+	}{
+		{"0.13.1", "0.3.0"},
+		{"0.12.0", "0.3.0"},
+		{"0.11.1", "0.2.0"},
+		{"0.10.0", "0.1.0"},
+	}
+	for _, tt := range tests {
+		if got := compatibleVersion(pkg, tt.typst); got != tt.want {
+			t.Errorf("compatibleVersion(%q) = %q, want %q", tt.typst, got, tt.want)
+		}
+	}
+
+	pkg.Versions = pkg.Versions[1:]
+	if got := compatibleVersion(pkg, "0.10.0"); got != "" {
+		t.Errorf("compatibleVersion() = %q, want none", got)
+	}
+}
+
+func TestCompatibleResults(t *testing.T) {
+	results := []api.SearchResult{
+		{Namespace: "preview", Name: "new", Description: "Needs a new Typst"},
+		{Namespace: "preview", Name: "old", Description: "Works anywhere"},
+		{Namespace: "preview", Name: "unchecked", Description: "Not fetched"},
+	}
+	fetched := map[string]*api.PackageResponse{
+		"@preview/new": {Versions: []api.PackageVersionInfo{{Version: "1.0.0", TypstVersion: "0.13.0"}}},
+		"@preview/old": {Versions: []api.PackageVersionInfo{{Version: "0.1.0"}}},
+	}
+
+	lines, unknown := compatibleResults(results, fetched, "0.12.0")
+	want := []string{
+		"@preview/old - Works anywhere (0.1.0 works with Typst 0.12.0)",
+		"@preview/unchecked - Not fetched (compatibility unknown)",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("compatibleResults() = %q, want %q", lines, want)
+	}
+	if unknown != 1 {
+		t.Errorf("compatibleResults() unknown = %d, want 1", unknown)
+	}
+}
+
+func TestParseTypstVersion(t *testing.T) {
+	tests := map[string]string{
+		"typst 0.12.0 (737895d7)": "0.12.0",
+		"typst 0.13.1":            "0.13.1",
+		"unknown":                 "",
+		"typst dev":               "",
+	}
+	for out, want := range tests {
+		if got := parseTypstVersion(out); got != want {
+			t.Errorf("parseTypstVersion(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
+
+func TestTypstCompatWarning(t *testing.T) {
+	v := &api.PackageVersionInfo{Version: "0.3.0", TypstVersion: "0.12.0"}
+
+	if msg := typstCompatWarning(v, "0.11.1"); !strings.Contains(msg, "requires Typst 0.12.0") {
+		t.Errorf("typstCompatWarning() = %q, want a warning", msg)
+	}
+	for _, typst := range []string{"0.12.0", "0.13.0", ""} {
+		if msg := typstCompatWarning(v, typst); msg != "" {
+			t.Errorf("typstCompatWarning(%q) = %q, want none", typst, msg)
+		}
+	}
+	if msg := typstCompatWarning(&api.PackageVersionInfo{Version: "0.1.0"}, "0.10.0"); msg != "" {
+		t.Errorf("typstCompatWarning() = %q, want none without a required version", msg)
+	}
+}
+
+func TestLocalTypstVersion(t *testing.T) {
+	origLookPath := lookPath
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	t.Cleanup(func() { lookPath = origLookPath })
+
+	if got := localTypstVersion(config.Config{TypstVersion: "0.11.0"}); got != "0.11.0" {
+		t.Errorf("localTypstVersion() = %q, want the configured version", got)
+	}
+	if got := localTypstVersion(config.Config{}); got != "" {
+		t.Errorf("localTypstVersion() = %q, want none without typst", got)
+	}
+}
+
+func TestSizeOptionsLimits(t *testing.T) {
+	o := &sizeOptions{maxFileSize: "1MB"}
+	limits, err := o.limits(config.Config{MaxFileSize: "2MB", MaxPackageSize: "3MB"})
+	if err != nil {
+		t.Fatalf("limits() error = %v", err)
+	}
+	want := bundler.SizeLimits{MaxFileSize: 1 << 20, MaxPackageSize: 3 << 20}
+	if limits != want {
+		t.Errorf("limits() = %+v, want %+v", limits, want)
+	}
+
+	limits, _ = (&sizeOptions{}).limits(config.Config{})
+	if limits.MaxFileSize != bundler.DefaultMaxFileSize || limits.MaxPackageSize != bundler.DefaultMaxPackageSize {
+		t.Errorf("limits() = %+v, want the defaults", limits)
+	}
+
+	if _, err := (&sizeOptions{maxPackageSize: "lots"}).limits(config.Config{}); err == nil || !strings.Contains(err.Error(), "--max-package-size") {
+		t.Errorf("limits() error = %v, want one naming the flag", err)
+	}
+	if _, err := (&sizeOptions{}).limits(config.Config{MaxFileSize: "lots"}); err == nil || !strings.Contains(err.Error(), "maxFileSize in the config file") {
+		t.Errorf("limits() error = %v, want one naming the config key", err)
+	}
+}
+
+func TestFormatSizeReport(t *testing.T) {
+	files := []bundler.ArchiveEntry{
+		{Name: "lib.typ", Size: 1024},
+		{Name: "manual.pdf", Size: 3 << 20},
+	}
+
+	limits := bundler.SizeLimits{MaxFileSize: 1 << 20}
+	got := formatSizeReport(bundler.CheckSize(files, limits), limits)
+	want := "1 file(s) larger than the 1.0 MB limit:\n  manual.pdf (3.0 MB)\n"
+	if got != want {
+		t.Errorf("formatSizeReport() = %q, want %q", got, want)
+	}
+
+	limits = bundler.SizeLimits{MaxPackageSize: 2 << 20}
+	got = formatSizeReport(bundler.CheckSize(files, limits), limits)
+	want = "package is 3.0 MB, more than the 2.0 MB limit, largest files:\n  manual.pdf (3.0 MB)\n  lib.typ (1.0 KB)\n"
+	if got != want {
+		t.Errorf("formatSizeReport() = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultExtractDir(t *testing.T) {
+	tests := map[string]string{
+		"@preview/cetz:0.3.0":    "cetz-0.3.0",
+		"dist/demo-0.1.0.tar.gz": "demo-0.1.0",
+		"demo.tgz":               "demo",
+		"demo.bin":               "demo.bin.extracted",
+	}
+	for source, want := range tests {
+		if got := defaultExtractDir(source); got != want {
+			t.Errorf("defaultExtractDir(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+// writeFiles creates files, given by slash-separated paths relative to dir,
+// along with their parent directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+}
+
+func TestExtractPackage(t *testing.T) {
+	cacheDir := t.TempDir()
+	cached := filepath.Join(cacheDir, "preview", "demo", "0.1.0")
+	writeFiles(t, cached, map[string]string{"lib.typ": "#let x = 1"})
+
+	dest := filepath.Join(t.TempDir(), "demo")
+	if err := extractPackage(context.Background(), cacheDir, "@preview/demo:0.1.0", dest); err != nil {
+		t.Fatalf("extractPackage() from the cache error = %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "lib.typ")); string(data) != "#let x = 1" {
+		t.Errorf("lib.typ = %q, want the cached file", data)
+	}
+
+	// A local archive
+	srcDir := t.TempDir()
+	writeFiles(t, srcDir, map[string]string{
+		"typst.toml": "[package]\nname = \"demo\"\nversion = \"0.2.0\"\nentrypoint = \"lib.typ\"\n",
+		"lib.typ":    "#let y = 2",
+	})
+	archive := filepath.Join(t.TempDir(), "demo-0.2.0.tar.gz")
+	if err := bundler.NewPackageCreator(nil).CreatePackage(srcDir, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prepareExtractDir(dest, false); err == nil {
+		t.Error("prepareExtractDir() expected error for a non-empty directory")
+	}
+	if err := prepareExtractDir(dest, true); err != nil {
+		t.Fatalf("prepareExtractDir() with force error = %v", err)
+	}
+	protected := []string{".", "..", string(filepath.Separator)}
+	if home, err := os.UserHomeDir(); err == nil {
+		protected = append(protected, home)
+	}
+	for _, dir := range protected {
+		if reason, err := protectedDirReason(dir, true); err != nil || reason == "" {
+			t.Errorf("protectedDirReason(%q) = %q, %v, want a reason", dir, reason, err)
+		}
+	}
+	// A symlink to a protected directory is protected as well
+	link := filepath.Join(t.TempDir(), "cwd")
+	if cwd, err := os.Getwd(); err == nil && os.Symlink(cwd, link) == nil {
+		if reason, _ := protectedDirReason(link, true); reason == "" {
+			t.Errorf("protectedDirReason(%q) = %q, want a reason", link, reason)
+		}
+	}
+	if reason, err := protectedDirReason(dest, true); err != nil || reason != "" {
+		t.Errorf("protectedDirReason(%q) = %q, %v, want none", dest, reason, err)
+	}
+	if err := extractPackage(context.Background(), cacheDir, archive, dest); err != nil {
+		t.Fatalf("extractPackage() from an archive error = %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "lib.typ")); string(data) != "#let y = 2" {
+		t.Errorf("lib.typ = %q, want the file from the archive", data)
+	}
+
+	if err := extractPackage(context.Background(), cacheDir, "@preview/demo", dest); err == nil {
+		t.Error("extractPackage() expected error without a version")
+	}
+
+	// An existing empty directory, such as the current one, is kept
+	empty := t.TempDir()
+	t.Chdir(empty)
+	if err := prepareExtractDir(".", false); err != nil {
+		t.Fatalf("prepareExtractDir() for an empty directory error = %v", err)
+	}
+	if err := extractPackage(context.Background(), cacheDir, archive, "."); err != nil {
+		t.Fatalf("extractPackage() into an empty directory error = %v", err)
+	}
+	entries, _ := os.ReadDir(empty)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"lib.typ", "typst.toml"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("extracted %v, want %v", names, want)
+	}
+}
+
+func TestCatPackageFile(t *testing.T) {
+	cacheDir := t.TempDir()
+	pkgDir := filepath.Join(cacheDir, "preview", "demo", "0.1.0")
+	writeFiles(t, pkgDir, map[string]string{"src/lib.typ": "#let x = 1"})
+	writeFiles(t, cacheDir, map[string]string{"secret.txt": "secret"})
+	if err := os.Symlink("src/lib.typ", filepath.Join(pkgDir, "link.typ")); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	if err := os.Symlink("../../../secret.txt", filepath.Join(pkgDir, "escape.txt")); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+
+	for _, file := range []string{"src/lib.typ", "link.typ"} {
+		var buf bytes.Buffer
+		if err := catPackageFile(&buf, cacheDir, "@preview/demo:0.1.0", file); err != nil {
+			t.Fatalf("catPackageFile(%q) error = %v", file, err)
+		}
+		if buf.String() != "#let x = 1" {
+			t.Errorf("catPackageFile(%q) = %q, want the file content", file, buf.String())
+		}
+	}
+
+	tests := []struct {
+		spec, file, wantErr string
+	}{
+		{"@preview/demo:0.1.0", "../../../secret.txt", "outside the package"},
+		{"@preview/demo:0.1.0", "escape.txt", "outside the package"},
+		{"@preview/demo:0.1.0", "missing.typ", "not found"},
+		{"@preview/demo:0.1.0", "src", "is a directory"},
+		{"@preview/demo:0.2.0", "lib.typ", "run 'tpix get @preview/demo:0.2.0' first"},
+	}
+	for _, tt := range tests {
+		err := catPackageFile(io.Discard, cacheDir, tt.spec, tt.file)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("catPackageFile(%q, %q) error = %v, want %q", tt.spec, tt.file, err, tt.wantErr)
+		}
+	}
+}
+
+func TestListPackageFiles(t *testing.T) {
+	cacheDir := t.TempDir()
+	pkgDir := filepath.Join(cacheDir, "preview", "demo", "0.1.0")
+	writeFiles(t, pkgDir, map[string]string{
+		"typst.toml":   "[package]\nname = \"demo\"\nversion = \"0.1.0\"\nentrypoint = \"lib.typ\"\n",
+		"lib.typ":      "#let x = 1",
+		"src/util.typ": "a",
+	})
+
+	want := []bundler.ArchiveEntry{
+		{Name: "lib.typ", Size: 10},
+		{Name: "src/util.typ", Size: 1},
+		{Name: "typst.toml", Size: 65},
+	}
+
+	got, err := listPackageFiles(cacheDir, "@preview/demo:0.1.0")
+	if err != nil {
+		t.Fatalf("listPackageFiles() from the cache error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listPackageFiles() = %v, want %v", got, want)
+	}
+
+	// The archive of the same files lists the same entries
+	archive := filepath.Join(t.TempDir(), "demo.tar.gz")
+	if err := bundler.NewPackageCreator(nil).CreatePackage(pkgDir, archive); err != nil {
+		t.Fatal(err)
+	}
+	got, err = listPackageFiles(cacheDir, archive)
+	if err != nil {
+		t.Fatalf("listPackageFiles() from an archive error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listPackageFiles() = %v, want %v", got, want)
+	}
+
+	if _, err := listPackageFiles(cacheDir, "@preview/demo:0.2.0"); err == nil {
+		t.Error("listPackageFiles() expected error for a package that is not cached")
+	}
+}
+
+func TestManifestColumns(t *testing.T) {
+	dir := t.TempDir()
+	if got := manifestColumns(dir); got != "(no manifest)\t" {
+		t.Errorf("manifestColumns() without typst.toml = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "typst.toml"), []byte("[package\n"), 0644)
+	if got := manifestColumns(dir); got != "(no manifest)\t" {
+		t.Errorf("manifestColumns() with an unreadable typst.toml = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "typst.toml"), []byte(`[package]
+name = "cetz"
+version = "0.3.0"
+entrypoint = "lib.typ"
+license = "LGPL-3.0-or-later"
+description = "Drawing with Typst"
+`), 0644)
+	if got, want := manifestColumns(dir), "LGPL-3.0-or-later\tDrawing with Typst"; got != want {
+		t.Errorf("manifestColumns() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0644)
+
+	tests := []struct {
+		dir  string
+		want checkStatus
+	}{
+		{dir, checkOK},
+		{"", checkFail},
+		{filepath.Join(dir, "missing"), checkWarn},
+		{file, checkFail},
+	}
+	for _, tt := range tests {
+		if got := checkCacheDir(tt.dir); got.Status != tt.want {
+			t.Errorf("checkCacheDir(%q) = %+v, want status %v", tt.dir, got, tt.want)
+		}
+	}
+
+	// The backup of an interrupted update is only reported
+	backup := filepath.Join(dir, "preview", "demo", ".1.0.0.old-.1.0.0.tmp-1")
+	if err := os.MkdirAll(backup, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkCacheDir(dir); got.Status != checkWarn || !strings.Contains(got.Detail, backup) {
+		t.Errorf("checkCacheDir() = %+v, want a warning naming %s", got, backup)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("backup was touched: %v", err)
+	}
+}
+
+func TestPrintDoctorReport(t *testing.T) {
+	checks := []doctorCheck{
+		{Name: "Config file", Detail: "settings.json"},
+		{Name: "Login", Status: checkWarn, Detail: "not logged in", Hint: "run 'tpix login'"},
+	}
+
+	var buf bytes.Buffer
+	if err := printDoctorReport(&buf, checks); err != nil {
+		t.Errorf("printDoctorReport() error = %v, want nil with warnings only", err)
+	}
+	want := "✓ Config file: settings.json\n! Login: not logged in\n    run 'tpix login'\n"
+	if buf.String() != want {
+		t.Errorf("printDoctorReport() = %q, want %q", buf.String(), want)
+	}
+
+	checks = append(checks, doctorCheck{Name: "Server", Status: checkFail, Detail: "unreachable"})
+	if err := printDoctorReport(io.Discard, checks); err == nil {
+		t.Error("printDoctorReport() expected error for a failed check")
+	}
+}
@@ -2,28 +2,86 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"time"
 )
 
 const (
 	appName        = "tpix-cli"
 	configFilename = "settings.json"
 	cachePathEnv   = "TYPST_PACKAGE_CACHE_PATH"
+	tokenEnv       = "TPIX_TOKEN"
+	configPathEnv  = "TPIX_CONFIG"
+
+	// configFileMode keeps the config file private, as it may hold tokens.
+	configFileMode = 0600
 )
 
 type Config struct {
-	AccessToken       string `json:"accessToken"`
+	// The tokens are kept in the credential store. They are only read from
+	// settings.json to migrate files written by older versions.
+	AccessToken       string `json:"accessToken,omitempty"`
 	RefreshToken      string `json:"refreshToken,omitempty"`
 	TypstCachePkgPath string `json:"typstCachePkgPath"`
+	// TokenExpiry is when AccessToken expires, or zero if unknown.
+	TokenExpiry time.Time `json:"tokenExpiry,omitzero"`
+	// Licenses restricts the licenses of packages installed by get and pull.
+	Licenses *LicensePolicy `json:"licenses,omitempty"`
+	// TokenFromEnv is set if AccessToken was taken from the TPIX_TOKEN
+	// environment variable. Such a token is never saved or refreshed.
+	TokenFromEnv bool `json:"-"`
+	// Aliases maps command shortcuts to their expansion, e.g. "i" to
+	// "get --no-deps".
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// NamespaceProfiles maps a namespace to the profile whose credentials
+	// are used for get and push in that namespace.
+	NamespaceProfiles map[string]string `json:"namespaceProfiles,omitempty"`
+	// MaxExtractSize overrides the limit on the size of extracted archives,
+	// e.g. "2GB". The --max-extract-size flag takes precedence.
+	MaxExtractSize string `json:"maxExtractSize,omitempty"`
+	// TypstVersion is the Typst version packages are checked against, e.g.
+	// "0.12.0". If empty, the version of the typst binary on the PATH is
+	// used.
+	TypstVersion string `json:"typstVersion,omitempty"`
+	// MaxFileSize and MaxPackageSize override the sizes, e.g. "10MB", above
+	// which bundle and push warn about a file or a whole package.
+	MaxFileSize    string `json:"maxFileSize,omitempty"`
+	MaxPackageSize string `json:"maxPackageSize,omitempty"`
+
+	// savedCachePath is TypstCachePkgPath as found in the config file, and
+	// detectedCachePath the path Load used instead, from the environment
+	// or the default location. A detected path is never saved, so that it
+	// is detected again on the next run, like Typst does.
+	savedCachePath    string
+	detectedCachePath string
+}
+
+// LicensePolicy lists SPDX license identifiers that are allowed or denied.
+// An empty allowlist allows every license that is not denied.
+type LicensePolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
 }
 
 var (
 	configDir string
+	// configName is the name of the config file in configDir.
+	configName = configFilename
 )
 
 func init() {
+	// The config file given in the environment replaces the default one
+	if path := os.Getenv(configPathEnv); path != "" {
+		if err := UseConfigFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid %s: %v\n", configPathEnv, err)
+		}
+		return
+	}
+
 	dir, err := getConfigDir()
 	if err != nil {
 		fmt.Println("Get config dir error: ", err)
@@ -34,15 +92,19 @@ func init() {
 }
 
 func Load() (Config, error) {
-	path := filepath.Join(configDir, configFilename)
+	path := FilePath()
 
-	configFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	configFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, configFileMode)
 	if err != nil {
 		return Config{}, err
 	}
 
 	defer configFile.Close()
 
+	if err := restrictPermissions(configFile); err != nil {
+		return Config{}, err
+	}
+
 	var appConfig Config
 
 	err = json.NewDecoder(configFile).Decode(&appConfig)
@@ -50,6 +112,19 @@ func Load() (Config, error) {
 		return Config{}, err
 	}
 
+	if err := loadCredentials(&appConfig); err != nil {
+		return Config{}, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	// A token in the environment takes precedence over stored credentials,
+	// for non-interactive use such as CI
+	if token := os.Getenv(tokenEnv); token != "" {
+		appConfig.setCredentials(Credentials{AccessToken: token})
+		appConfig.TokenFromEnv = true
+	}
+
+	appConfig.savedCachePath = appConfig.TypstCachePkgPath
+
 	// If user provided a env variable, use it instead of the one in the config file
 	envPath := os.Getenv(cachePathEnv)
 	if envPath != "" {
@@ -67,12 +142,14 @@ func Load() (Config, error) {
 		}
 
 		appConfig.TypstCachePkgPath = absPath
+		appConfig.detectedCachePath = absPath
 		return appConfig, nil
 	}
 
 	// No env is set, try to use a detected cache path.
 	if appConfig.TypstCachePkgPath == "" {
 		appConfig.TypstCachePkgPath = defaultCacheDir()
+		appConfig.detectedCachePath = appConfig.TypstCachePkgPath
 	}
 
 	return appConfig, nil
@@ -80,16 +157,33 @@ func Load() (Config, error) {
 }
 
 func Save(cfg Config) error {
-	path := filepath.Join(configDir, configFilename)
-	configFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if !cfg.TokenFromEnv {
+		if err := credentialStore().Save(cfg.credentials()); err != nil {
+			return fmt.Errorf("failed to save credentials: %w", err)
+		}
+	}
+
+	return writeSettings(cfg)
+}
+
+// writeSettings writes everything but the credentials in cfg to settings.json.
+func writeSettings(cfg Config) error {
+	cfg.setCredentials(Credentials{})
+
+	path := FilePath()
+	configFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, configFileMode)
 	if err != nil {
 		return err
 	}
 
 	defer configFile.Close()
 
-	if cfg.TypstCachePkgPath == "" {
-		cfg.TypstCachePkgPath = defaultCacheDir()
+	if err := restrictPermissions(configFile); err != nil {
+		return err
+	}
+
+	if cfg.detectedCachePath != "" && cfg.TypstCachePkgPath == cfg.detectedCachePath {
+		cfg.TypstCachePkgPath = cfg.savedCachePath
 	}
 
 	err = json.NewEncoder(configFile).Encode(&cfg)
@@ -100,6 +194,106 @@ func Save(cfg Config) error {
 	return nil
 }
 
+// FilePath returns the location of the config file.
+func FilePath() string {
+	return filepath.Join(configDir, configName)
+}
+
+// UseConfigFile makes Load and Save use the config file at path instead of
+// settings.json in the user config directory, for the rest of the process.
+// Credentials that are not kept in the system keychain are stored next to
+// it. The directory of path is created if it does not exist.
+func UseConfigFile(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(absPath); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory, not a config file", path)
+	}
+
+	dir := filepath.Dir(absPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	configDir, configName = dir, filepath.Base(absPath)
+	return nil
+}
+
+// CachePathSource describes where the cache path of a loaded config comes
+// from: the environment, the config file or the default location.
+func CachePathSource(cfg Config) string {
+	if os.Getenv(cachePathEnv) != "" {
+		return "environment (" + cachePathEnv + ")"
+	}
+	if cfg.TypstCachePkgPath == defaultCacheDir() {
+		return "default"
+	}
+	return "config file"
+}
+
+// restrictPermissions makes a config file created by an older version,
+// readable by other users, private to the current user.
+func restrictPermissions(f *os.File) error {
+	// Windows does not support Unix permission bits
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&^configFileMode == 0 {
+		return nil
+	}
+
+	if err := f.Chmod(configFileMode); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s was accessible by other users, its permissions were changed to %o\n", f.Name(), configFileMode)
+	return nil
+}
+
+// loadCredentials fills in the credentials of cfg from the credential store.
+// Tokens found in settings.json are moved to the store of the default
+// credentials first.
+func loadCredentials(cfg *Config) error {
+	if legacy := cfg.credentials(); !legacy.empty() {
+		if err := profileStore("").Save(legacy); err != nil {
+			return err
+		}
+		if err := writeSettings(*cfg); err != nil {
+			return err
+		}
+		if profile == "" {
+			return nil
+		}
+	}
+
+	creds, err := credentialStore().Load()
+	if err != nil {
+		return err
+	}
+	cfg.setCredentials(creds)
+	return nil
+}
+
+func (cfg *Config) credentials() Credentials {
+	return Credentials{
+		AccessToken:  cfg.AccessToken,
+		RefreshToken: cfg.RefreshToken,
+		TokenExpiry:  cfg.TokenExpiry,
+	}
+}
+
+func (cfg *Config) setCredentials(c Credentials) {
+	cfg.AccessToken = c.AccessToken
+	cfg.RefreshToken = c.RefreshToken
+	cfg.TokenExpiry = c.TokenExpiry
+}
+
 func getConfigDir() (string, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
@@ -124,7 +318,7 @@ func getConfigDir() (string, error) {
 // defaultCacheDir returns the default typst package cache dir, according to
 // https://github.com/typst/packages/blob/main/README.md.
 func defaultCacheDir() string {
-	dir, err := os.UserCacheDir()
+	dir, err := userCacheDir()
 	if err != nil {
 		return ""
 	}
@@ -141,3 +335,23 @@ func defaultCacheDir() string {
 
 	return cacheDir
 }
+
+// userCacheDir returns the cache directory of the user the way Typst finds
+// it. On Unix systems other than macOS, $XDG_CACHE_HOME is used if it is an
+// absolute path and ~/.cache otherwise, whereas os.UserCacheDir fails for a
+// relative $XDG_CACHE_HOME.
+func userCacheDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return os.UserCacheDir()
+	}
+
+	if dir := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", errors.New("neither $XDG_CACHE_HOME nor $HOME are defined")
+	}
+	return filepath.Join(home, ".cache"), nil
+}
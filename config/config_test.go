@@ -1,11 +1,21 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+
+	"github.com/zalando/go-keyring"
 )
 
+func TestMain(m *testing.M) {
+	// Never touch the keychain of the user running the tests
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
 func TestLoadEmptyConfig(t *testing.T) {
 	// Create a temporary config directory
 	tmpDir := t.TempDir()
@@ -68,6 +78,79 @@ func TestLoadWithEnvVar(t *testing.T) {
 	}
 }
 
+func TestCacheDirResolution(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG directories are only used on Linux")
+	}
+
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home")
+	xdg := filepath.Join(tmpDir, "xdg-cache")
+	env := filepath.Join(tmpDir, "env-cache")
+	saved := filepath.Join(tmpDir, "saved-cache")
+	os.MkdirAll(env, 0755)
+
+	tests := []struct {
+		name      string
+		xdgCache  string
+		cachePath string
+		savedPath string
+		want      string
+		wantSaved string
+	}{
+		{name: "home", want: filepath.Join(home, ".cache", "typst", "packages")},
+		{name: "XDG_CACHE_HOME", xdgCache: xdg, want: filepath.Join(xdg, "typst", "packages")},
+		{name: "relative XDG_CACHE_HOME", xdgCache: "relative/cache", want: filepath.Join(home, ".cache", "typst", "packages")},
+		{name: "TYPST_PACKAGE_CACHE_PATH", xdgCache: xdg, cachePath: env, want: env},
+		{name: "TYPST_PACKAGE_CACHE_PATH and saved path", cachePath: env, savedPath: saved, want: env, wantSaved: saved},
+		{name: "saved path", xdgCache: xdg, savedPath: saved, want: saved, wantSaved: saved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origConfigDir := configDir
+			configDir = t.TempDir()
+			defer func() { configDir = origConfigDir }()
+
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CACHE_HOME", tt.xdgCache)
+			t.Setenv(cachePathEnv, tt.cachePath)
+			if tt.savedPath != "" {
+				if err := os.WriteFile(filepath.Join(configDir, configFilename), []byte(`{"typstCachePkgPath":"`+tt.savedPath+`"}`), 0600); err != nil {
+					t.Fatalf("WriteFile() error = %v", err)
+				}
+			}
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.TypstCachePkgPath != tt.want {
+				t.Errorf("Load() cache path = %v, want %v", cfg.TypstCachePkgPath, tt.want)
+			}
+
+			// A path from the environment or the default location is not saved
+			if err := Save(cfg); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			t.Setenv(cachePathEnv, "")
+			t.Setenv("XDG_CACHE_HOME", "")
+			data, _ := os.ReadFile(filepath.Join(configDir, configFilename))
+			var file Config
+			json.Unmarshal(data, &file)
+			if file.TypstCachePkgPath != tt.wantSaved {
+				t.Errorf("saved cache path = %q, want %q", file.TypstCachePkgPath, tt.wantSaved)
+			}
+		})
+	}
+
+	t.Setenv("HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	if _, err := userCacheDir(); err == nil {
+		t.Error("userCacheDir() expected error without HOME and XDG_CACHE_HOME")
+	}
+}
+
 func TestLoadWithInvalidEnvVar(t *testing.T) {
 	tmpDir := t.TempDir()
 	origConfigDir := configDir
@@ -107,6 +190,39 @@ func TestSaveAndLoad(t *testing.T) {
 	}
 }
 
+func TestUseConfigFile(t *testing.T) {
+	origConfigDir, origConfigName := configDir, configName
+	defer func() { configDir, configName = origConfigDir, origConfigName }()
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "accounts", "work.json")
+	if err := UseConfigFile(path); err != nil {
+		t.Fatalf("UseConfigFile() error = %v", err)
+	}
+	if FilePath() != path {
+		t.Errorf("FilePath() = %v, want %v", FilePath(), path)
+	}
+
+	cfg := Config{TypstCachePkgPath: filepath.Join(tmpDir, "cache")}
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("config file not written to %s: %v", path, err)
+	}
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.TypstCachePkgPath != cfg.TypstCachePkgPath {
+		t.Errorf("Load() = %v, want %v", loaded.TypstCachePkgPath, cfg.TypstCachePkgPath)
+	}
+
+	if err := UseConfigFile(tmpDir); err == nil {
+		t.Error("UseConfigFile() expected error for a directory")
+	}
+}
+
 func TestSaveEmptyPath(t *testing.T) {
 	tmpDir := t.TempDir()
 	origConfigDir := configDir
@@ -133,3 +249,42 @@ func TestSaveEmptyPath(t *testing.T) {
 		t.Errorf("Load() = %v, want %v", loadedCfg.TypstCachePkgPath, want)
 	}
 }
+
+func TestConfigFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions are not supported on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	origConfigDir := configDir
+	configDir = tmpDir
+	defer func() { configDir = origConfigDir }()
+
+	configPath := filepath.Join(tmpDir, configFilename)
+
+	if err := Save(Config{TypstCachePkgPath: tmpDir}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	assertMode(t, configPath, 0600)
+
+	// Files written by older versions are made private on load
+	if err := os.Chmod(configPath, 0644); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	if _, err := Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	assertMode(t, configPath, 0600)
+}
+
+func assertMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if got := info.Mode().Perm(); got != want {
+		t.Errorf("mode of %s = %o, want %o", filepath.Base(path), got, want)
+	}
+}
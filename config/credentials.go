@@ -0,0 +1,178 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	keychainService     = appName
+	keychainUser        = "credentials"
+	credentialsFilename = "credentials.json"
+)
+
+// Credentials are the secrets of the logged in user. They are kept out of
+// settings.json, in the OS keychain if there is one.
+type Credentials struct {
+	AccessToken  string    `json:"accessToken,omitempty"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	TokenExpiry  time.Time `json:"tokenExpiry,omitzero"`
+}
+
+func (c Credentials) empty() bool {
+	return c.AccessToken == "" && c.RefreshToken == ""
+}
+
+// CredentialStore persists the credentials of the logged in user.
+type CredentialStore interface {
+	// Load returns the stored credentials, which are empty if there are none.
+	Load() (Credentials, error)
+	// Save stores c, replacing any stored credentials.
+	Save(c Credentials) error
+	// Delete removes the stored credentials.
+	Delete() error
+}
+
+// profile names the credentials used by Load and Save. The empty string
+// selects the default credentials.
+var profile string
+
+var profileNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// UseProfile makes Load and Save use the credentials stored for the named
+// profile instead of the default ones, for the rest of the process. Other
+// settings are shared by all profiles.
+func UseProfile(name string) error {
+	if !profileNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, only letters, digits, '-' and '_' are allowed", name)
+	}
+	profile = name
+	return nil
+}
+
+// Profile returns the profile selected with UseProfile, or the empty string
+// for the default credentials.
+func Profile() string {
+	return profile
+}
+
+// credentialStore returns the store of the credentials selected with
+// UseProfile.
+var credentialStore = func() CredentialStore {
+	return profileStore(profile)
+}
+
+// profileStore returns the store the credentials of the named profile are
+// kept in: the OS keychain (macOS Keychain, Windows Credential Manager or
+// the Secret Service on Linux) if it is available, otherwise a file only
+// readable by the user.
+func profileStore(name string) CredentialStore {
+	user, filename := keychainUser, credentialsFilename
+	if name != "" {
+		user += ":" + name
+		filename = "credentials-" + name + ".json"
+	}
+
+	if keychainAvailable() {
+		return keychainStore{user: user}
+	}
+	return fileStore{path: filepath.Join(configDir, filename)}
+}
+
+// keychainAvailable probes the keychain once per process.
+var keychainAvailable = sync.OnceValue(func() bool {
+	_, err := keyring.Get(keychainService, keychainUser)
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+})
+
+// keychainStore keeps the credentials in the OS keychain, as the password
+// of user.
+type keychainStore struct {
+	user string
+}
+
+func (s keychainStore) Load() (Credentials, error) {
+	var c Credentials
+	data, err := keyring.Get(keychainService, s.user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal([]byte(data), &c)
+	return c, err
+}
+
+func (s keychainStore) Save(c Credentials) error {
+	if c.empty() {
+		return s.Delete()
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(keychainService, s.user, string(data))
+}
+
+func (s keychainStore) Delete() error {
+	err := keyring.Delete(keychainService, s.user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// fileStore keeps the credentials in a JSON file with 0600 permissions,
+// for systems without a keychain.
+type fileStore struct {
+	path string
+}
+
+func (s fileStore) Load() (Credentials, error) {
+	var c Credentials
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func (s fileStore) Save(c Credentials) error {
+	if c.empty() {
+		return s.Delete()
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(s.path, 0600)
+}
+
+func (s fileStore) Delete() error {
+	err := os.Remove(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
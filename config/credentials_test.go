@@ -0,0 +1,185 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveKeepsCredentialsOutOfSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	origConfigDir := configDir
+	configDir = tmpDir
+	defer func() { configDir = origConfigDir }()
+
+	cfg := Config{
+		AccessToken:       "access-secret",
+		RefreshToken:      "refresh-secret",
+		TypstCachePkgPath: filepath.Join(tmpDir, "cache"),
+	}
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	defer credentialStore().Delete()
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, configFilename))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("settings.json contains credentials: %s", data)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.AccessToken != cfg.AccessToken || loaded.RefreshToken != cfg.RefreshToken {
+		t.Errorf("Load() tokens = %q, %q, want %q, %q", loaded.AccessToken, loaded.RefreshToken, cfg.AccessToken, cfg.RefreshToken)
+	}
+}
+
+func TestLoadMigratesLegacyTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	origConfigDir := configDir
+	configDir = tmpDir
+	defer func() { configDir = origConfigDir }()
+
+	configPath := filepath.Join(tmpDir, configFilename)
+	os.WriteFile(configPath, []byte(`{"accessToken":"legacy-secret","typstCachePkgPath":"`+tmpDir+`"}`), 0644)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer credentialStore().Delete()
+
+	if cfg.AccessToken != "legacy-secret" {
+		t.Errorf("Load() AccessToken = %q, want legacy-secret", cfg.AccessToken)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if strings.Contains(string(data), "legacy-secret") {
+		t.Errorf("token was not removed from settings.json: %s", data)
+	}
+
+	creds, err := credentialStore().Load()
+	if err != nil {
+		t.Fatalf("credential store Load() error = %v", err)
+	}
+	if creds.AccessToken != "legacy-secret" {
+		t.Errorf("stored AccessToken = %q, want legacy-secret", creds.AccessToken)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), credentialsFilename)
+	store := fileStore{path: path}
+
+	if err := store.Save(Credentials{AccessToken: "secret"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("credentials file mode = %o, want 600", mode)
+	}
+
+	creds, err := store.Load()
+	if err != nil || creds.AccessToken != "secret" {
+		t.Errorf("Load() = %+v, %v", creds, err)
+	}
+
+	// Saving empty credentials, e.g. on logout, removes the file
+	if err := store.Save(Credentials{}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("credentials file still exists: %v", err)
+	}
+}
+
+func TestLoadTokenFromEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	origConfigDir := configDir
+	configDir = tmpDir
+	defer func() { configDir = origConfigDir }()
+
+	stored := Config{AccessToken: "stored", RefreshToken: "refresh", TypstCachePkgPath: tmpDir}
+	if err := Save(stored); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	defer credentialStore().Delete()
+
+	t.Setenv(tokenEnv, "from-env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AccessToken != "from-env" || cfg.RefreshToken != "" || !cfg.TokenFromEnv {
+		t.Errorf("Load() = %+v, want the token from %s without a refresh token", cfg, tokenEnv)
+	}
+
+	// Saving must not persist the token from the environment
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	creds, err := credentialStore().Load()
+	if err != nil {
+		t.Fatalf("credential store Load() error = %v", err)
+	}
+	if creds.AccessToken != "stored" {
+		t.Errorf("stored AccessToken = %q, want stored", creds.AccessToken)
+	}
+}
+
+func TestUseProfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	origConfigDir := configDir
+	configDir = tmpDir
+	t.Cleanup(func() {
+		configDir = origConfigDir
+		profile = ""
+	})
+
+	if err := Save(Config{AccessToken: "default-token", TypstCachePkgPath: tmpDir}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	defer profileStore("").Delete()
+
+	if err := UseProfile("work"); err != nil {
+		t.Fatalf("UseProfile() error = %v", err)
+	}
+	defer profileStore("work").Delete()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AccessToken != "" {
+		t.Errorf("Load() AccessToken = %q, want none for a new profile", cfg.AccessToken)
+	}
+
+	cfg.AccessToken = "work-token"
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if cfg, _ := Load(); cfg.AccessToken != "work-token" {
+		t.Errorf("Load() AccessToken = %q, want work-token", cfg.AccessToken)
+	}
+
+	// The default credentials are not affected by the profile
+	profile = ""
+	if cfg, _ := Load(); cfg.AccessToken != "default-token" {
+		t.Errorf("Load() AccessToken = %q, want default-token", cfg.AccessToken)
+	}
+
+	if err := UseProfile("../escape"); err == nil {
+		t.Error("UseProfile() expected error for invalid name")
+	}
+}
@@ -0,0 +1,118 @@
+package deps
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	// LockFilename is the name of the lock file written to a project directory.
+	LockFilename = "tpix.lock"
+
+	lockfileVersion = 1
+)
+
+// LockEntry pins a resolved package to an exact version and checksum.
+type LockEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// Dependency returns the package the entry refers to.
+func (e LockEntry) Dependency() Dependency {
+	return Dependency{Namespace: e.Namespace, Name: e.Name, Version: e.Version}
+}
+
+// Lockfile records every package resolved for a project so that the exact
+// same set can be installed on another machine.
+type Lockfile struct {
+	Version  int         `json:"version"`
+	Packages []LockEntry `json:"packages"`
+}
+
+// NewLockfile creates a lock file holding entries.
+func NewLockfile(entries []LockEntry) *Lockfile {
+	l := &Lockfile{Version: lockfileVersion}
+	l.Merge(entries)
+	return l
+}
+
+// ReadLockfile reads a lock file from path.
+func ReadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var l Lockfile
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if l.Version > lockfileVersion {
+		return nil, fmt.Errorf("unsupported lock file version %d", l.Version)
+	}
+
+	return &l, nil
+}
+
+// Write writes the lock file to path with its entries sorted by package.
+func (l *Lockfile) Write(path string) error {
+	l.sort()
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Merge adds entries to the lock file, replacing existing entries for the
+// same package version.
+func (l *Lockfile) Merge(entries []LockEntry) {
+	for _, entry := range entries {
+		replaced := false
+		for i := range l.Packages {
+			if l.Packages[i].Dependency().Key() == entry.Dependency().Key() {
+				l.Packages[i] = entry
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			l.Packages = append(l.Packages, entry)
+		}
+	}
+	l.sort()
+}
+
+// Contains reports whether dep is pinned in the lock file.
+func (l *Lockfile) Contains(dep Dependency) bool {
+	for _, entry := range l.Packages {
+		if entry.Dependency().Key() == dep.Key() {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether every dependency in deps is pinned in the lock file.
+func (l *Lockfile) Covers(deps []Dependency) bool {
+	for _, dep := range deps {
+		if !l.Contains(dep) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *Lockfile) sort() {
+	sort.Slice(l.Packages, func(i, j int) bool {
+		return l.Packages[i].Dependency().Key() < l.Packages[j].Dependency().Key()
+	})
+}
@@ -0,0 +1,60 @@
+package deps
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLockfileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFilename)
+
+	lock := NewLockfile([]LockEntry{
+		{Namespace: "preview", Name: "tablex", Version: "0.0.6", SHA256: "bbb"},
+		{Namespace: "preview", Name: "cetz", Version: "0.3.0", SHA256: "aaa"},
+	})
+	if err := lock.Write(path); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	got, err := ReadLockfile(path)
+	if err != nil {
+		t.Fatalf("ReadLockfile() error = %v", err)
+	}
+
+	want := &Lockfile{
+		Version: lockfileVersion,
+		Packages: []LockEntry{
+			{Namespace: "preview", Name: "cetz", Version: "0.3.0", SHA256: "aaa"},
+			{Namespace: "preview", Name: "tablex", Version: "0.0.6", SHA256: "bbb"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadLockfile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLockfileMerge(t *testing.T) {
+	lock := NewLockfile([]LockEntry{
+		{Namespace: "preview", Name: "cetz", Version: "0.3.0", SHA256: "old"},
+	})
+	lock.Merge([]LockEntry{
+		{Namespace: "preview", Name: "cetz", Version: "0.3.0", SHA256: "new"},
+		{Namespace: "preview", Name: "cetz", Version: "0.2.0", SHA256: "older"},
+	})
+
+	want := []LockEntry{
+		{Namespace: "preview", Name: "cetz", Version: "0.2.0", SHA256: "older"},
+		{Namespace: "preview", Name: "cetz", Version: "0.3.0", SHA256: "new"},
+	}
+	if !reflect.DeepEqual(lock.Packages, want) {
+		t.Errorf("Packages = %+v, want %+v", lock.Packages, want)
+	}
+
+	if !lock.Contains(Dependency{Namespace: "preview", Name: "cetz", Version: "0.2.0"}) {
+		t.Error("Contains() = false for locked package")
+	}
+	if lock.Contains(Dependency{Namespace: "preview", Name: "cetz", Version: "0.1.0"}) {
+		t.Error("Contains() = true for unlocked package")
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
+	"runtime"
+	"sync"
 )
 
 // Dependency represents a parsed Typst package import.
@@ -20,9 +21,17 @@ func (d Dependency) Key() string {
 	return "@" + d.Namespace + "/" + d.Name + ":" + d.Version
 }
 
-var importRegex = regexp.MustCompile(`#import\s+"@([^/]+)/([^:]+):([^"]+)"`)
+// Package returns the "@namespace/name" identifier of the dependency,
+// without its version.
+func (d Dependency) Package() string {
+	return "@" + d.Namespace + "/" + d.Name
+}
+
+// importRegex matches a package spec in an #import or #include statement.
+var importRegex = regexp.MustCompile(`#(?:import|include)\s+"@([^/"\n]+)/([^:"\n]+):([^"\n]+)"`)
 
-// ExtractFromSource scans a single .typ file's content for package imports.
+// ExtractFromSource scans a single .typ file's content for package imports,
+// including packages referenced by #include.
 func ExtractFromSource(content []byte) []Dependency {
 	seen := make(map[string]struct{})
 	var deps []Dependency
@@ -30,7 +39,12 @@ func ExtractFromSource(content []byte) []Dependency {
 	lines := bytes.Split(content, []byte("\n"))
 	inBlockComment := false
 
+	// Comments are stripped line by line, then the remaining code is
+	// searched as a whole, since an import may be wrapped across lines.
+	var code bytes.Buffer
 	for _, line := range lines {
+		code.WriteByte('\n')
+
 		trimmed := bytes.TrimSpace(line)
 
 		if inBlockComment {
@@ -61,18 +75,20 @@ func ExtractFromSource(content []byte) []Dependency {
 			trimmed = trimmed[:idx]
 		}
 
-		matches := importRegex.FindAllSubmatch(trimmed, -1)
-		for _, match := range matches {
-			if len(match) == 4 {
-				dep := Dependency{
-					Namespace: string(match[1]),
-					Name:      string(match[2]),
-					Version:   string(match[3]),
-				}
-				if _, ok := seen[dep.Key()]; !ok {
-					seen[dep.Key()] = struct{}{}
-					deps = append(deps, dep)
-				}
+		code.Write(trimmed)
+	}
+
+	matches := importRegex.FindAllSubmatch(code.Bytes(), -1)
+	for _, match := range matches {
+		if len(match) == 4 {
+			dep := Dependency{
+				Namespace: string(match[1]),
+				Name:      string(match[2]),
+				Version:   string(match[3]),
+			}
+			if _, ok := seen[dep.Key()]; !ok {
+				seen[dep.Key()] = struct{}{}
+				deps = append(deps, dep)
 			}
 		}
 	}
@@ -80,39 +96,97 @@ func ExtractFromSource(content []byte) []Dependency {
 	return deps
 }
 
-// ExtractFromDirectory walks a local directory, scanning all .typ files for imports.
-func ExtractFromDirectory(dirPath string) ([]Dependency, error) {
-	seen := make(map[string]struct{})
-	var deps []Dependency
+// ExtractFromDirectory walks a local directory, scanning all .typ files for
+// imports. opts select other extensions or restrict the directories walked.
+// Version control directories are always skipped.
+//
+// Files are read and parsed concurrently, but the result is the same as
+// scanning them one by one in walk order: each import is listed once, where
+// it first occurs.
+func ExtractFromDirectory(dirPath string, opts ...ScanOption) ([]Dependency, error) {
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newScanConfig(root, opts)
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	var files []string
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
+			if cfg.skipDir(rel) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if !strings.HasSuffix(strings.ToLower(path), ".typ") {
-			return nil
+		if cfg.scanFile(rel) {
+			files = append(files, path)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
+	results, err := extractFromFiles(files)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, dep := range ExtractFromSource(content) {
+	seen := make(map[string]struct{})
+	var deps []Dependency
+	for _, fileDeps := range results {
+		for _, dep := range fileDeps {
 			if _, ok := seen[dep.Key()]; !ok {
 				seen[dep.Key()] = struct{}{}
 				deps = append(deps, dep)
 			}
 		}
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
 
 	return deps, nil
 }
+
+// extractFromFiles scans files with a bounded number of workers. The
+// imports of files[i] are stored in the i-th result. The error of the first
+// file that cannot be read is returned.
+func extractFromFiles(files []string) ([][]Dependency, error) {
+	results := make([][]Dependency, len(files))
+	errs := make([]error, len(files))
+
+	workers := min(runtime.GOMAXPROCS(0), len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				content, err := os.ReadFile(files[i])
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				results[i] = ExtractFromSource(content)
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
@@ -1,8 +1,11 @@
 package deps
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -56,6 +59,41 @@ func TestExtractFromSource(t *testing.T) {
 				{Namespace: "preview", Name: "tablex", Version: "0.0.6"},
 			},
 		},
+		{
+			name: "wrapped import list",
+			content: `#import "@preview/cetz:0.3.0": (
+  canvas,
+  draw,
+)
+#import "@preview/tablex:0.0.6":
+  tablex, cellx`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "cetz", Version: "0.3.0"},
+				{Namespace: "preview", Name: "tablex", Version: "0.0.6"},
+			},
+		},
+		{
+			name: "package spec on the next line",
+			content: `#import
+  "@preview/cetz:0.3.0": canvas`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "cetz", Version: "0.3.0"},
+			},
+		},
+		{
+			name: "comment between import and package spec",
+			content: `#import // the drawing library
+  "@preview/cetz:0.3.0": canvas`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "cetz", Version: "0.3.0"},
+			},
+		},
+		{
+			name: "unterminated string does not match across lines",
+			content: `#import "@preview/cetz
+:0.3.0"`,
+			want: nil,
+		},
 		{
 			name:    "no imports",
 			content: `= Hello World`,
@@ -77,6 +115,51 @@ func TestExtractFromSource(t *testing.T) {
 				{Namespace: "preview", Name: "cetz", Version: "0.3.0"},
 			},
 		},
+		{
+			name:    "single include",
+			content: `#include "@preview/template:1.0.0"`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "template", Version: "1.0.0"},
+			},
+		},
+		{
+			name: "include and import of the same package",
+			content: `#import "@preview/template:1.0.0": conf
+#include "@preview/template:1.0.0"`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "template", Version: "1.0.0"},
+			},
+		},
+		{
+			name:    "commented out include (line comment)",
+			content: `// #include "@preview/template:1.0.0"`,
+			want:    nil,
+		},
+		{
+			name:    "commented out include (block comment)",
+			content: `/* #include "@preview/template:1.0.0" */`,
+			want:    nil,
+		},
+		{
+			name: "include on the next line",
+			content: `#include
+  "@preview/template:1.0.0"`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "template", Version: "1.0.0"},
+			},
+		},
+		{
+			name:    "include with inline comment after",
+			content: `#include "@preview/template:1.0.0" // some comment`,
+			want: []Dependency{
+				{Namespace: "preview", Name: "template", Version: "1.0.0"},
+			},
+		},
+		{
+			name:    "include of a local file",
+			content: `#include "chapters/intro.typ"`,
+			want:    nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -158,3 +241,120 @@ func TestDependencyKey(t *testing.T) {
 		t.Errorf("Key() = %q, want %q", got, want)
 	}
 }
+
+func TestExtractFromDirectoryOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.typ":                          "a",
+		"chapters/intro.typ":                "b",
+		"templates/letter.typ.txt":          "c",
+		".git/hooks/sample.typ":             "d",
+		"node_modules/pkg/index.typ":        "e",
+		"cache/preview/lib/1.0.0/lib.typ":   "f",
+		"chapters/drafts/unfinished.TYP":    "g",
+		"templates/nested/snippet.typ":      "h",
+		"templates/nested/readme.md":        "i",
+		"chapters/drafts/notes.typ.txt.bak": "j",
+	}
+	for path, name := range files {
+		full := filepath.Join(tmpDir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		content := `#import "@preview/` + name + `:1.0.0": *`
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts []ScanOption
+		want []string
+	}{
+		{"default", nil, []string{"a", "b", "f", "g", "h"}},
+		{"extensions", []ScanOption{WithExtensions(".typ", ".typ.txt")}, []string{"a", "b", "c", "f", "g", "h"}},
+		{"include", []ScanOption{WithInclude("chapters")}, []string{"b", "g"}},
+		{"include nested", []ScanOption{WithInclude("templates/nested")}, []string{"h"}},
+		{"exclude relative", []ScanOption{WithExclude("cache", "chapters/drafts")}, []string{"a", "b", "h"}},
+		{"exclude absolute", []ScanOption{WithExclude(filepath.Join(tmpDir, "cache"))}, []string{"a", "b", "g", "h"}},
+		{
+			"combined",
+			[]ScanOption{WithExtensions(".typ.txt"), WithInclude("templates", "chapters"), WithExclude("chapters/drafts")},
+			[]string{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, err := ExtractFromDirectory(tmpDir, tt.opts...)
+			if err != nil {
+				t.Fatalf("ExtractFromDirectory() error = %v", err)
+			}
+
+			var got []string
+			for _, dep := range deps {
+				got = append(got, dep.Name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeProject creates a project of files .typ files spread over
+// subdirectories, each importing a few of a small set of packages.
+func writeProject(tb testing.TB, files int) string {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	for i := range files {
+		sub := filepath.Join(dir, fmt.Sprintf("chapter%02d", i%20))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		content := fmt.Sprintf("// File %d\n#import \"@preview/pkg%d:1.0.0\": *\n#import \"@preview/pkg%d:1.0.0\": *\n= Section\n", i, i%50, (i+7)%50)
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("file%04d.typ", i)), []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExtractFromDirectoryStableOrder(t *testing.T) {
+	dir := writeProject(t, 200)
+
+	first, err := ExtractFromDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 50 {
+		t.Fatalf("got %d deps, want 50", len(first))
+	}
+
+	// The walk order is lexical, so chapter00/file0000.typ comes first
+	if first[0].Name != "pkg0" || first[1].Name != "pkg7" {
+		t.Errorf("first deps = %v, want pkg0 and pkg7", first[:2])
+	}
+
+	for range 5 {
+		again, err := ExtractFromDirectory(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(again, first) {
+			t.Fatalf("result changed between runs:\n%v\n%v", first, again)
+		}
+	}
+}
+
+func BenchmarkExtractFromDirectory(b *testing.B) {
+	dir := writeProject(b, 2000)
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := ExtractFromDirectory(dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
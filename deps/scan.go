@@ -0,0 +1,161 @@
+package deps
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DefaultExtensions are the file extensions scanned for imports unless
+// WithExtensions is given.
+var DefaultExtensions = []string{".typ"}
+
+// skippedDirs never contain Typst sources worth scanning and can be large.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+}
+
+// ScanOption configures which files ExtractFromDirectory scans.
+type ScanOption func(*scanConfig)
+
+type scanConfig struct {
+	extensions []string
+	include    []string
+	exclude    []string
+}
+
+// WithExtensions scans files ending in one of exts, such as ".typ.txt",
+// instead of DefaultExtensions. Extensions are matched case-insensitively.
+func WithExtensions(exts ...string) ScanOption {
+	return func(c *scanConfig) {
+		c.extensions = exts
+	}
+}
+
+// WithInclude only scans files below the given directories. Relative paths
+// are relative to the scanned directory.
+func WithInclude(dirs ...string) ScanOption {
+	return func(c *scanConfig) {
+		c.include = append(c.include, dirs...)
+	}
+}
+
+// WithExclude skips the given directories, e.g. the package cache when it
+// is nested in the project. Relative paths are relative to the scanned
+// directory.
+func WithExclude(dirs ...string) ScanOption {
+	return func(c *scanConfig) {
+		c.exclude = append(c.exclude, dirs...)
+	}
+}
+
+// newScanConfig applies opts and turns the include and exclude paths into
+// clean paths relative to root, which must be absolute.
+func newScanConfig(root string, opts []ScanOption) *scanConfig {
+	c := &scanConfig{extensions: DefaultExtensions}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.include = relativePaths(root, c.include)
+	c.exclude = relativePaths(root, c.exclude)
+	return c
+}
+
+func relativePaths(root string, paths []string) []string {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if filepath.IsAbs(p) {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				continue
+			}
+			p = rel
+		}
+		result = append(result, filepath.Clean(p))
+	}
+	return result
+}
+
+// SkipDirFunc returns a function that reports whether ExtractFromDirectory
+// with opts skips the directory at path when scanning dirPath, e.g. to watch
+// the same directories for changes.
+func SkipDirFunc(dirPath string, opts ...ScanOption) (func(path string) bool, error) {
+	root, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newScanConfig(root, opts)
+
+	return func(path string) bool {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return false
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return false
+		}
+		return cfg.skipDir(rel)
+	}, nil
+}
+
+// skipDir reports whether the directory at rel, relative to the scanned
+// directory, is not walked.
+func (c *scanConfig) skipDir(rel string) bool {
+	if rel == "." {
+		return false
+	}
+	if skippedDirs[filepath.Base(rel)] {
+		return true
+	}
+	for _, dir := range c.exclude {
+		if within(rel, dir) {
+			return true
+		}
+	}
+
+	if len(c.include) == 0 {
+		return false
+	}
+	// Walk directories leading to an included one as well
+	for _, dir := range c.include {
+		if within(rel, dir) || within(dir, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanFile reports whether the file at rel, relative to the scanned
+// directory, is scanned for imports.
+func (c *scanConfig) scanFile(rel string) bool {
+	if len(c.include) > 0 {
+		included := false
+		for _, dir := range c.include {
+			if within(rel, dir) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	name := strings.ToLower(rel)
+	for _, ext := range c.extensions {
+		if strings.HasSuffix(name, strings.ToLower(ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or lies below it. Both are relative
+// and clean.
+func within(path, dir string) bool {
+	return dir == "." || path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/typstify/tpix-cli/config"
+	"github.com/typstify/tpix-cli/deps"
+	"github.com/typstify/tpix-cli/resolver"
+)
+
+// writeTree prints the dependency graph g as an indented tree below roots.
+// Packages already printed are marked with (*) instead of being expanded
+// again, which also ends cycles.
+func writeTree(w io.Writer, roots []deps.Dependency, g *resolver.Graph) {
+	printed := make(map[string]bool)
+
+	var walk func(pkg deps.Dependency, indent string)
+	walk = func(pkg deps.Dependency, indent string) {
+		key := pkg.Key()
+		if printed[key] {
+			fmt.Fprintf(w, "%s%s (*)\n", indent, key)
+			return
+		}
+		printed[key] = true
+		fmt.Fprintf(w, "%s%s\n", indent, key)
+		for _, dep := range g.Dependencies(pkg) {
+			walk(dep, indent+"  ")
+		}
+	}
+
+	for _, root := range roots {
+		walk(root, "")
+	}
+}
+
+// writeDOT prints the dependency graph g in the Graphviz DOT language, with
+// a node per package and an edge per dependency.
+func writeDOT(w io.Writer, g *resolver.Graph) {
+	fmt.Fprintln(w, "digraph dependencies {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, pkg := range g.Packages {
+		fmt.Fprintf(w, "  %q;\n", pkg.Key())
+	}
+	for _, pkg := range g.Packages {
+		for _, dep := range g.Dependencies(pkg) {
+			fmt.Fprintf(w, "  %q -> %q;\n", pkg.Key(), dep.Key())
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// graphCmd prints the dependency graph of packages or of the current project.
+func graphCmd() *cobra.Command {
+	var format string
+	var scan scanOptions
+
+	cmd := &cobra.Command{
+		Use:   "graph [namespace/name:version...]",
+		Short: "Print the dependency graph of packages",
+		Long: `Print the transitive dependencies of the given packages, or of the packages
+imported by the current project, as published on the TPIX server. Nothing is
+downloaded.
+
+The graph is printed as an indented tree by default. With --format dot, it is
+printed in the Graphviz DOT language instead, e.g. for 'tpix graph --format
+dot | dot -Tpng -o deps.png'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "text" && format != "dot" {
+				return fmt.Errorf("invalid format %q, expected text or dot", format)
+			}
+
+			var roots []deps.Dependency
+			for _, arg := range args {
+				root, err := parseExactPkgSpec(arg)
+				if err != nil {
+					return err
+				}
+				roots = append(roots, root)
+			}
+			if len(args) == 0 {
+				cwd, err := os.Getwd()
+				if err != nil {
+					return err
+				}
+				cfg, err := config.Load()
+				if err != nil {
+					return err
+				}
+				roots, err = deps.ExtractFromDirectory(cwd, scan.options(cfg.TypstCachePkgPath)...)
+				if err != nil {
+					return fmt.Errorf("failed to scan for imports: %w", err)
+				}
+				if len(roots) == 0 {
+					return fmt.Errorf("no package imports found in %s", cwd)
+				}
+			}
+
+			g, err := resolver.FetchGraph(roots...)
+			if err != nil {
+				return err
+			}
+			if format == "dot" {
+				writeDOT(os.Stdout, g)
+			} else {
+				writeTree(os.Stdout, roots, g)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: text or dot")
+	scan.addFlags(cmd)
+
+	return cmd
+}
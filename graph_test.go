@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/typstify/tpix-cli/deps"
+	"github.com/typstify/tpix-cli/resolver"
+)
+
+// graphFetcher serves an in-memory dependency graph.
+type graphFetcher struct {
+	resolver.Fetcher
+	graph map[string][]deps.Dependency
+}
+
+func (f graphFetcher) Dependencies(pkg deps.Dependency) ([]deps.Dependency, error) {
+	return f.graph[pkg.Key()], nil
+}
+
+func TestGraphOutput(t *testing.T) {
+	app := deps.Dependency{Namespace: "preview", Name: "app", Version: "1.0.0"}
+	util := deps.Dependency{Namespace: "preview", Name: "util", Version: "0.1.0"}
+	draw := deps.Dependency{Namespace: "preview", Name: "draw", Version: "0.2.0"}
+	g, err := resolver.FetchGraphWithFetcher(graphFetcher{graph: map[string][]deps.Dependency{
+		app.Key():  {util, draw},
+		draw.Key(): {util},
+		util.Key(): {app},
+	}}, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tree bytes.Buffer
+	writeTree(&tree, []deps.Dependency{app}, g)
+	wantTree := `@preview/app:1.0.0
+  @preview/util:0.1.0
+    @preview/app:1.0.0 (*)
+  @preview/draw:0.2.0
+    @preview/util:0.1.0 (*)
+`
+	if got := tree.String(); got != wantTree {
+		t.Errorf("writeTree() =\n%s\nwant\n%s", got, wantTree)
+	}
+
+	var dot bytes.Buffer
+	writeDOT(&dot, g)
+	wantDOT := `digraph dependencies {
+  node [shape=box];
+  "@preview/app:1.0.0";
+  "@preview/util:0.1.0";
+  "@preview/draw:0.2.0";
+  "@preview/app:1.0.0" -> "@preview/util:0.1.0";
+  "@preview/app:1.0.0" -> "@preview/draw:0.2.0";
+  "@preview/util:0.1.0" -> "@preview/app:1.0.0";
+  "@preview/draw:0.2.0" -> "@preview/util:0.1.0";
+}
+`
+	if got := dot.String(); got != wantDOT {
+		t.Errorf("writeDOT() =\n%s\nwant\n%s", got, wantDOT)
+	}
+}
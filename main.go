@@ -1,35 +1,208 @@
 package main
 
 import (
-	"github.com/typstify/tpix-cli/config"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/spf13/cobra"
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/config"
+	"github.com/typstify/tpix-cli/utils"
 )
 
 var (
 	rootCmd = cobra.Command{
 		Use:   "tpix",
 		Short: "A tpix command line client used to manage Typst packages",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if debugEnvSet() && !cmd.Flags().Changed("log-level") {
+				logOpts.level = levelDebug.String()
+			}
+			level, err := logOpts.resolve()
+			if err != nil {
+				return err
+			}
+			logLevel = level
+
+			if err := api.ConfigureTLS(cmp.Or(caCertFile, os.Getenv(caCertEnv)), insecure); err != nil {
+				return err
+			}
+			if insecure {
+				// Printed at every log level, as it affects the security of
+				// everything downloaded
+				logf(levelError, stderr, "Warning: TLS certificate verification is disabled by --insecure, the server's identity is not checked. Never use this outside of testing.\n")
+			}
+
+			if traceFile != "" {
+				f, err := os.OpenFile(traceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+				if err != nil {
+					return fmt.Errorf("failed to open trace file: %w", err)
+				}
+				// The file is closed when the process exits
+				api.TraceTo(f)
+			}
+
+			if logLevel >= levelDebug {
+				api.LogRequests(debugf)
+				debugf("Config file: %s\n", config.FilePath())
+				if cfg, err := config.Load(); err == nil {
+					debugf("Cache dir: %s (%s)\n", cfg.TypstCachePkgPath, config.CachePathSource(cfg))
+				}
+				debugf("Server: %s\n", api.ServerURL())
+			}
+
+			api.OnRateLimit = func(wait time.Duration) {
+				warnf("rate limited by the server, retrying in %s...\n", wait.Round(time.Second))
+			}
+
+			if maxExtractSize != "" {
+				size, err := utils.ParseSize(maxExtractSize)
+				if err != nil {
+					return fmt.Errorf("invalid --max-extract-size: %w", err)
+				}
+				utils.SetMaxExtractSize(size)
+			}
+
+			if compatCheck {
+				if err := api.CheckCompatibility(); err != nil {
+					warnf("%v\nRun 'tpix update' to get a client that supports the server.\n", err)
+				}
+			}
+			return nil
+		},
 	}
+
+	traceFile      string
+	caCertFile     string
+	insecure       bool
+	compatCheck    bool
+	maxExtractSize string
+	logOpts        logOptions
 )
 
+// caCertEnv is the environment variable that sets the default of --ca-cert.
+const caCertEnv = "TPIX_CA_CERT"
+
+// interruptGracePeriod is how long a command may take to stop after an
+// interrupt before the process exits anyway.
+const interruptGracePeriod = 3 * time.Second
+
+// configFlag returns the value of --config in args, if any. It is needed
+// before the command line is parsed, as the config file defines aliases and
+// the defaults of some flags.
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--config="); ok {
+			return value
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
 func main() {
+	if path := configFlag(os.Args[1:]); path != "" {
+		if err := config.UseConfigFile(path); err != nil {
+			errorf("invalid --config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Load config on startup
-	config.Load()
+	cfg, _ := config.Load()
 
 	//rootCmd.PersistentFlags().StringVar(&tpixServer, "server", tpixServer, "TPIX server URL")
+	// --config is applied by configFlag before parsing, it is only
+	// registered here to be accepted and listed in the help
+	rootCmd.PersistentFlags().String("config", "", "Use this config file instead of the default one, also set with TPIX_CONFIG")
+	rootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Write a log of all HTTP traffic to a file, with credentials masked")
+	rootCmd.PersistentFlags().StringVar(&caCertFile, "ca-cert", "", "PEM file with CA certificates to trust for the server, e.g. a private CA (also set with "+caCertEnv+")")
+	rootCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "Do not verify the server's TLS certificate, only for testing")
+	rootCmd.PersistentFlags().BoolVar(&compatCheck, "compat-check", false, "Warn if the server API version is not supported by this client")
+	rootCmd.PersistentFlags().BoolVar(&api.Refresh, "refresh", false, "Do not reuse package information fetched earlier in the same run or the cached release check")
+	rootCmd.PersistentFlags().StringVar(&logOpts.level, "log-level", levelInfo.String(), "Output verbosity: error, warn, info or debug")
+	rootCmd.PersistentFlags().BoolVarP(&logOpts.verbose, "verbose", "v", false, "Print debug output, including HTTP requests, same as --log-level debug or TPIX_DEBUG=1")
+	rootCmd.PersistentFlags().StringVar(&maxExtractSize, "max-extract-size", cfg.MaxExtractSize, "Largest archive that may be extracted, e.g. 2GB (default 1 GB in total, 256 MB per file)")
+	rootCmd.PersistentFlags().BoolVarP(&logOpts.quiet, "quiet", "q", false, "Only print warnings, errors and summaries, same as --log-level warn")
 
 	rootCmd.AddCommand(loginCmd())
+	rootCmd.AddCommand(logoutCmd())
 	rootCmd.AddCommand(searchPkgCmd())
+	rootCmd.AddCommand(myCmd())
 	rootCmd.AddCommand(getPkgCmd())
 	rootCmd.AddCommand(pullCmd())
+	rootCmd.AddCommand(installCmd())
+	rootCmd.AddCommand(statusCmd())
+	rootCmd.AddCommand(depsCmd())
+	rootCmd.AddCommand(graphCmd())
 	rootCmd.AddCommand(queryPkgCmd())
 	rootCmd.AddCommand(listCachedCmd())
+	rootCmd.AddCommand(outdatedCmd())
 	rootCmd.AddCommand(removeCachedCmd())
+	rootCmd.AddCommand(extractCmd())
+	rootCmd.AddCommand(catCmd())
+	rootCmd.AddCommand(lsFilesCmd())
+	rootCmd.AddCommand(verifyCmd())
+	rootCmd.AddCommand(initCmd())
 	rootCmd.AddCommand(bundleCmd())
+	rootCmd.AddCommand(validateCmd())
+	rootCmd.AddCommand(inspectCmd())
+	rootCmd.AddCommand(checksumCmd())
 	rootCmd.AddCommand(pushCmd())
 	rootCmd.AddCommand(versionCmd())
+	rootCmd.AddCommand(envCmd())
+	rootCmd.AddCommand(doctorCmd())
+	rootCmd.AddCommand(configCmd())
 	rootCmd.AddCommand(updateCmd())
-	rootCmd.AddCommand(cachePathCmd())
+	rootCmd.AddCommand(cacheCmd())
+	rootCmd.AddCommand(legacyCachePathCmd())
 
-	rootCmd.Execute()
+	// Expand user-defined command aliases
+	isCommand := builtinCommand(&rootCmd)
+	warnShadowedAliases(cfg.Aliases, isCommand)
+	args, err := expandAlias(os.Args[1:], cfg.Aliases, isCommand)
+	if err != nil {
+		errorf("%v\n", err)
+		os.Exit(1)
+	}
+	rootCmd.SetArgs(args)
+
+	// When interrupted, cancel the context of the command so that running
+	// downloads stop and clean up after themselves. Commands that do not
+	// return in time, or a second interrupt, end the process, without
+	// leaving partially extracted packages behind.
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancel()
+		select {
+		case <-sigCh:
+		case <-time.After(interruptGracePeriod):
+		}
+		utils.RemoveTempDirs()
+		os.Exit(130)
+	}()
+
+	err = rootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		utils.RemoveTempDirs()
+		os.Exit(130)
+	}
+	// Cobra has printed the error already, only the exit status is missing
+	if err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestConfigFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"get", "@preview/cetz:0.3.0"}, ""},
+		{[]string{"--config", "work.json", "pull"}, "work.json"},
+		{[]string{"pull", "--config=work.json"}, "work.json"},
+		{[]string{"--config"}, ""},
+		{[]string{"run", "--", "--config", "work.json"}, ""},
+	}
+	for _, tt := range tests {
+		if got := configFlag(tt.args); got != tt.want {
+			t.Errorf("configFlag(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
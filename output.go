@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// level is the verbosity of the informational output of a command. The
+// primary output of a command, e.g. the results of a search or the JSON
+// produced with --json, is printed at every level.
+type level int
+
+const (
+	// levelError only prints errors.
+	levelError level = iota
+	// levelWarn adds warnings and the final summary of a command.
+	levelWarn
+	// levelInfo adds progress messages. It is the default.
+	levelInfo
+	// levelDebug adds details useful when troubleshooting.
+	levelDebug
+)
+
+var levelNames = []string{"error", "warn", "info", "debug"}
+
+func (l level) String() string {
+	return levelNames[l]
+}
+
+// parseLevel parses the value of --log-level.
+func parseLevel(s string) (level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level(i), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("invalid log level %q, expected one of %s", s, strings.Join(levelNames, ", "))
+}
+
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+
+	// logLevel is the verbosity set with --log-level, -v or -q.
+	logLevel = levelInfo
+)
+
+// debugEnv enables debug output, like --verbose, when set to a true value.
+const debugEnv = "TPIX_DEBUG"
+
+// debugEnvSet reports whether debug output was enabled with TPIX_DEBUG.
+func debugEnvSet() bool {
+	v := os.Getenv(debugEnv)
+	return v != "" && v != "0" && v != "false"
+}
+
+// logOptions holds the flags that select the log level.
+type logOptions struct {
+	level   string
+	verbose bool
+	quiet   bool
+	// summaryOnly is the deprecated --summary-only flag of get and pull.
+	summaryOnly bool
+}
+
+// resolve returns the log level selected by the flags. -v and -q take
+// precedence over --log-level.
+func (o *logOptions) resolve() (level, error) {
+	if o.verbose && o.quiet {
+		return levelInfo, fmt.Errorf("--verbose and --quiet cannot be used together")
+	}
+
+	switch {
+	case o.verbose:
+		return levelDebug, nil
+	case o.quiet, o.summaryOnly:
+		return levelWarn, nil
+	}
+	return parseLevel(o.level)
+}
+
+// addSummaryOnlyFlag adds the --summary-only flag, which predates
+// --log-level, to cmd.
+func addSummaryOnlyFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&logOpts.summaryOnly, "summary-only", false, "Only print the final summary, not per-package progress")
+	cmd.Flags().MarkDeprecated("summary-only", "use --quiet or --log-level warn instead")
+}
+
+func logf(l level, w io.Writer, format string, args ...any) {
+	if logLevel < l {
+		return
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// errorf prints an error message to stderr.
+func errorf(format string, args ...any) {
+	logf(levelError, stderr, "Error: "+format, args...)
+}
+
+// warnf prints a warning to stderr.
+func warnf(format string, args ...any) {
+	logf(levelWarn, stderr, "Warning: "+format, args...)
+}
+
+// summaryf prints a line of the final summary of a command.
+func summaryf(format string, args ...any) {
+	logf(levelWarn, stdout, format, args...)
+}
+
+// progressf prints a progress message, such as a line per package.
+func progressf(format string, args ...any) {
+	logf(levelInfo, stdout, format, args...)
+}
+
+// debugf prints details that are only of interest when troubleshooting.
+func debugf(format string, args ...any) {
+	logf(levelDebug, stderr, format, args...)
+}
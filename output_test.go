@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/deps"
+	"github.com/typstify/tpix-cli/resolver"
+)
+
+// captureOutput redirects stdout and stderr at the given log level for the
+// rest of the test.
+func captureOutput(t *testing.T, l level) (out, errOut *bytes.Buffer) {
+	t.Helper()
+
+	out, errOut = new(bytes.Buffer), new(bytes.Buffer)
+	oldStdout, oldStderr, oldLevel := stdout, stderr, logLevel
+	stdout, stderr, logLevel = out, errOut, l
+	t.Cleanup(func() {
+		stdout, stderr, logLevel = oldStdout, oldStderr, oldLevel
+	})
+	return out, errOut
+}
+
+func TestLogLevels(t *testing.T) {
+	tests := []struct {
+		level      level
+		wantStdout string
+		wantStderr string
+	}{
+		{levelError, "", "Error: error\n"},
+		{levelWarn, "summary\n", "Error: error\nWarning: warn\n"},
+		{levelInfo, "progress\nsummary\n", "Error: error\nWarning: warn\n"},
+		{levelDebug, "progress\nsummary\n", "Error: error\nWarning: warn\ndebug\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			out, errOut := captureOutput(t, tt.level)
+
+			errorf("error\n")
+			warnf("warn\n")
+			progressf("progress\n")
+			summaryf("summary\n")
+			debugf("debug\n")
+
+			if got := out.String(); got != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", got, tt.wantStdout)
+			}
+			if got := errOut.String(); got != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", got, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestLogOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    logOptions
+		want    level
+		wantErr bool
+	}{
+		{"default", logOptions{level: "info"}, levelInfo, false},
+		{"log level", logOptions{level: "ERROR"}, levelError, false},
+		{"verbose", logOptions{level: "info", verbose: true}, levelDebug, false},
+		{"quiet", logOptions{level: "debug", quiet: true}, levelWarn, false},
+		{"summary only", logOptions{level: "info", summaryOnly: true}, levelWarn, false},
+		{"invalid level", logOptions{level: "trace"}, levelInfo, true},
+		{"verbose and quiet", logOptions{level: "info", verbose: true, quiet: true}, levelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugEnvSet(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "0": false, "false": false, "1": true, "true": true} {
+		t.Setenv(debugEnv, value)
+		if got := debugEnvSet(); got != want {
+			t.Errorf("debugEnvSet() with %s=%q = %v, want %v", debugEnv, value, got, want)
+		}
+	}
+}
+
+func TestResolveEventOutput(t *testing.T) {
+	pkg := deps.Dependency{Namespace: "preview", Name: "lib", Version: "1.0.0"}
+	events := []resolver.Event{
+		{Kind: resolver.PackageCached, Package: pkg},
+		{Kind: resolver.PackageStarted, Package: pkg},
+		{Kind: resolver.PackageCompleted, Package: pkg},
+	}
+
+	tests := []struct {
+		level level
+		want  string
+	}{
+		{
+			level: levelInfo,
+			want: "Resolving...\n" +
+				"  Already cached: @preview/lib:1.0.0\n" +
+				"  Downloading @preview/lib:1.0.0...\n" +
+				"Done. 1 package(s) resolved.\n",
+		},
+		{
+			level: levelWarn,
+			want:  "Done. 1 package(s) resolved.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			out, _ := captureOutput(t, tt.level)
+
+			progressf("Resolving...\n")
+			for _, e := range events {
+				printResolveEvent(e)
+			}
+			summaryf("Done. %d package(s) resolved.\n", 1)
+
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingFetcher fails to download the packages in errs.
+type failingFetcher struct {
+	graphFetcher
+	cacheDir string
+	errs     map[string]error
+}
+
+func (f failingFetcher) Download(ctx context.Context, pkg deps.Dependency, onProgress api.ProgressFunc) error {
+	if err := f.errs[pkg.Key()]; err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(f.cacheDir, pkg.Namespace, pkg.Name, pkg.Version), 0755)
+}
+
+func TestDownloadSummary(t *testing.T) {
+	out, _ := captureOutput(t, levelWarn)
+
+	cacheDir := t.TempDir()
+	fetcher := failingFetcher{
+		cacheDir: cacheDir,
+		errs:     map[string]error{"@preview/b:1.0.0": errors.New("service unavailable")},
+	}
+	r := resolver.NewWithFetcher(cacheDir, fetcher)
+	r.ContinueOnError = true
+	err := r.Resolve(
+		deps.Dependency{Namespace: "preview", Name: "a", Version: "1.0.0"},
+		deps.Dependency{Namespace: "preview", Name: "b", Version: "1.0.0"},
+	)
+
+	var downloadErr *resolver.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("Resolve() error = %v, want *DownloadError", err)
+	}
+	printDownloadSummary(r, downloadErr)
+
+	want := "Done. 1 package(s) resolved, 1 failed.\n" +
+		"\nSucceeded:\n  @preview/a:1.0.0\n" +
+		"\nFailed:\n  @preview/b:1.0.0: service unavailable\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/typstify/tpix-cli/deps"
+)
+
+// Conflict is a package resolved at more than one version, all of which
+// end up in the cache. Typst then uses different versions in different
+// places, which can cause subtle compile errors.
+type Conflict struct {
+	Namespace string
+	Name      string
+	// Requests lists the requested versions in ascending order.
+	Requests []VersionRequest
+}
+
+// VersionRequest is a version of a conflicting package and the packages
+// depending on it.
+type VersionRequest struct {
+	Version string
+	// RequestedBy holds the keys of the packages depending on this version.
+	// It is empty if the version was requested directly, e.g. by an import
+	// of the project.
+	RequestedBy []string
+}
+
+func (c Conflict) String() string {
+	versions := make([]string, len(c.Requests))
+	for i, req := range c.Requests {
+		by := "requested directly"
+		if len(req.RequestedBy) > 0 {
+			by = "required by " + strings.Join(req.RequestedBy, ", ")
+		}
+		versions[i] = fmt.Sprintf("%s (%s)", req.Version, by)
+	}
+	return fmt.Sprintf("@%s/%s at %d versions: %s", c.Namespace, c.Name, len(c.Requests), strings.Join(versions, "; "))
+}
+
+// ConflictError is returned when conflicts are not allowed.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	lines := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		lines[i] = "  " + c.String()
+	}
+	return fmt.Sprintf("%d package(s) resolved at conflicting versions:\n%s", len(e.Conflicts), strings.Join(lines, "\n"))
+}
+
+// Conflicts returns the packages resolved so far at more than one version,
+// sorted by package name like Resolved.
+func (r *Resolver) Conflicts() []Conflict {
+	// Dependents of each package key, in resolution order
+	requestedBy := make(map[string][]string)
+	for _, pkg := range r.packages {
+		for _, dep := range r.graph[pkg.Key()] {
+			requestedBy[dep.Key()] = append(requestedBy[dep.Key()], pkg.Key())
+		}
+	}
+
+	var conflicts []Conflict
+	for _, resolved := range r.Resolved() {
+		if len(resolved.Requested) < 2 {
+			continue
+		}
+		c := Conflict{Namespace: resolved.Namespace, Name: resolved.Name}
+		for _, v := range resolved.Requested {
+			key := deps.Dependency{Namespace: resolved.Namespace, Name: resolved.Name, Version: v}.Key()
+			c.Requests = append(c.Requests, VersionRequest{Version: v, RequestedBy: requestedBy[key]})
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/typstify/tpix-cli/deps"
+)
+
+func TestConflicts(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {
+				dep("preview", "a", "1.0.0"),
+				dep("preview", "b", "1.0.0"),
+			},
+			"@preview/a:1.0.0": {dep("preview", "util", "0.10.0")},
+			"@preview/b:1.0.0": {dep("preview", "util", "0.9.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "app", "1.0.0"), dep("preview", "util", "0.9.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := []Conflict{{
+		Namespace: "preview",
+		Name:      "util",
+		Requests: []VersionRequest{
+			{Version: "0.9.0", RequestedBy: []string{"@preview/b:1.0.0"}},
+			{Version: "0.10.0", RequestedBy: []string{"@preview/a:1.0.0"}},
+		},
+	}}
+	got := r.Conflicts()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Conflicts() = %+v, want %+v", got, want)
+	}
+
+	wantString := "@preview/util at 2 versions: 0.9.0 (required by @preview/b:1.0.0); 0.10.0 (required by @preview/a:1.0.0)"
+	if s := got[0].String(); s != wantString {
+		t.Errorf("String() = %q, want %q", s, wantString)
+	}
+
+	err := &ConflictError{Conflicts: got}
+	if !strings.Contains(err.Error(), "\n  "+wantString) {
+		t.Errorf("Error() = %q", err)
+	}
+}
+
+func TestConflictsRequestedDirectly(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {dep("preview", "util", "0.2.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "app", "1.0.0"), dep("preview", "util", "0.1.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := []VersionRequest{
+		{Version: "0.1.0"},
+		{Version: "0.2.0", RequestedBy: []string{"@preview/app:1.0.0"}},
+	}
+	conflicts := r.Conflicts()
+	if len(conflicts) != 1 || !reflect.DeepEqual(conflicts[0].Requests, want) {
+		t.Errorf("Conflicts() = %+v, want requests %+v", conflicts, want)
+	}
+}
@@ -0,0 +1,74 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/deps"
+)
+
+// Graph is the dependency graph of a set of packages as published on the
+// server. Every package appears once, however many packages depend on it.
+type Graph struct {
+	// Packages lists the packages in the order they were reached.
+	Packages []deps.Dependency
+	// edges maps a package key to its direct dependencies.
+	edges map[string][]deps.Dependency
+}
+
+// Dependencies returns the direct dependencies of pkg.
+func (g *Graph) Dependencies(pkg deps.Dependency) []deps.Dependency {
+	return g.edges[pkg.Key()]
+}
+
+// FetchGraph fetches the dependency graph of roots from the TPIX server
+// without downloading any package.
+func FetchGraph(roots ...deps.Dependency) (*Graph, error) {
+	return FetchGraphWithFetcher(apiFetcher{}, roots...)
+}
+
+// FetchGraphWithFetcher fetches the dependency graph of roots using
+// fetcher. Packages of the @local namespace are left out, and cycles are
+// followed only once. A package the server has no dependency data for is
+// treated as having no dependencies; any other error is returned.
+func FetchGraphWithFetcher(fetcher Fetcher, roots ...deps.Dependency) (*Graph, error) {
+	g := &Graph{edges: make(map[string][]deps.Dependency)}
+	visited := make(map[string]bool)
+
+	var walk func(pkg deps.Dependency) error
+	walk = func(pkg deps.Dependency) error {
+		key := pkg.Key()
+		if visited[key] || pkg.Namespace == LocalNamespace {
+			return nil
+		}
+		visited[key] = true
+		g.Packages = append(g.Packages, pkg)
+
+		depList, err := fetcher.Dependencies(pkg)
+		var notFound *api.NotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get dependencies of %s: %w", key, err)
+		}
+		for _, dep := range depList {
+			if dep.Namespace == LocalNamespace {
+				continue
+			}
+			g.edges[key] = append(g.edges[key], dep)
+			if err := walk(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := walk(root); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
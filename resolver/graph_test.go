@@ -0,0 +1,68 @@
+package resolver
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/deps"
+)
+
+func TestFetchGraph(t *testing.T) {
+	app := dep("preview", "app", "1.0.0")
+	util := dep("preview", "util", "0.1.0")
+	draw := dep("preview", "draw", "0.2.0")
+	fetcher := &fakeFetcher{
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0":  {util, draw, dep("local", "mine", "0.1.0")},
+			"@preview/draw:0.2.0": {util},
+			// A cycle back to the root
+			"@preview/util:0.1.0": {app},
+		},
+	}
+
+	g, err := FetchGraphWithFetcher(fetcher, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []deps.Dependency{app, util, draw}; !reflect.DeepEqual(g.Packages, want) {
+		t.Errorf("Packages = %v, want %v", g.Packages, want)
+	}
+	if got, want := g.Dependencies(app), []deps.Dependency{util, draw}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Dependencies(app) = %v, want %v", got, want)
+	}
+	if got, want := g.Dependencies(draw), []deps.Dependency{util}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Dependencies(draw) = %v, want %v", got, want)
+	}
+	if got, want := g.Dependencies(util), []deps.Dependency{app}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Dependencies(util) = %v, want %v", got, want)
+	}
+}
+
+func TestFetchGraphErrors(t *testing.T) {
+	app := dep("preview", "app", "1.0.0")
+	util := dep("preview", "util", "0.1.0")
+	errServer := errors.New("server error")
+	fetcher := &fakeFetcher{
+		graph: map[string][]deps.Dependency{"@preview/app:1.0.0": {util}},
+		depErrs: map[string]error{
+			"@preview/util:0.1.0": &api.NotFoundError{Namespace: "preview", Name: "util", Version: "0.1.0"},
+		},
+	}
+
+	// A package without dependency data has no dependencies
+	g, err := FetchGraphWithFetcher(fetcher, app)
+	if err != nil {
+		t.Fatalf("FetchGraphWithFetcher() error = %v", err)
+	}
+	if want := []deps.Dependency{app, util}; !reflect.DeepEqual(g.Packages, want) {
+		t.Errorf("Packages = %v, want %v", g.Packages, want)
+	}
+
+	fetcher.depErrs["@preview/util:0.1.0"] = errServer
+	if _, err := FetchGraphWithFetcher(fetcher, app); !errors.Is(err, errServer) {
+		t.Errorf("FetchGraphWithFetcher() error = %v, want %v", err, errServer)
+	}
+}
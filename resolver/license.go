@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/typstify/tpix-cli/deps"
+)
+
+// LicenseVerdict is the outcome of checking a license against a LicensePolicy.
+type LicenseVerdict int
+
+const (
+	LicenseAllowed LicenseVerdict = iota
+	LicenseDenied
+	// LicenseUnknown is returned for packages that declare no license.
+	LicenseUnknown
+)
+
+func (v LicenseVerdict) String() string {
+	switch v {
+	case LicenseAllowed:
+		return "allowed"
+	case LicenseDenied:
+		return "denied"
+	default:
+		return "unknown"
+	}
+}
+
+// LicensePolicy restricts the licenses of installed packages. Licenses are
+// SPDX identifiers compared case-insensitively.
+type LicensePolicy struct {
+	// Allow, if not empty, lists the only licenses that may be installed.
+	Allow []string
+	// Deny lists licenses that must never be installed.
+	Deny []string
+}
+
+// Check evaluates an SPDX license expression against the policy. For
+// "A OR B" one acceptable license is enough, for "A AND B" both must be
+// acceptable, and AND binds tighter than OR. The exception in "A WITH
+// exception" only adds permissions, so it is A that is checked. Malformed
+// expressions are denied.
+func (p *LicensePolicy) Check(license string) LicenseVerdict {
+	expr := strings.NewReplacer("(", " ( ", ")", " ) ").Replace(license)
+	tokens := strings.Fields(expr)
+	if len(tokens) == 0 {
+		return LicenseUnknown
+	}
+
+	e := &licenseExpr{policy: p, tokens: tokens}
+	ok := e.or()
+	if e.malformed || e.pos != len(tokens) || !ok {
+		return LicenseDenied
+	}
+	return LicenseAllowed
+}
+
+// licenseExpr is a recursive descent evaluator of SPDX license expressions.
+// Every operand is evaluated, even if the result is already known, so that
+// all tokens are consumed.
+type licenseExpr struct {
+	policy    *LicensePolicy
+	tokens    []string
+	pos       int
+	malformed bool
+}
+
+// accept consumes the next token if it is op, compared case-insensitively.
+func (e *licenseExpr) accept(op string) bool {
+	if e.pos < len(e.tokens) && strings.EqualFold(e.tokens[e.pos], op) {
+		e.pos++
+		return true
+	}
+	return false
+}
+
+func (e *licenseExpr) or() bool {
+	ok := e.and()
+	for e.accept("OR") {
+		right := e.and()
+		ok = ok || right
+	}
+	return ok
+}
+
+func (e *licenseExpr) and() bool {
+	ok := e.term()
+	for e.accept("AND") {
+		right := e.term()
+		ok = ok && right
+	}
+	return ok
+}
+
+// term evaluates a license, with an optional exception, or a parenthesized
+// expression.
+func (e *licenseExpr) term() bool {
+	if e.accept("(") {
+		ok := e.or()
+		if !e.accept(")") {
+			e.malformed = true
+		}
+		return ok
+	}
+
+	if e.pos == len(e.tokens) {
+		e.malformed = true
+		return false
+	}
+	id := e.tokens[e.pos]
+	switch strings.ToUpper(id) {
+	case ")", "AND", "OR", "WITH":
+		e.malformed = true
+		return false
+	}
+	e.pos++
+
+	if e.accept("WITH") {
+		if e.pos == len(e.tokens) {
+			e.malformed = true
+			return false
+		}
+		e.pos++
+	}
+	return e.policy.acceptable(id)
+}
+
+func (p *LicensePolicy) acceptable(id string) bool {
+	for _, denied := range p.Deny {
+		if strings.EqualFold(id, denied) {
+			return false
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.Allow {
+		if strings.EqualFold(id, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// LicenseError is returned when a package is blocked by the license policy.
+type LicenseError struct {
+	Package deps.Dependency
+	License string
+	Verdict LicenseVerdict
+}
+
+func (e *LicenseError) Error() string {
+	if e.Verdict == LicenseUnknown {
+		return fmt.Sprintf("%s has no declared license and is blocked by the license policy", e.Package.Key())
+	}
+	return fmt.Sprintf("%s is licensed under %s, which is not allowed by the license policy", e.Package.Key(), e.License)
+}
+
+// checkLicense applies the resolver's license policy to pkg. Packages that
+// are not allowed outright are accepted only if ConfirmLicense approves them.
+func (r *Resolver) checkLicense(pkg deps.Dependency) error {
+	if r.LicensePolicy == nil {
+		return nil
+	}
+
+	license, err := r.fetcher.License(pkg)
+	if err != nil {
+		return fmt.Errorf("failed to get license of %s: %w", pkg.Key(), err)
+	}
+
+	verdict := r.LicensePolicy.Check(license)
+	if verdict == LicenseAllowed {
+		return nil
+	}
+
+	if r.ConfirmLicense != nil && r.ConfirmLicense(pkg, license, verdict) {
+		return nil
+	}
+
+	return &LicenseError{Package: pkg, License: license, Verdict: verdict}
+}
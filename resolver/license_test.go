@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/typstify/tpix-cli/deps"
+)
+
+func TestLicensePolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  LicensePolicy
+		license string
+		want    LicenseVerdict
+	}{
+		{"no policy", LicensePolicy{}, "GPL-3.0-only", LicenseAllowed},
+		{"allowed", LicensePolicy{Allow: []string{"MIT", "Apache-2.0"}}, "MIT", LicenseAllowed},
+		{"case insensitive", LicensePolicy{Allow: []string{"mit"}}, "MIT", LicenseAllowed},
+		{"not on allowlist", LicensePolicy{Allow: []string{"MIT"}}, "GPL-3.0-only", LicenseDenied},
+		{"denied", LicensePolicy{Deny: []string{"GPL-3.0-only"}}, "GPL-3.0-only", LicenseDenied},
+		{"unknown", LicensePolicy{Allow: []string{"MIT"}}, "", LicenseUnknown},
+		{"or expression", LicensePolicy{Allow: []string{"MIT"}}, "MIT OR Apache-2.0", LicenseAllowed},
+		{"and expression", LicensePolicy{Allow: []string{"MIT"}}, "MIT AND Apache-2.0", LicenseDenied},
+		{"or with denied", LicensePolicy{Deny: []string{"GPL-3.0-only"}}, "(GPL-3.0-only OR MIT)", LicenseAllowed},
+		{"with exception", LicensePolicy{Allow: []string{"Apache-2.0"}}, "Apache-2.0 WITH LLVM-exception", LicenseAllowed},
+		{"with exception denied", LicensePolicy{Allow: []string{"MIT"}}, "Apache-2.0 WITH LLVM-exception", LicenseDenied},
+		{"with exception in or", LicensePolicy{Allow: []string{"MIT"}}, "Apache-2.0 WITH LLVM-exception OR MIT", LicenseAllowed},
+		{"and binds tighter than or", LicensePolicy{Allow: []string{"MIT"}}, "Apache-2.0 AND GPL-3.0-only OR MIT", LicenseAllowed},
+		{"and binds tighter than or, denied", LicensePolicy{Allow: []string{"MIT"}}, "MIT AND Apache-2.0 OR GPL-3.0-only", LicenseDenied},
+		{"and of or", LicensePolicy{Allow: []string{"MIT", "Zlib"}}, "(MIT OR Apache-2.0) AND (GPL-3.0-only OR Zlib)", LicenseAllowed},
+		{"and of or, denied", LicensePolicy{Allow: []string{"MIT"}}, "(MIT OR Apache-2.0) AND (GPL-3.0-only OR Zlib)", LicenseDenied},
+		{"lowercase operators", LicensePolicy{Allow: []string{"MIT"}}, "Apache-2.0 and GPL-3.0-only or MIT", LicenseAllowed},
+		{"malformed", LicensePolicy{}, "MIT AND", LicenseDenied},
+		{"unbalanced", LicensePolicy{}, "(MIT OR Apache-2.0", LicenseDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Check(tt.license); got != tt.want {
+				t.Errorf("Check(%q) = %v, want %v", tt.license, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveLicensePolicy(t *testing.T) {
+	graph := map[string][]deps.Dependency{
+		"@preview/app:1.0.0": {
+			dep("preview", "gpl", "1.0.0"),
+			dep("preview", "anon", "1.0.0"),
+		},
+	}
+	licenses := map[string]string{
+		"@preview/app": "MIT",
+		"@preview/gpl": "GPL-3.0-only",
+	}
+
+	tests := []struct {
+		name        string
+		confirm     func(deps.Dependency, string, LicenseVerdict) bool
+		wantBlocked string
+		wantVerdict LicenseVerdict
+	}{
+		{
+			name:        "denied license",
+			wantBlocked: "@preview/gpl:1.0.0",
+			wantVerdict: LicenseDenied,
+		},
+		{
+			name: "unknown license",
+			confirm: func(pkg deps.Dependency, license string, verdict LicenseVerdict) bool {
+				return verdict == LicenseDenied
+			},
+			wantBlocked: "@preview/anon:1.0.0",
+			wantVerdict: LicenseUnknown,
+		},
+		{
+			name: "confirmed",
+			confirm: func(deps.Dependency, string, LicenseVerdict) bool {
+				return true
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			fetcher := &fakeFetcher{cacheDir: cacheDir, graph: graph, licenses: licenses}
+
+			r := NewWithFetcher(cacheDir, fetcher)
+			r.LicensePolicy = &LicensePolicy{Allow: []string{"MIT"}}
+			r.ConfirmLicense = tt.confirm
+
+			err := r.Resolve(dep("preview", "app", "1.0.0"))
+			if tt.wantBlocked == "" {
+				if err != nil {
+					t.Fatalf("Resolve() error = %v", err)
+				}
+				return
+			}
+
+			var licenseErr *LicenseError
+			if !errors.As(err, &licenseErr) {
+				t.Fatalf("Resolve() error = %v, want LicenseError", err)
+			}
+			if licenseErr.Package.Key() != tt.wantBlocked || licenseErr.Verdict != tt.wantVerdict {
+				t.Errorf("blocked %s (%v), want %s (%v)", licenseErr.Package.Key(), licenseErr.Verdict, tt.wantBlocked, tt.wantVerdict)
+			}
+			for _, d := range fetcher.downloads {
+				if d == tt.wantBlocked {
+					t.Errorf("blocked package %s was downloaded", d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/deps"
+	"github.com/typstify/tpix-cli/utils"
+	"github.com/typstify/tpix-cli/version"
+)
+
+// EventKind identifies what happened to a package during resolution.
+type EventKind int
+
+const (
+	// PackageCached is emitted when a package is already in the local cache.
+	PackageCached EventKind = iota
+	// PackageStarted is emitted before a package is downloaded.
+	PackageStarted
+	// BytesDownloaded reports the progress of a package download.
+	BytesDownloaded
+	// PackageCompleted is emitted once a package has been downloaded and
+	// extracted into the cache.
+	PackageCompleted
+	// PackageMissing is emitted instead of PackageStarted in read-only mode,
+	// for a package that would have been downloaded.
+	PackageMissing
+	// PackageSkipped is emitted for a package that is not resolved at all,
+	// such as a locally installed one.
+	PackageSkipped
+	// PackageFailed is emitted when a package cannot be downloaded or its
+	// dependencies cannot be fetched, and ContinueOnError is set.
+	PackageFailed
+)
+
+const (
+	// LocalNamespace holds packages installed locally by the user, which
+	// are never published on the TPIX server.
+	LocalNamespace = "local"
+	// PreviewNamespace holds the packages of the official Typst registry.
+	PreviewNamespace = "preview"
+)
+
+// Event is a progress notification emitted by the Resolver.
+type Event struct {
+	Kind    EventKind
+	Package deps.Dependency
+	// Bytes and Total are only set for BytesDownloaded events. Total is -1
+	// when the size of the download is unknown.
+	Bytes int64
+	Total int64
+	// Reason is only set for PackageSkipped events and says why the package
+	// was skipped, e.g. "local".
+	Reason string
+	// Err is only set for PackageFailed events.
+	Err error
+}
+
+// Fetcher retrieves packages and their dependency metadata.
+type Fetcher interface {
+	// Download downloads pkg into the cache, reporting progress to
+	// onProgress. It stops when ctx is cancelled.
+	Download(ctx context.Context, pkg deps.Dependency, onProgress api.ProgressFunc) error
+	// Dependencies returns the direct dependencies of pkg.
+	Dependencies(pkg deps.Dependency) ([]deps.Dependency, error)
+	// Checksum returns the published SHA256 of the archive of pkg.
+	Checksum(pkg deps.Dependency) (string, error)
+	// License returns the SPDX license expression declared by pkg.
+	License(pkg deps.Dependency) (string, error)
+}
+
+// apiFetcher is the Fetcher backed by the TPIX server.
+type apiFetcher struct{}
+
+func (apiFetcher) Download(ctx context.Context, pkg deps.Dependency, onProgress api.ProgressFunc) error {
+	return api.DownloadPackage(ctx, pkg.Namespace, pkg.Name, pkg.Version, onProgress)
+}
+
+func (apiFetcher) Dependencies(pkg deps.Dependency) ([]deps.Dependency, error) {
+	infos, err := api.FetchDependencies(pkg.Namespace, pkg.Name, pkg.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]deps.Dependency, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, deps.Dependency{
+			Namespace: info.Namespace,
+			Name:      info.Name,
+			Version:   info.Version,
+		})
+	}
+	return result, nil
+}
+
+func (apiFetcher) Checksum(pkg deps.Dependency) (string, error) {
+	return api.PackageChecksum(pkg.Namespace, pkg.Name, pkg.Version)
+}
+
+func (apiFetcher) License(pkg deps.Dependency) (string, error) {
+	info, err := api.FetchPackage(pkg.Namespace, pkg.Name)
+	if err != nil {
+		return "", err
+	}
+	return info.License, nil
+}
+
+// Resolver downloads packages together with their transitive dependencies
+// into the Typst package cache. Progress is reported through OnEvent instead
+// of being printed, so the resolver can be driven by any frontend.
+type Resolver struct {
+	cacheDir string
+	fetcher  Fetcher
+	// ctx cancels the running Resolve or Install.
+	ctx context.Context
+	// visited tracks already-processed packages to prevent infinite loops.
+	visited map[string]bool
+	// packages lists the visited packages in resolution order.
+	packages []deps.Dependency
+	// graph maps a package key to its direct dependencies.
+	graph map[string][]deps.Dependency
+	// missing lists the packages not downloaded in read-only mode.
+	missing []deps.Dependency
+	// failed lists the packages that could not be downloaded with
+	// ContinueOnError set.
+	failed []FailedPackage
+
+	// NoDeps skips fetching the dependencies of the requested packages.
+	NoDeps bool
+	// NoPreview skips packages of the @preview namespace, like those of
+	// @local, which are always skipped.
+	NoPreview bool
+	// OnEvent, if set, receives progress events.
+	OnEvent func(Event)
+
+	// LicensePolicy, if set, is checked for every resolved package.
+	LicensePolicy *LicensePolicy
+	// ConfirmLicense is asked whether a package whose license is denied or
+	// unknown may be installed anyway. If nil, such packages are rejected.
+	ConfirmLicense func(pkg deps.Dependency, license string, verdict LicenseVerdict) bool
+
+	// ContinueOnError keeps resolving the remaining packages when one cannot
+	// be downloaded or its dependencies cannot be fetched. The dependencies
+	// of such a package are not resolved, and the failures are returned as a
+	// *DownloadError at the end.
+	ContinueOnError bool
+
+	// MaxDepth limits how deep dependencies are followed below the requested
+	// packages, guarding against runaway dependency graphs. Zero means no
+	// limit. It is DefaultMaxDepth by default.
+	MaxDepth int
+
+	// ReadOnly prevents any write to the cache. Packages that are not cached
+	// are reported with PackageMissing events, and resolving them fails with
+	// a *ReadOnlyCacheError. It is set by default if the cache directory
+	// cannot be written to.
+	ReadOnly bool
+}
+
+// DefaultMaxDepth is the default of Resolver.MaxDepth, far deeper than any
+// real dependency graph.
+const DefaultMaxDepth = 64
+
+// MaxDepthError is returned when a dependency chain is longer than
+// Resolver.MaxDepth.
+type MaxDepthError struct {
+	MaxDepth int
+	// Chain leads from a requested package to the one exceeding MaxDepth.
+	Chain []deps.Dependency
+}
+
+func (e *MaxDepthError) Error() string {
+	keys := make([]string, len(e.Chain))
+	for i, pkg := range e.Chain {
+		keys[i] = pkg.Key()
+	}
+	return fmt.Sprintf("dependency chain exceeds the maximum depth of %d: %s", e.MaxDepth, strings.Join(keys, " -> "))
+}
+
+// FailedPackage is a package that could not be downloaded.
+type FailedPackage struct {
+	Package deps.Dependency
+	Err     error
+}
+
+// DownloadError is returned when packages failed to download with
+// ContinueOnError set.
+type DownloadError struct {
+	Failed []FailedPackage
+}
+
+func (e *DownloadError) Error() string {
+	keys := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		keys[i] = f.Package.Key()
+	}
+	return fmt.Sprintf("%d package(s) failed to download: %s", len(keys), strings.Join(keys, ", "))
+}
+
+// ReadOnlyCacheError is returned when packages are missing from a cache
+// that may not be written to.
+type ReadOnlyCacheError struct {
+	CacheDir string
+	Missing  []deps.Dependency
+}
+
+func (e *ReadOnlyCacheError) Error() string {
+	keys := make([]string, len(e.Missing))
+	for i, pkg := range e.Missing {
+		keys[i] = pkg.Key()
+	}
+	return fmt.Sprintf("package cache %s is read-only, %d package(s) would be downloaded: %s",
+		e.CacheDir, len(keys), strings.Join(keys, ", "))
+}
+
+// New creates a Resolver installing packages into cacheDir from the TPIX server.
+func New(cacheDir string) *Resolver {
+	return NewWithFetcher(cacheDir, apiFetcher{})
+}
+
+// NewWithFetcher creates a Resolver that retrieves packages using fetcher.
+func NewWithFetcher(cacheDir string, fetcher Fetcher) *Resolver {
+	return &Resolver{
+		cacheDir: cacheDir,
+		fetcher:  fetcher,
+		ctx:      context.Background(),
+		visited:  make(map[string]bool),
+		graph:    make(map[string][]deps.Dependency),
+		MaxDepth: DefaultMaxDepth,
+		ReadOnly: utils.IsReadOnlyDir(cacheDir),
+	}
+}
+
+// Resolve downloads pkgs and, unless NoDeps is set, their transitive
+// dependencies. Packages already resolved by this Resolver are skipped.
+func (r *Resolver) Resolve(pkgs ...deps.Dependency) error {
+	return r.ResolveContext(context.Background(), pkgs...)
+}
+
+// ResolveContext is Resolve, stopping with ctx's error once ctx is
+// cancelled. A download in progress is aborted and leaves nothing behind.
+func (r *Resolver) ResolveContext(ctx context.Context, pkgs ...deps.Dependency) error {
+	r.ctx = ctx
+	for _, pkg := range pkgs {
+		if err := r.resolve(pkg, nil); err != nil {
+			return err
+		}
+	}
+
+	return r.incompleteErr()
+}
+
+// Packages returns the packages resolved so far in resolution order,
+// including those that failed to download.
+func (r *Resolver) Packages() []deps.Dependency {
+	return slices.Clone(r.packages)
+}
+
+// Count returns the number of packages resolved so far, not including
+// skipped ones.
+func (r *Resolver) Count() int {
+	return len(r.packages)
+}
+
+// SkipReason returns why pkg is not resolved, or an empty string if it is.
+func (r *Resolver) SkipReason(pkg deps.Dependency) string {
+	switch {
+	case pkg.Namespace == LocalNamespace:
+		return "local"
+	case r.NoPreview && pkg.Namespace == PreviewNamespace:
+		return "preview"
+	}
+	return ""
+}
+
+// Dependencies returns the direct dependencies recorded for pkg while
+// resolving, which together form the dependency tree.
+func (r *Resolver) Dependencies(pkg deps.Dependency) []deps.Dependency {
+	return r.graph[pkg.Key()]
+}
+
+// ResolvedPackage is the effective version of a package after the whole
+// dependency graph has been walked.
+type ResolvedPackage struct {
+	Namespace string
+	Name      string
+	// Version is the highest version requested anywhere in the graph.
+	Version string
+	// Requested lists every version requested in the graph, in ascending order.
+	Requested []string
+}
+
+// Resolved returns one entry per @namespace/name in the resolved graph,
+// sorted by package name.
+func (r *Resolver) Resolved() []ResolvedPackage {
+	byName := make(map[string]*ResolvedPackage)
+	var names []string
+	for _, pkg := range r.packages {
+		resolved, ok := byName[pkg.Package()]
+		if !ok {
+			resolved = &ResolvedPackage{Namespace: pkg.Namespace, Name: pkg.Name}
+			byName[pkg.Package()] = resolved
+			names = append(names, pkg.Package())
+		}
+		resolved.Requested = append(resolved.Requested, pkg.Version)
+	}
+
+	sort.Strings(names)
+	result := make([]ResolvedPackage, 0, len(names))
+	for _, name := range names {
+		resolved := byName[name]
+		sort.Slice(resolved.Requested, func(i, j int) bool {
+			return compareVersions(resolved.Requested[i], resolved.Requested[j]) < 0
+		})
+		resolved.Version = resolved.Requested[len(resolved.Requested)-1]
+		result = append(result, *resolved)
+	}
+
+	return result
+}
+
+// Lock returns a lock file entry for every package resolved so far,
+// pinning its exact version and published checksum.
+func (r *Resolver) Lock() ([]deps.LockEntry, error) {
+	entries := make([]deps.LockEntry, 0, len(r.packages))
+	for _, pkg := range r.packages {
+		checksum, err := r.fetcher.Checksum(pkg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get checksum of %s: %w", pkg.Key(), err)
+		}
+		entries = append(entries, deps.LockEntry{
+			Namespace: pkg.Namespace,
+			Name:      pkg.Name,
+			Version:   pkg.Version,
+			SHA256:    checksum,
+		})
+	}
+
+	return entries, nil
+}
+
+// Install installs exactly the packages pinned in entries, without
+// resolving dependencies. Before a package is downloaded, the checksum
+// published by the server is compared with the pinned one, and the download
+// itself is verified against it.
+func (r *Resolver) Install(entries []deps.LockEntry) error {
+	return r.InstallContext(context.Background(), entries)
+}
+
+// InstallContext is Install, stopping with ctx's error once ctx is
+// cancelled.
+func (r *Resolver) InstallContext(ctx context.Context, entries []deps.LockEntry) error {
+	r.ctx = ctx
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pkg := entry.Dependency()
+		key := pkg.Key()
+		if r.visited[key] {
+			continue
+		}
+		r.visited[key] = true
+		if r.skip(pkg) {
+			continue
+		}
+		r.packages = append(r.packages, pkg)
+
+		if err := r.checkLicense(pkg); err != nil {
+			return err
+		}
+
+		if IsCached(r.cacheDir, pkg) {
+			r.emit(Event{Kind: PackageCached, Package: pkg})
+			continue
+		}
+
+		if entry.SHA256 != "" {
+			checksum, err := r.fetcher.Checksum(pkg)
+			if err != nil {
+				return fmt.Errorf("failed to get checksum of %s: %w", key, err)
+			}
+			if !strings.EqualFold(checksum, entry.SHA256) {
+				return fmt.Errorf("checksum of %s changed on the server (locked %s, published %s)", key, entry.SHA256, checksum)
+			}
+		}
+
+		if err := r.download(pkg); err != nil {
+			if !r.ContinueOnError || r.ctx.Err() != nil {
+				return fmt.Errorf("failed to download %s: %w", key, err)
+			}
+			r.fail(pkg, err)
+		}
+	}
+
+	return r.incompleteErr()
+}
+
+// compareVersions compares two versions semantically, falling back to a
+// plain string comparison for versions that are not valid semver.
+func compareVersions(v1, v2 string) int {
+	c, err := version.Compare(v1, v2)
+	if err != nil {
+		return strings.Compare(v1, v2)
+	}
+	return c
+}
+
+// resolve resolves pkg, which is required through chain, the packages
+// leading to it from a requested one.
+func (r *Resolver) resolve(pkg deps.Dependency, chain []deps.Dependency) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	key := pkg.Key()
+	if r.visited[key] {
+		return nil
+	}
+	if r.MaxDepth > 0 && len(chain) > r.MaxDepth {
+		return &MaxDepthError{MaxDepth: r.MaxDepth, Chain: append(slices.Clone(chain), pkg)}
+	}
+	r.visited[key] = true
+	if r.skip(pkg) {
+		return nil
+	}
+	r.packages = append(r.packages, pkg)
+
+	if err := r.checkLicense(pkg); err != nil {
+		return err
+	}
+
+	if IsCached(r.cacheDir, pkg) {
+		r.emit(Event{Kind: PackageCached, Package: pkg})
+		// Do not return early, check if dependencies are satisfied.
+	} else if err := r.download(pkg); err != nil {
+		// Cancellation is not a failure of the package
+		if !r.ContinueOnError || r.ctx.Err() != nil {
+			return fmt.Errorf("failed to download %s: %w", key, err)
+		}
+		r.fail(pkg, err)
+		return nil
+	}
+
+	// Only the dependencies of the requested packages are skipped
+	if r.NoDeps && len(chain) == 0 {
+		return nil
+	}
+
+	// Fetch and resolve transitive dependencies. Packages the server has
+	// no dependency data for are treated as having none.
+	depList, err := r.fetcher.Dependencies(pkg)
+	var notFound *api.NotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to get dependencies of %s: %w", key, err)
+		if !r.ContinueOnError || r.ctx.Err() != nil {
+			return err
+		}
+		r.fail(pkg, err)
+		return nil
+	}
+
+	r.graph[key] = depList
+	chain = append(chain, pkg)
+	for _, dep := range depList {
+		if err := r.resolve(dep, chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// download downloads pkg into the cache, emitting progress events. In
+// read-only mode, pkg is only recorded as missing.
+func (r *Resolver) download(pkg deps.Dependency) error {
+	if r.ReadOnly {
+		r.missing = append(r.missing, pkg)
+		r.emit(Event{Kind: PackageMissing, Package: pkg})
+		return nil
+	}
+
+	r.emit(Event{Kind: PackageStarted, Package: pkg})
+	err := r.fetcher.Download(r.ctx, pkg, func(received, total int64) {
+		r.emit(Event{Kind: BytesDownloaded, Package: pkg, Bytes: received, Total: total})
+	})
+	if err != nil {
+		return err
+	}
+	r.emit(Event{Kind: PackageCompleted, Package: pkg})
+	return nil
+}
+
+// skip reports whether pkg is skipped, emitting a PackageSkipped event if so.
+func (r *Resolver) skip(pkg deps.Dependency) bool {
+	reason := r.SkipReason(pkg)
+	if reason == "" {
+		return false
+	}
+	r.emit(Event{Kind: PackageSkipped, Package: pkg, Reason: reason})
+	return true
+}
+
+// fail records that pkg could not be downloaded or its dependencies not
+// fetched, for ContinueOnError.
+func (r *Resolver) fail(pkg deps.Dependency, err error) {
+	r.failed = append(r.failed, FailedPackage{Package: pkg, Err: err})
+	r.emit(Event{Kind: PackageFailed, Package: pkg, Err: err})
+}
+
+// incompleteErr reports the packages that could not be downloaded because
+// the cache is read-only or, with ContinueOnError, because of an error.
+func (r *Resolver) incompleteErr() error {
+	var errs []error
+	if len(r.missing) > 0 {
+		errs = append(errs, &ReadOnlyCacheError{CacheDir: r.cacheDir, Missing: r.missing})
+	}
+	if len(r.failed) > 0 {
+		errs = append(errs, &DownloadError{Failed: r.failed})
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Resolver) emit(e Event) {
+	if r.OnEvent != nil {
+		r.OnEvent(e)
+	}
+}
+
+// IsCached checks if a package version is already in the local cache.
+func IsCached(cacheDir string, pkg deps.Dependency) bool {
+	pkgDir := filepath.Join(cacheDir, pkg.Namespace, pkg.Name, pkg.Version)
+	info, err := os.Stat(pkgDir)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,480 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/typstify/tpix-cli/api"
+	"github.com/typstify/tpix-cli/deps"
+)
+
+// fakeFetcher serves packages from an in-memory dependency graph and
+// "downloads" them by creating their directory in the cache.
+type fakeFetcher struct {
+	cacheDir  string
+	graph     map[string][]deps.Dependency
+	checksums map[string]string
+	licenses  map[string]string
+	// errs makes downloading the packages with the given keys fail.
+	errs map[string]error
+	// depErrs makes fetching the dependencies of the given keys fail.
+	depErrs   map[string]error
+	downloads []string
+}
+
+func (f *fakeFetcher) Download(ctx context.Context, pkg deps.Dependency, onProgress api.ProgressFunc) error {
+	f.downloads = append(f.downloads, pkg.Key())
+	if err := f.errs[pkg.Key()]; err != nil {
+		return err
+	}
+	if onProgress != nil {
+		onProgress(50, 100)
+		onProgress(100, 100)
+	}
+	return os.MkdirAll(filepath.Join(f.cacheDir, pkg.Namespace, pkg.Name, pkg.Version), 0755)
+}
+
+func (f *fakeFetcher) Dependencies(pkg deps.Dependency) ([]deps.Dependency, error) {
+	if err := f.depErrs[pkg.Key()]; err != nil {
+		return nil, err
+	}
+	return f.graph[pkg.Key()], nil
+}
+
+func (f *fakeFetcher) Checksum(pkg deps.Dependency) (string, error) {
+	if sum, ok := f.checksums[pkg.Key()]; ok {
+		return sum, nil
+	}
+	return "sha-" + pkg.Key(), nil
+}
+
+func (f *fakeFetcher) License(pkg deps.Dependency) (string, error) {
+	return f.licenses[pkg.Package()], nil
+}
+
+func dep(namespace, name, version string) deps.Dependency {
+	return deps.Dependency{Namespace: namespace, Name: name, Version: version}
+}
+
+func TestResolveEvents(t *testing.T) {
+	cacheDir := t.TempDir()
+	os.MkdirAll(filepath.Join(cacheDir, "preview", "util", "0.1.0"), 0755)
+
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {dep("preview", "util", "0.1.0")},
+		},
+	}
+
+	var events []string
+	r := NewWithFetcher(cacheDir, fetcher)
+	r.OnEvent = func(e Event) {
+		switch e.Kind {
+		case PackageCached:
+			events = append(events, "cached "+e.Package.Key())
+		case PackageStarted:
+			events = append(events, "started "+e.Package.Key())
+		case BytesDownloaded:
+			events = append(events, fmt.Sprintf("bytes %s %d/%d", e.Package.Key(), e.Bytes, e.Total))
+		case PackageCompleted:
+			events = append(events, "completed "+e.Package.Key())
+		}
+	}
+
+	if err := r.Resolve(dep("preview", "app", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := []string{
+		"started @preview/app:1.0.0",
+		"bytes @preview/app:1.0.0 50/100",
+		"bytes @preview/app:1.0.0 100/100",
+		"completed @preview/app:1.0.0",
+		"cached @preview/util:0.1.0",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	if r.Count() != 2 {
+		t.Errorf("Count() = %d, want 2", r.Count())
+	}
+}
+
+func TestResolveNoDeps(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {dep("preview", "util", "0.1.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	r.NoDeps = true
+	if err := r.Resolve(dep("preview", "app", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := []string{"@preview/app:1.0.0"}
+	if !reflect.DeepEqual(fetcher.downloads, want) {
+		t.Errorf("downloads = %v, want %v", fetcher.downloads, want)
+	}
+}
+
+func TestResolveCycle(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/a:1.0.0": {dep("preview", "b", "1.0.0")},
+			"@preview/b:1.0.0": {dep("preview", "a", "1.0.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "a", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if len(fetcher.downloads) != 2 {
+		t.Errorf("downloads = %v, want 2 packages", fetcher.downloads)
+	}
+}
+
+func TestResolvedSet(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {
+				dep("preview", "a", "1.0.0"),
+				dep("preview", "b", "1.0.0"),
+			},
+			"@preview/a:1.0.0": {dep("preview", "util", "0.10.0")},
+			"@preview/b:1.0.0": {dep("preview", "util", "0.9.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "app", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := []ResolvedPackage{
+		{Namespace: "preview", Name: "a", Version: "1.0.0", Requested: []string{"1.0.0"}},
+		{Namespace: "preview", Name: "app", Version: "1.0.0", Requested: []string{"1.0.0"}},
+		{Namespace: "preview", Name: "b", Version: "1.0.0", Requested: []string{"1.0.0"}},
+		{Namespace: "preview", Name: "util", Version: "0.10.0", Requested: []string{"0.9.0", "0.10.0"}},
+	}
+	if got := r.Resolved(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolved() = %+v, want %+v", got, want)
+	}
+
+	wantDeps := []deps.Dependency{dep("preview", "util", "0.9.0")}
+	if got := r.Dependencies(dep("preview", "b", "1.0.0")); !reflect.DeepEqual(got, wantDeps) {
+		t.Errorf("Dependencies() = %v, want %v", got, wantDeps)
+	}
+}
+
+func TestLock(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {dep("preview", "util", "0.1.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "app", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	entries, err := r.Lock()
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	want := []deps.LockEntry{
+		{Namespace: "preview", Name: "app", Version: "1.0.0", SHA256: "sha-@preview/app:1.0.0"},
+		{Namespace: "preview", Name: "util", Version: "0.1.0", SHA256: "sha-@preview/util:0.1.0"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Lock() = %+v, want %+v", entries, want)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {dep("preview", "util", "0.1.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	err := r.Install([]deps.LockEntry{
+		{Namespace: "preview", Name: "app", Version: "1.0.0", SHA256: "sha-@preview/app:1.0.0"},
+	})
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	// Only the pinned package is installed, dependencies are not resolved.
+	want := []string{"@preview/app:1.0.0"}
+	if !reflect.DeepEqual(fetcher.downloads, want) {
+		t.Errorf("downloads = %v, want %v", fetcher.downloads, want)
+	}
+}
+
+func TestInstallChecksumChanged(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir:  cacheDir,
+		checksums: map[string]string{"@preview/app:1.0.0": "republished"},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	err := r.Install([]deps.LockEntry{
+		{Namespace: "preview", Name: "app", Version: "1.0.0", SHA256: "original"},
+	})
+	if err == nil {
+		t.Fatal("Install() expected error for changed checksum")
+	}
+
+	if len(fetcher.downloads) != 0 {
+		t.Errorf("downloads = %v, want none", fetcher.downloads)
+	}
+}
+
+func TestResolveReadOnly(t *testing.T) {
+	cacheDir := t.TempDir()
+	os.MkdirAll(filepath.Join(cacheDir, "preview", "util", "0.1.0"), 0755)
+
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/app:1.0.0": {dep("preview", "util", "0.1.0"), dep("preview", "lib", "2.0.0")},
+		},
+	}
+
+	var missing []string
+	r := NewWithFetcher(cacheDir, fetcher)
+	r.ReadOnly = true
+	r.OnEvent = func(e Event) {
+		if e.Kind == PackageMissing {
+			missing = append(missing, e.Package.Key())
+		}
+	}
+
+	err := r.Resolve(dep("preview", "app", "1.0.0"))
+	var readOnlyErr *ReadOnlyCacheError
+	if !errors.As(err, &readOnlyErr) {
+		t.Fatalf("Resolve() error = %v, want *ReadOnlyCacheError", err)
+	}
+
+	// Every missing package of the graph is reported, nothing is downloaded.
+	want := []string{"@preview/app:1.0.0", "@preview/lib:2.0.0"}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %v, want %v", missing, want)
+	}
+	if len(fetcher.downloads) != 0 {
+		t.Errorf("downloads = %v, want none", fetcher.downloads)
+	}
+}
+
+func TestResolveReadOnlyDir(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+
+	cacheDir := t.TempDir()
+	if err := os.Chmod(cacheDir, 0555); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	defer os.Chmod(cacheDir, 0755)
+
+	fetcher := &fakeFetcher{cacheDir: cacheDir}
+	r := NewWithFetcher(cacheDir, fetcher)
+	if !r.ReadOnly {
+		t.Fatal("read-only cache dir was not detected")
+	}
+
+	err := r.Resolve(dep("preview", "app", "1.0.0"))
+	if err == nil || !strings.Contains(err.Error(), "is read-only") {
+		t.Fatalf("Resolve() error = %v, want read-only cache error", err)
+	}
+	if len(fetcher.downloads) != 0 {
+		t.Errorf("downloads = %v, want none", fetcher.downloads)
+	}
+}
+
+func TestResolveSkipsLocal(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@myns/app:1.0.0": {dep("preview", "util", "0.1.0")},
+		},
+	}
+
+	var skipped []string
+	r := NewWithFetcher(cacheDir, fetcher)
+	r.NoPreview = true
+	r.OnEvent = func(e Event) {
+		if e.Kind == PackageSkipped {
+			skipped = append(skipped, e.Reason+" "+e.Package.Key())
+		}
+	}
+
+	err := r.Resolve(dep("local", "mine", "0.1.0"), dep("myns", "app", "1.0.0"), dep("local", "mine", "0.1.0"))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	wantSkipped := []string{"local @local/mine:0.1.0", "preview @preview/util:0.1.0"}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped = %v, want %v", skipped, wantSkipped)
+	}
+	wantDownloads := []string{"@myns/app:1.0.0"}
+	if !reflect.DeepEqual(fetcher.downloads, wantDownloads) {
+		t.Errorf("downloads = %v, want %v", fetcher.downloads, wantDownloads)
+	}
+
+	// Skipped packages are not pinned in the lock file
+	entries, err := r.Lock()
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "app" {
+		t.Errorf("Lock() = %+v, want only @myns/app", entries)
+	}
+	if r.Count() != 1 {
+		t.Errorf("Count() = %d, want 1", r.Count())
+	}
+}
+
+func TestResolveMaxDepth(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/a:1.0.0": {dep("preview", "b", "1.0.0")},
+			"@preview/b:1.0.0": {dep("preview", "c", "1.0.0")},
+			"@preview/c:1.0.0": {dep("preview", "d", "1.0.0")},
+		},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	r.MaxDepth = 3
+	if err := r.Resolve(dep("preview", "a", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	r = NewWithFetcher(t.TempDir(), fetcher)
+	r.MaxDepth = 2
+	err := r.Resolve(dep("preview", "a", "1.0.0"))
+	var depthErr *MaxDepthError
+	if !errors.As(err, &depthErr) {
+		t.Fatalf("Resolve() error = %v, want MaxDepthError", err)
+	}
+	want := "dependency chain exceeds the maximum depth of 2: @preview/a:1.0.0 -> @preview/b:1.0.0 -> @preview/c:1.0.0 -> @preview/d:1.0.0"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestResolveContinueOnError(t *testing.T) {
+	cacheDir := t.TempDir()
+	errUnavailable := errors.New("service unavailable")
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/a:1.0.0": {dep("preview", "util", "0.1.0")},
+			"@preview/b:1.0.0": {dep("preview", "draw", "0.1.0")},
+		},
+		errs: map[string]error{"@preview/b:1.0.0": errUnavailable},
+	}
+
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "b", "1.0.0"), dep("preview", "a", "1.0.0")); !errors.Is(err, errUnavailable) {
+		t.Fatalf("Resolve() error = %v, want download error", err)
+	}
+	if want := []string{"@preview/b:1.0.0"}; !reflect.DeepEqual(fetcher.downloads, want) {
+		t.Errorf("downloads = %v, want %v", fetcher.downloads, want)
+	}
+
+	fetcher.downloads = nil
+	var failed []string
+	r = NewWithFetcher(cacheDir, fetcher)
+	r.ContinueOnError = true
+	r.OnEvent = func(e Event) {
+		if e.Kind == PackageFailed {
+			failed = append(failed, e.Package.Key())
+		}
+	}
+	err := r.Resolve(dep("preview", "b", "1.0.0"), dep("preview", "a", "1.0.0"))
+
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("Resolve() error = %v, want *DownloadError", err)
+	}
+	if len(downloadErr.Failed) != 1 || !errors.Is(downloadErr.Failed[0].Err, errUnavailable) {
+		t.Errorf("Failed = %+v", downloadErr.Failed)
+	}
+	if want := []string{"@preview/b:1.0.0"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed events = %v, want %v", failed, want)
+	}
+	// The dependencies of the failed package are not resolved
+	want := []string{"@preview/b:1.0.0", "@preview/a:1.0.0", "@preview/util:0.1.0"}
+	if !reflect.DeepEqual(fetcher.downloads, want) {
+		t.Errorf("downloads = %v, want %v", fetcher.downloads, want)
+	}
+}
+
+func TestResolveDependenciesError(t *testing.T) {
+	cacheDir := t.TempDir()
+	errUnavailable := errors.New("service unavailable")
+	fetcher := &fakeFetcher{
+		cacheDir: cacheDir,
+		graph: map[string][]deps.Dependency{
+			"@preview/a:1.0.0": {dep("preview", "util", "0.1.0")},
+		},
+		depErrs: map[string]error{
+			"@preview/util:0.1.0": &api.NotFoundError{Namespace: "preview", Name: "util", Version: "0.1.0"},
+			"@preview/b:1.0.0":    errUnavailable,
+		},
+	}
+
+	// Missing dependency data is no error
+	r := NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "a", "1.0.0")); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	r = NewWithFetcher(cacheDir, fetcher)
+	if err := r.Resolve(dep("preview", "b", "1.0.0")); !errors.Is(err, errUnavailable) {
+		t.Fatalf("Resolve() error = %v, want %v", err, errUnavailable)
+	}
+
+	r = NewWithFetcher(cacheDir, fetcher)
+	r.ContinueOnError = true
+	err := r.Resolve(dep("preview", "b", "1.0.0"), dep("preview", "a", "1.0.0"))
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("Resolve() error = %v, want *DownloadError", err)
+	}
+	if len(downloadErr.Failed) != 1 || downloadErr.Failed[0].Package.Key() != "@preview/b:1.0.0" {
+		t.Errorf("Failed = %+v", downloadErr.Failed)
+	}
+}
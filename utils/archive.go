@@ -3,13 +3,136 @@ package utils
 import (
 	"archive/tar"
 	"compress/gzip"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // ExtractTarGz extracts a tar.gz archive to the specified directory.
+// The archive is first extracted into a temporary sibling directory which
+// replaces destDir only once extraction succeeded, so destDir never holds a
+// partially extracted archive. The temporary directory is removed on failure.
 func ExtractTarGz(archivePath, destDir string) error {
+	parent := filepath.Dir(destDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(parent, "."+filepath.Base(destDir)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	trackTempDir(tmpDir)
+	defer untrackTempDir(tmpDir)
+
+	if err := extractTarGz(archivePath, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	// MkdirTemp creates the directory accessible to the owner only.
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := replaceDir(tmpDir, destDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	return nil
+}
+
+// backupInfix separates the name of a directory replaced by replaceDir from
+// the rest of the name of its backup.
+const backupInfix = ".old-"
+
+// replaceDir moves the directory src to dst, replacing any existing dst.
+// Renaming over an existing directory fails on Windows and for non-empty
+// directories elsewhere, so dst is first moved aside and only removed once
+// src is in place. If that fails, dst is restored. Between the two renames
+// dst does not exist; if the process dies then, the backup is left behind
+// and removed by the next replacement of dst.
+func replaceDir(src, dst string) error {
+	if err := removeBackups(dst); err != nil {
+		return err
+	}
+
+	backup := ""
+	if _, err := os.Lstat(dst); err == nil {
+		backup = filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+backupInfix+filepath.Base(src))
+		if err := os.Rename(dst, backup); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		if backup != "" {
+			os.Rename(backup, dst)
+		}
+		return err
+	}
+
+	if backup != "" {
+		return os.RemoveAll(backup)
+	}
+	return nil
+}
+
+// removeBackups removes the backups of dst left behind by interrupted
+// replacements.
+func removeBackups(dst string) error {
+	backups, err := Backups(filepath.Dir(dst))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, backup := range backups {
+		if target, _ := backupTarget(filepath.Base(backup)); target == filepath.Base(dst) {
+			if err := os.RemoveAll(backup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Backups returns the paths of the backups in dir that interrupted
+// replacements by ExtractTarGz left behind. The next extraction to the same
+// directory removes them.
+func Backups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if _, ok := backupTarget(entry.Name()); ok && entry.IsDir() {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return backups, nil
+}
+
+// backupTarget returns the name of the directory a backup made by
+// replaceDir was named after, and whether name is such a backup.
+func backupTarget(name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, ".")
+	if !ok {
+		return "", false
+	}
+	target, _, ok := strings.Cut(rest, backupInfix)
+	return target, ok && target != ""
+}
+
+// extractTarGz extracts a tar.gz archive into destDir in place, within the
+// limits of MaxExtractSize and MaxExtractFileSize. Symlinks and hard links
+// are recreated as long as they stay inside destDir.
+func extractTarGz(archivePath, destDir string) error {
 	file, err := os.Open(archivePath)
 	if err != nil {
 		return err
@@ -23,6 +146,7 @@ func ExtractTarGz(archivePath, destDir string) error {
 	defer gzr.Close()
 
 	tr := tar.NewReader(gzr)
+	var budget ExtractBudget
 
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return err
@@ -37,25 +161,62 @@ func ExtractTarGz(archivePath, destDir string) error {
 			return err
 		}
 
-		target := filepath.Join(destDir, header.Name)
+		target, err := EntryPath(destDir, header.Name)
+		if err != nil {
+			return err
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(target, 0755); err != nil {
 				return err
 			}
+			// MkdirAll does not touch existing directories, and the process
+			// umask applies to new ones, so set the mode explicitly.
+			if err := os.Chmod(target, archiveMode(header, 0755)); err != nil {
+				return err
+			}
 		case tar.TypeReg:
-			outFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			mode := archiveMode(header, 0644)
+			outFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 			if err != nil {
 				return err
 			}
-			if _, err := io.Copy(outFile, tr); err != nil {
+			if err := budget.Copy(outFile, tr, header.Name, header.Size); err != nil {
 				outFile.Close()
 				return err
 			}
 			outFile.Close()
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := Symlink(destDir, header.Name, header.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if err := Link(destDir, header.Name, header.Linkname); err != nil {
+				return err
+			}
 		}
 	}
 
-	return nil
+	return CheckSymlinks(destDir)
+}
+
+// archiveMode returns the permission bits to use for an extracted entry.
+// The mode stored in the header is honored, but group and world write bits
+// are always cleared and the owner keeps read/write (and search for
+// directories) access. Entries without any permission bits get fallback.
+func archiveMode(header *tar.Header, fallback os.FileMode) os.FileMode {
+	perm := header.FileInfo().Mode().Perm()
+	if perm == 0 {
+		return fallback
+	}
+
+	perm &^= 0022
+	if header.Typeflag == tar.TypeDir {
+		return perm | 0700
+	}
+	return perm | 0600
 }
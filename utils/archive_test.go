@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// archiveEntry describes a single entry written by writeArchive.
+type archiveEntry struct {
+	name     string
+	mode     int64
+	typeflag byte
+	content  string
+	linkname string
+}
+
+// writeArchive writes a tar.gz archive with the given entries to a
+// temporary file and returns its path.
+func writeArchive(t *testing.T, entries []archiveEntry) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pkg.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Mode:     e.mode,
+			Size:     int64(len(e.content)),
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if e.content != "" {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close() error = %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("gzip Close() error = %v", err)
+	}
+
+	return path
+}
+
+func TestExtractTarGzPreservesMode(t *testing.T) {
+	archive := writeArchive(t, []archiveEntry{
+		{name: "scripts", mode: 0750, typeflag: tar.TypeDir},
+		{name: "scripts/run.sh", mode: 0755, typeflag: tar.TypeReg, content: "#!/bin/sh"},
+		{name: "secret.typ", mode: 0600, typeflag: tar.TypeReg, content: "secret"},
+		{name: "open.typ", mode: 0666, typeflag: tar.TypeReg, content: "open"},
+	})
+
+	destDir := filepath.Join(t.TempDir(), "out")
+	if err := ExtractTarGz(archive, destDir); err != nil {
+		t.Fatalf("ExtractTarGz() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want os.FileMode
+	}{
+		{"scripts", 0750},
+		{"scripts/run.sh", 0755},
+		{"secret.typ", 0600},
+		// World and group write bits are never restored.
+		{"open.typ", 0644},
+	}
+
+	for _, tt := range tests {
+		info, err := os.Stat(filepath.Join(destDir, tt.path))
+		if err != nil {
+			t.Fatalf("Stat(%s) error = %v", tt.path, err)
+		}
+		if got := info.Mode().Perm(); got != tt.want {
+			t.Errorf("mode of %s = %o, want %o", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExtractTarGzWithoutMode(t *testing.T) {
+	archive := writeArchive(t, []archiveEntry{
+		{name: "lib.typ", typeflag: tar.TypeReg, content: "lib"},
+	})
+
+	destDir := filepath.Join(t.TempDir(), "out")
+	if err := ExtractTarGz(archive, destDir); err != nil {
+		t.Fatalf("ExtractTarGz() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(destDir, "lib.typ"))
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0644 {
+		t.Errorf("mode = %o, want 644", got)
+	}
+}
+
+func TestExtractTarGzFailureLeavesNoPartialDir(t *testing.T) {
+	// Incompressible content makes sure truncating the archive cuts into
+	// the second file, after the first one has been extracted.
+	rng := rand.New(rand.NewSource(1))
+	large := make([]byte, 256*1024)
+	rng.Read(large)
+
+	archive := writeArchive(t, []archiveEntry{
+		{name: "lib.typ", mode: 0644, typeflag: tar.TypeReg, content: "lib"},
+		{name: "data.bin", mode: 0644, typeflag: tar.TypeReg, content: string(large)},
+	})
+
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if err := os.Truncate(archive, info.Size()/2); err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+
+	parent := t.TempDir()
+	destDir := filepath.Join(parent, "1.0.0")
+	if err := ExtractTarGz(archive, destDir); err == nil {
+		t.Fatal("ExtractTarGz() expected error for truncated archive")
+	}
+
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("partial destination directory exists: %v", err)
+	}
+
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestExtractTarGzReplacesExisting(t *testing.T) {
+	archive := writeArchive(t, []archiveEntry{
+		{name: "lib.typ", mode: 0644, typeflag: tar.TypeReg, content: "new"},
+	})
+
+	destDir := filepath.Join(t.TempDir(), "1.0.0")
+	os.MkdirAll(destDir, 0755)
+	os.WriteFile(filepath.Join(destDir, "stale.typ"), []byte("old"), 0644)
+
+	if err := ExtractTarGz(archive, destDir); err != nil {
+		t.Fatalf("ExtractTarGz() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "stale.typ")); !os.IsNotExist(err) {
+		t.Error("stale file from previous extraction still exists")
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "lib.typ")); string(data) != "new" {
+		t.Errorf("lib.typ = %q, want %q", data, "new")
+	}
+}
+
+func TestReplaceDirRestoresOnFailure(t *testing.T) {
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "1.0.0")
+	os.MkdirAll(dst, 0755)
+	os.WriteFile(filepath.Join(dst, "lib.typ"), []byte("old"), 0644)
+
+	if err := replaceDir(filepath.Join(parent, "missing"), dst); err == nil {
+		t.Fatal("replaceDir() expected error for missing source")
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dst, "lib.typ")); string(data) != "old" {
+		t.Errorf("lib.typ = %q, want the previous content", data)
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Errorf("backup left behind: %v", entries)
+	}
+}
+
+func TestReplaceDirRemovesBackups(t *testing.T) {
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "1.0.0")
+	src := filepath.Join(parent, ".1.0.0.tmp-2")
+	// Left behind by a replacement interrupted after moving 1.0.0 aside
+	stale := filepath.Join(parent, ".1.0.0.old-.1.0.0.tmp-1")
+	other := filepath.Join(parent, ".2.0.0.old-.2.0.0.tmp-1")
+	for _, dir := range []string{src, stale, other} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := Backups(parent)
+	if err != nil {
+		t.Fatalf("Backups() error = %v", err)
+	}
+	if want := []string{stale, other}; !slices.Equal(backups, want) {
+		t.Errorf("Backups() = %v, want %v", backups, want)
+	}
+
+	if err := replaceDir(src, dst); err != nil {
+		t.Fatalf("replaceDir() error = %v", err)
+	}
+	// Only the backups of the replaced directory are removed
+	backups, _ = Backups(parent)
+	if want := []string{other}; !slices.Equal(backups, want) {
+		t.Errorf("Backups() after replaceDir() = %v, want %v", backups, want)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("replaceDir() did not create %s: %v", dst, err)
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "os"
+
+// ciEnvVars are set by common CI systems.
+var ciEnvVars = []string{
+	"CI",
+	"GITHUB_ACTIONS",
+	"GITLAB_CI",
+	"BUILDKITE",
+	"CIRCLECI",
+	"TRAVIS",
+	"JENKINS_URL",
+	"TF_BUILD",
+}
+
+// IsCI reports whether the program is running in a CI environment.
+func IsCI() bool {
+	for _, name := range ciEnvVars {
+		if v := os.Getenv(name); v != "" && v != "false" && v != "0" {
+			return true
+		}
+	}
+	return false
+}
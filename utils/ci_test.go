@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestIsCI(t *testing.T) {
+	for _, name := range ciEnvVars {
+		t.Setenv(name, "")
+	}
+	if IsCI() {
+		t.Error("IsCI() = true without CI variables")
+	}
+
+	t.Setenv("CI", "false")
+	if IsCI() {
+		t.Error("IsCI() = true with CI=false")
+	}
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	if !IsCI() {
+		t.Error("IsCI() = false with GITHUB_ACTIONS=true")
+	}
+}
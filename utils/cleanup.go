@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"os"
+	"sync"
+)
+
+var (
+	tempDirsMu sync.Mutex
+	// tempDirs holds the temporary directories of extractions in progress.
+	tempDirs = make(map[string]struct{})
+)
+
+func trackTempDir(dir string) {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	tempDirs[dir] = struct{}{}
+}
+
+func untrackTempDir(dir string) {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	delete(tempDirs, dir)
+}
+
+// RemoveTempDirs removes the temporary directories of extractions that are
+// still in progress. It is meant to be called when the process is
+// interrupted, so that no partially extracted package is left behind.
+func RemoveTempDirs() {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+
+	for dir := range tempDirs {
+		os.RemoveAll(dir)
+		delete(tempDirs, dir)
+	}
+}
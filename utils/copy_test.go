@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDir(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "src"), 0755)
+	os.WriteFile(filepath.Join(src, "lib.typ"), []byte("#import \"src/a.typ\""), 0644)
+	os.WriteFile(filepath.Join(src, "src", "a.typ"), []byte("a"), 0644)
+	os.Symlink("src/a.typ", filepath.Join(src, "link.typ"))
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := CopyDir(src, dst); err != nil {
+		t.Fatalf("CopyDir() error = %v", err)
+	}
+
+	srcHash, _ := HashDir(src)
+	dstHash, _ := HashDir(dst)
+	if srcHash != dstHash {
+		t.Error("copied tree differs from the source")
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link.typ")); err != nil || target != "src/a.typ" {
+		t.Errorf("Readlink() = %q, %v, want %q", target, err, "src/a.typ")
+	}
+
+	if err := CopyDir(src, dst); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("CopyDir() to an existing directory error = %v, want %v", err, fs.ErrExist)
+	}
+}
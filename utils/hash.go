@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// HashDir returns a SHA256 over the relative paths and contents of all
+// regular files below dir. File modes and timestamps are not included, so
+// two extractions of the same archive have the same hash.
+func HashDir(dir string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fileHash := sha256.New()
+		if _, err := io.Copy(fileHash, f); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%x\n", filepath.ToSlash(rel), fileHash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashFile returns the SHA256 of the file at path as a lowercase hex string,
+// the format used by the server, along with the size of the file. The file
+// is streamed, so it may be of any size.
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// WriteChecksumFile writes the SHA256 of the file at path to path+".sha256"
+// in the "<hash>  <filename>" format read by "sha256sum -c", and returns the
+// path of the checksum file. The filename is the base name of path, so the
+// check works from the directory holding both files.
+func WriteChecksumFile(path string) (string, error) {
+	sum, _, err := HashFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sumPath := path + ".sha256"
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	if err := os.WriteFile(sumPath, []byte(line), 0644); err != nil {
+		return "", err
+	}
+	return sumPath, nil
+}
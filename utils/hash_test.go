@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashDir(t *testing.T) {
+	writeFiles := func(files map[string]string) string {
+		dir := t.TempDir()
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+		}
+		return dir
+	}
+
+	base := map[string]string{"lib.typ": "#let x = 1", "src/util.typ": "#let y = 2"}
+	tests := []struct {
+		name  string
+		files map[string]string
+		same  bool
+	}{
+		{"identical", base, true},
+		{"changed content", map[string]string{"lib.typ": "#let x = 2", "src/util.typ": "#let y = 2"}, false},
+		{"renamed file", map[string]string{"lib.typ": "#let x = 1", "src/utils.typ": "#let y = 2"}, false},
+		{"extra file", map[string]string{"lib.typ": "#let x = 1", "src/util.typ": "#let y = 2", "new.typ": ""}, false},
+	}
+
+	want, err := HashDir(writeFiles(base))
+	if err != nil {
+		t.Fatalf("HashDir() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HashDir(writeFiles(tt.files))
+			if err != nil {
+				t.Fatalf("HashDir() error = %v", err)
+			}
+			if (got == want) != tt.same {
+				t.Errorf("HashDir() same = %v, want %v", got == want, tt.same)
+			}
+		})
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "package.tar.gz")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	sum, size, err := HashFile(path)
+	if err != nil {
+		t.Fatalf("HashFile() error = %v", err)
+	}
+	if want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; sum != want {
+		t.Errorf("HashFile() sum = %s, want %s", sum, want)
+	}
+	if size != 5 {
+		t.Errorf("HashFile() size = %d, want 5", size)
+	}
+}
+
+func TestWriteChecksumFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "package.tar.gz")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	sumPath, err := WriteChecksumFile(path)
+	if err != nil {
+		t.Fatalf("WriteChecksumFile() error = %v", err)
+	}
+	if sumPath != path+".sha256" {
+		t.Errorf("WriteChecksumFile() path = %s, want %s", sumPath, path+".sha256")
+	}
+
+	data, err := os.ReadFile(sumPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  package.tar.gz\n"
+	if string(data) != want {
+		t.Errorf("checksum file = %q, want %q", data, want)
+	}
+}
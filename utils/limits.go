@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Limits on the size of the files extracted from an archive, protecting
+// against archives that expand to fill the disk. They are far above the
+// size of any real package.
+var (
+	// MaxExtractSize limits the total size of the files in an archive.
+	MaxExtractSize int64 = 1 << 30
+	// MaxExtractFileSize limits the size of a single file in an archive.
+	MaxExtractFileSize int64 = 256 << 20
+)
+
+// ErrArchiveTooLarge is returned when an archive exceeds MaxExtractSize or
+// MaxExtractFileSize.
+var ErrArchiveTooLarge = errors.New("archive exceeds the extraction size limit")
+
+// SetMaxExtractSize raises or lowers both extraction limits to n bytes, for
+// legitimately large packages.
+func SetMaxExtractSize(n int64) {
+	MaxExtractSize = n
+	MaxExtractFileSize = n
+}
+
+// ParseSize parses a size such as "512", "300KB", "1.5GB" or "2 MB". Units
+// are powers of 1024, like those printed by FormatSize.
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(str, unit) {
+			multiplier = 1 << (10 * (i + 1))
+			str = strings.TrimSuffix(str, unit)
+			break
+		}
+	}
+	str = strings.TrimSpace(strings.TrimSuffix(str, "B"))
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB or 2GB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ExtractBudget keeps track of the bytes extracted from one archive.
+type ExtractBudget struct {
+	extracted int64
+}
+
+// Copy copies the archive entry name from r to w, failing with
+// ErrArchiveTooLarge once the entry or the archive as a whole exceeds the
+// limits. declared is the size stored in the archive, checked before
+// anything is copied; pass -1 if unknown.
+func (b *ExtractBudget) Copy(w io.Writer, r io.Reader, name string, declared int64) error {
+	limit := min(MaxExtractFileSize, MaxExtractSize-b.extracted)
+	if declared > limit {
+		return b.tooLarge(name)
+	}
+
+	// Archive headers may lie, so the limit is enforced while copying too
+	n, err := io.Copy(w, io.LimitReader(r, limit+1))
+	b.extracted += n
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		return b.tooLarge(name)
+	}
+	return nil
+}
+
+func (b *ExtractBudget) tooLarge(name string) error {
+	return fmt.Errorf("%s: %w (%s per file, %s in total)", name, ErrArchiveTooLarge,
+		FormatSize(MaxExtractFileSize), FormatSize(MaxExtractSize))
+}
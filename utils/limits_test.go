@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setLimits lowers the extraction limits for the duration of a test.
+func setLimits(t *testing.T, total, perFile int64) {
+	t.Helper()
+	oldTotal, oldFile := MaxExtractSize, MaxExtractFileSize
+	MaxExtractSize, MaxExtractFileSize = total, perFile
+	t.Cleanup(func() { MaxExtractSize, MaxExtractFileSize = oldTotal, oldFile })
+}
+
+func TestExtractTarGzSizeLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int64
+		perFile int64
+		wantErr bool
+	}{
+		{"within limits", 100, 50, false},
+		{"file too large", 100, 20, true},
+		{"archive too large", 50, 50, true},
+	}
+
+	entries := []archiveEntry{
+		{name: "a.typ", mode: 0644, typeflag: tar.TypeReg, content: strings.Repeat("a", 30)},
+		{name: "b.typ", mode: 0644, typeflag: tar.TypeReg, content: strings.Repeat("b", 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLimits(t, tt.total, tt.perFile)
+
+			destDir := filepath.Join(t.TempDir(), "1.0.0")
+			err := ExtractTarGz(writeArchive(t, entries), destDir)
+			if tt.wantErr {
+				if !errors.Is(err, ErrArchiveTooLarge) {
+					t.Fatalf("ExtractTarGz() error = %v, want ErrArchiveTooLarge", err)
+				}
+				if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+					t.Errorf("destination directory exists after failure: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractTarGz() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractBudgetIgnoresDeclaredSize(t *testing.T) {
+	setLimits(t, 100, 10)
+
+	// The declared size claims the entry is small, but the content is not
+	var budget ExtractBudget
+	var out bytes.Buffer
+	err := budget.Copy(&out, strings.NewReader(strings.Repeat("x", 1000)), "bomb", 5)
+	if !errors.Is(err, ErrArchiveTooLarge) {
+		t.Fatalf("Copy() error = %v, want ErrArchiveTooLarge", err)
+	}
+	if out.Len() > 11 {
+		t.Errorf("Copy() wrote %d bytes, want at most the limit plus one", out.Len())
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"512B", 512, false},
+		{"300KB", 300 << 10, false},
+		{"1.5gb", 3 << 29, false},
+		{"2 GB", 2 << 30, false},
+		{"", 0, true},
+		{"-1MB", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsafeEntry is returned for archive entries that would be written, or
+// whose links would point, outside of the extraction directory.
+var ErrUnsafeEntry = errors.New("archive entry escapes the extraction directory")
+
+// EntryPath returns where the archive entry name is extracted to in
+// destDir. Names that leave destDir, and names that are or are below a
+// symlink extracted earlier, are refused so that nothing is written through
+// a link.
+func EntryPath(destDir, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%s: %w", name, ErrUnsafeEntry)
+	}
+
+	dir := destDir
+	for _, part := range splitPath(filepath.Clean(name)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if err != nil {
+			break
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%s: %w", name, ErrUnsafeEntry)
+		}
+	}
+
+	return filepath.Join(destDir, name), nil
+}
+
+// Symlink creates the archive entry name in destDir as a symlink to
+// target. Absolute targets and targets outside of destDir are refused.
+// Links can point through other links, so CheckSymlinks must be called
+// once all entries are extracted.
+func Symlink(destDir, name, target string) error {
+	path, err := EntryPath(destDir, name)
+	if err != nil {
+		return err
+	}
+
+	target = filepath.FromSlash(target)
+	if filepath.IsAbs(target) || !within(destDir, filepath.Join(filepath.Dir(path), target)) {
+		return fmt.Errorf("%s -> %s: %w", name, target, ErrUnsafeEntry)
+	}
+
+	return os.Symlink(target, path)
+}
+
+// Link creates the archive entry name in destDir as a hard link to the
+// entry target extracted earlier.
+func Link(destDir, name, target string) error {
+	path, err := EntryPath(destDir, name)
+	if err != nil {
+		return err
+	}
+	targetPath, err := EntryPath(destDir, target)
+	if err != nil {
+		return err
+	}
+
+	// A hard link to a symlink would link to whatever the symlink points to
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s => %s: %w", name, target, ErrUnsafeEntry)
+	}
+
+	return os.Link(targetPath, path)
+}
+
+// CheckSymlinks verifies that every symlink in destDir resolves to a path
+// inside destDir. Links that do not resolve are left alone, as nothing can
+// be reached through them.
+func CheckSymlinks(destDir string) error {
+	root, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		resolved, err := filepath.EvalSymlinks(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !within(root, resolved) {
+			rel, _ := filepath.Rel(destDir, path)
+			return fmt.Errorf("%s: %w", rel, ErrUnsafeEntry)
+		}
+		return nil
+	})
+}
+
+// within reports whether path is dir or inside of it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// splitPath splits a relative path into its elements.
+func splitPath(path string) []string {
+	if path == "." {
+		return nil
+	}
+	dir, file := filepath.Split(path)
+	return append(splitPath(filepath.Clean(dir)), file)
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractTarGzSafeLinks(t *testing.T) {
+	archive := writeArchive(t, []archiveEntry{
+		{name: "assets/", mode: 0755, typeflag: tar.TypeDir},
+		{name: "assets/logo.svg", mode: 0644, typeflag: tar.TypeReg, content: "<svg/>"},
+		{name: "logo.svg", typeflag: tar.TypeSymlink, linkname: "assets/logo.svg"},
+		{name: "images", typeflag: tar.TypeSymlink, linkname: "assets"},
+		{name: "copy.svg", typeflag: tar.TypeLink, linkname: "assets/logo.svg"},
+	})
+
+	destDir := filepath.Join(t.TempDir(), "1.0.0")
+	if err := ExtractTarGz(archive, destDir); err != nil {
+		t.Fatalf("ExtractTarGz() error = %v", err)
+	}
+
+	for _, name := range []string{"logo.svg", "images/logo.svg", "copy.svg"} {
+		data, err := os.ReadFile(filepath.Join(destDir, name))
+		if err != nil {
+			t.Errorf("ReadFile(%s) error = %v", name, err)
+			continue
+		}
+		if string(data) != "<svg/>" {
+			t.Errorf("%s = %q, want %q", name, data, "<svg/>")
+		}
+	}
+
+	target, err := os.Readlink(filepath.Join(destDir, "logo.svg"))
+	if err != nil {
+		t.Fatalf("Readlink() error = %v", err)
+	}
+	if target != filepath.FromSlash("assets/logo.svg") {
+		t.Errorf("Readlink() = %q, want assets/logo.svg", target)
+	}
+}
+
+func TestExtractTarGzUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"parent directory", []archiveEntry{
+			{name: "../evil.typ", mode: 0644, typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"escaping symlink", []archiveEntry{
+			{name: "lib.typ", mode: 0644, typeflag: tar.TypeReg, content: "lib"},
+			{name: "secrets", typeflag: tar.TypeSymlink, linkname: "../../secrets"},
+		}},
+		{"absolute symlink", []archiveEntry{
+			{name: "passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+		}},
+		{"symlink through symlink", []archiveEntry{
+			{name: "here", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "up", typeflag: tar.TypeSymlink, linkname: "here/.."},
+		}},
+		{"write through symlink", []archiveEntry{
+			{name: "sub/", mode: 0755, typeflag: tar.TypeDir},
+			{name: "link", typeflag: tar.TypeSymlink, linkname: "sub"},
+			{name: "link/file.typ", mode: 0644, typeflag: tar.TypeReg, content: "x"},
+		}},
+		{"escaping hard link", []archiveEntry{
+			{name: "hosts", typeflag: tar.TypeLink, linkname: "../../hosts"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			destDir := filepath.Join(parent, "1.0.0")
+			err := ExtractTarGz(writeArchive(t, tt.entries), destDir)
+			if !errors.Is(err, ErrUnsafeEntry) {
+				t.Fatalf("ExtractTarGz() error = %v, want ErrUnsafeEntry", err)
+			}
+			if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+				t.Errorf("destination directory exists after failure: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil.typ")); !os.IsNotExist(err) {
+				t.Errorf("file written outside of the destination: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneEmptyParents(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "preview", "demo"), 0755)
+	os.MkdirAll(filepath.Join(root, "preview", "other", "1.0.0"), 0755)
+	os.MkdirAll(filepath.Join(root, "local", "lib"), 0755)
+
+	// Pruning a removed version of the only package in a namespace removes
+	// the namespace as well.
+	if err := PruneEmptyParents(filepath.Join(root, "local", "lib", "1.0.0"), root); err != nil {
+		t.Fatalf("PruneEmptyParents() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "local")); !os.IsNotExist(err) {
+		t.Errorf("empty namespace was not removed: %v", err)
+	}
+
+	// Other packages keep the namespace alive.
+	if err := PruneEmptyParents(filepath.Join(root, "preview", "demo"), root); err != nil {
+		t.Fatalf("PruneEmptyParents() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "preview", "demo")); !os.IsNotExist(err) {
+		t.Errorf("empty package directory was not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "preview", "other", "1.0.0")); err != nil {
+		t.Errorf("non-empty package was removed: %v", err)
+	}
+
+	// The root is never removed, even when empty.
+	empty := t.TempDir()
+	if err := PruneEmptyParents(empty, empty); err != nil {
+		t.Fatalf("PruneEmptyParents() error = %v", err)
+	}
+	if _, err := os.Stat(empty); err != nil {
+		t.Errorf("cache root was removed: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// IsReadOnlyDir reports whether dir exists but files cannot be created in
+// it, for example because it is on a read-only mount or the current user
+// lacks write permission. A missing dir is not read-only, as it is created
+// on demand.
+func IsReadOnlyDir(dir string) bool {
+	f, err := os.CreateTemp(dir, ".tpix-write-test-*")
+	if err != nil {
+		return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return false
+}
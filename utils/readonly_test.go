@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestIsReadOnlyDir(t *testing.T) {
+	dir := t.TempDir()
+	if IsReadOnlyDir(dir) {
+		t.Error("IsReadOnlyDir() = true for a writable dir")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("IsReadOnlyDir() left %d file(s) behind", len(entries))
+	}
+
+	if IsReadOnlyDir(filepath.Join(dir, "missing")) {
+		t.Error("IsReadOnlyDir() = true for a missing dir")
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	defer os.Chmod(dir, 0755)
+	if !IsReadOnlyDir(dir) {
+		t.Error("IsReadOnlyDir() = false for a read-only dir")
+	}
+}
@@ -0,0 +1,176 @@
+package version
+
+import (
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// archAliases lists the names release assets commonly use for a GOARCH.
+var archAliases = map[string][]string{
+	"amd64": {"amd64", "x86_64", "x64"},
+	"arm64": {"arm64", "aarch64"},
+	"386":   {"386", "i386", "i686", "x86"},
+}
+
+// osAliases lists the names release assets commonly use for a GOOS.
+var osAliases = map[string][]string{
+	"darwin":  {"darwin", "macos", "osx"},
+	"windows": {"windows", "win"},
+}
+
+// platform describes the system an asset is picked for.
+type platform struct {
+	goos   string
+	goarch string
+	// goarm is the ARM version for GOARCH=arm, e.g. 7.
+	goarm int
+	// musl is set on Linux systems using musl rather than glibc.
+	musl bool
+}
+
+// currentPlatform returns the platform tpix-cli is running on.
+func currentPlatform() platform {
+	return platform{
+		goos:   runtime.GOOS,
+		goarch: runtime.GOARCH,
+		goarm:  buildGOARM(),
+		musl:   runtime.GOOS == "linux" && isMusl(),
+	}
+}
+
+// buildGOARM returns the GOARM version this binary was built for, or 7 if
+// it is unknown. Binaries for older ARM versions also run on newer ones.
+func buildGOARM() int {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "GOARM" {
+				// e.g. "7" or "7,softfloat"
+				v, _, _ := strings.Cut(s.Value, ",")
+				if n, err := strconv.Atoi(v); err == nil {
+					return n
+				}
+			}
+		}
+	}
+	return 7
+}
+
+// isMusl reports whether the system uses the musl C library, which comes
+// with a dynamic loader named ld-musl-<arch>.so.1. It is a variable so
+// that tests do not depend on the system.
+var isMusl = func() bool {
+	matches, _ := filepath.Glob("/lib/ld-musl-*.so.1")
+	return len(matches) > 0
+}
+
+// matchAsset picks the release asset for p among assets named like
+// tpix-cli-<os>-<arch>[-<variant>].(tar.gz|zip), accepting common aliases
+// such as aarch64 for arm64. For 32-bit ARM the asset for the closest ARM
+// version not newer than p's is chosen, and on Linux the asset for the
+// system's C library is preferred.
+func matchAsset(assets []Asset, p platform) (Asset, bool) {
+	var best Asset
+	bestScore := 0
+	for _, asset := range assets {
+		if score := assetScore(asset.Name, p); score > bestScore {
+			best, bestScore = asset, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// assetScore rates how well an asset name fits p. Zero means the asset
+// cannot run on p at all.
+func assetScore(name string, p platform) int {
+	name = strings.ToLower(name)
+	var ok bool
+	if name, ok = strings.CutPrefix(name, "tpix-cli-"); !ok {
+		return 0
+	}
+	if strings.HasSuffix(name, ".tar.gz") {
+		name = strings.TrimSuffix(name, ".tar.gz")
+	} else if strings.HasSuffix(name, ".zip") {
+		name = strings.TrimSuffix(name, ".zip")
+	} else {
+		return 0
+	}
+
+	// Only split at "-", as arch names such as x86_64 contain "_"
+	tokens := strings.Split(name, "-")
+	if len(tokens) < 2 || !matchesAlias(tokens[0], p.goos, osAliases) {
+		return 0
+	}
+
+	archScore := archMatch(tokens[1], p)
+	if archScore == 0 {
+		return 0
+	}
+
+	// Prefer the C library of the system. Go binaries are usually static,
+	// so a mismatch is only a last resort rather than excluded.
+	libcScore := 2
+	for _, variant := range tokens[2:] {
+		switch variant {
+		case "musl":
+			if !p.musl {
+				libcScore = 1
+			} else {
+				libcScore = 3
+			}
+		case "gnu", "glibc":
+			if p.musl {
+				libcScore = 1
+			} else {
+				libcScore = 3
+			}
+		}
+	}
+
+	return archScore*10 + libcScore
+}
+
+// archMatch rates an architecture name of an asset for p: 10 for an exact
+// match and, for 32-bit ARM, less the further the ARM version is behind.
+func archMatch(arch string, p platform) int {
+	if p.goarch != "arm" {
+		if matchesAlias(arch, p.goarch, archAliases) {
+			return 10
+		}
+		return 0
+	}
+
+	// arm, armv7, armv7l, armhf (v7) or armel (v5)
+	switch arch {
+	case "arm":
+		return 1
+	case "armhf":
+		arch = "armv7"
+	case "armel":
+		arch = "armv5"
+	}
+	v, ok := strings.CutPrefix(arch, "armv")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(v, "l"))
+	if err != nil || n > p.goarm || p.goarm-n >= 9 {
+		return 0
+	}
+	return 10 - (p.goarm - n)
+}
+
+// matchesAlias reports whether name is value or one of its aliases.
+func matchesAlias(name, value string, aliases map[string][]string) bool {
+	if name == value {
+		return true
+	}
+	for _, alias := range aliases[value] {
+		if name == alias {
+			return true
+		}
+	}
+	return false
+}
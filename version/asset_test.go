@@ -0,0 +1,61 @@
+package version
+
+import "testing"
+
+func TestMatchAsset(t *testing.T) {
+	names := []string{
+		"checksums.txt",
+		"tpix-cli-darwin-amd64.tar.gz",
+		"tpix-cli-darwin-arm64.tar.gz",
+		"tpix-cli-linux-x86_64-gnu.tar.gz",
+		"tpix-cli-linux-x86_64-musl.tar.gz",
+		"tpix-cli-linux-aarch64.tar.gz",
+		"tpix-cli-linux-armv6.tar.gz",
+		"tpix-cli-linux-armv7.tar.gz",
+		"tpix-cli-windows-amd64.zip",
+		"tpix-cli-windows-386.zip",
+	}
+	var assets []Asset
+	for _, name := range names {
+		assets = append(assets, Asset{Name: name})
+	}
+
+	tests := []struct {
+		name     string
+		platform platform
+		want     string
+	}{
+		{"macOS", platform{goos: "darwin", goarch: "arm64"}, "tpix-cli-darwin-arm64.tar.gz"},
+		{"glibc", platform{goos: "linux", goarch: "amd64"}, "tpix-cli-linux-x86_64-gnu.tar.gz"},
+		{"musl", platform{goos: "linux", goarch: "amd64", musl: true}, "tpix-cli-linux-x86_64-musl.tar.gz"},
+		{"arm64 alias", platform{goos: "linux", goarch: "arm64"}, "tpix-cli-linux-aarch64.tar.gz"},
+		{"armv7", platform{goos: "linux", goarch: "arm", goarm: 7}, "tpix-cli-linux-armv7.tar.gz"},
+		{"armv6", platform{goos: "linux", goarch: "arm", goarm: 6}, "tpix-cli-linux-armv6.tar.gz"},
+		{"windows 386", platform{goos: "windows", goarch: "386"}, "tpix-cli-windows-386.zip"},
+		{"armv5", platform{goos: "linux", goarch: "arm", goarm: 5}, ""},
+		{"unsupported", platform{goos: "freebsd", goarch: "amd64"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchAsset(assets, tt.platform)
+			if ok != (tt.want != "") || got.Name != tt.want {
+				t.Errorf("matchAsset() = %q, %v, want %q", got.Name, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAssetGenericArm(t *testing.T) {
+	assets := []Asset{{Name: "tpix-cli-linux-arm.tar.gz"}, {Name: "tpix-cli-linux-armhf.tar.gz"}}
+
+	got, ok := matchAsset(assets, platform{goos: "linux", goarch: "arm", goarm: 7})
+	if !ok || got.Name != "tpix-cli-linux-armhf.tar.gz" {
+		t.Errorf("matchAsset(armv7) = %q, want the armhf asset", got.Name)
+	}
+
+	got, ok = matchAsset(assets, platform{goos: "linux", goarch: "arm", goarm: 6})
+	if !ok || got.Name != "tpix-cli-linux-arm.tar.gz" {
+		t.Errorf("matchAsset(armv6) = %q, want the generic arm asset", got.Name)
+	}
+}
@@ -0,0 +1,75 @@
+package version
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when a downloaded release asset does not
+// match the SHA256 listed in the checksums asset of the release.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// findChecksumsAsset returns the asset of a release listing the SHA256 of
+// the other assets, named checksums.txt or e.g. tpix-cli_1.0.0_checksums.txt.
+func findChecksumsAsset(assets []Asset) (Asset, bool) {
+	for _, asset := range assets {
+		name := strings.ToLower(asset.Name)
+		if name == "checksums.txt" || strings.HasSuffix(name, "_checksums.txt") || strings.HasSuffix(name, "-checksums.txt") {
+			return asset, true
+		}
+	}
+	return Asset{}, false
+}
+
+// parseChecksums parses the output of sha256sum: one "<sha256>  <name>"
+// line per file, where the name may be prefixed with "*" in binary mode.
+func parseChecksums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// fetchChecksum downloads the checksums asset and returns the SHA256 listed
+// for the asset name.
+func fetchChecksum(client *http.Client, checksums Asset, name string) (string, error) {
+	req, err := http.NewRequest("GET", checksums.DownloadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", UserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", checksums.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: status %d", checksums.Name, resp.StatusCode)
+	}
+
+	sums, err := parseChecksums(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", checksums.Name, err)
+	}
+
+	sum, ok := sums[name]
+	if !ok {
+		return "", fmt.Errorf("%s has no checksum for %s", checksums.Name, name)
+	}
+	return sum, nil
+}
@@ -0,0 +1,75 @@
+package version
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	input := `2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  tpix-cli-linux-amd64.tar.gz
+486EA46224D1BB4FB680F34F7C9AD96A8F24EC88BE73EA8E5A6C65260E9CB8A7 *tpix-cli-windows-amd64.zip
+
+not a checksum line
+`
+	sums, err := parseChecksums(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseChecksums() error = %v", err)
+	}
+
+	want := map[string]string{
+		"tpix-cli-linux-amd64.tar.gz": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"tpix-cli-windows-amd64.zip":  "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7",
+	}
+	if len(sums) != len(want) {
+		t.Fatalf("parseChecksums() = %v, want %v", sums, want)
+	}
+	for name, sum := range want {
+		if sums[name] != sum {
+			t.Errorf("checksum of %s = %q, want %q", name, sums[name], sum)
+		}
+	}
+}
+
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	content := []byte("not really an archive")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	t.Cleanup(srv.Close)
+
+	asset := Asset{Name: "tpix-cli-linux-amd64.tar.gz", Size: len(content), DownloadURL: srv.URL}
+	destDir := t.TempDir()
+	dl := newDownloader(asset, destDir)
+	dl.sha256 = strings.Repeat("0", 64)
+
+	finished := false
+	progress := dl.Download(context.Background(), func() error {
+		finished = true
+		return nil
+	})
+	for range progress.Progress() {
+	}
+
+	if !errors.Is(progress.Err, ErrChecksumMismatch) {
+		t.Fatalf("Download() error = %v, want ErrChecksumMismatch", progress.Err)
+	}
+	if finished {
+		t.Error("onFinished called for a download with a wrong checksum")
+	}
+
+	sum := sha256.Sum256(content)
+	if !strings.Contains(progress.Err.Error(), hex.EncodeToString(sum[:])) {
+		t.Errorf("error %q does not mention the actual checksum", progress.Err)
+	}
+	// The download is rejected and removed before it is extracted
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("download directory left behind: %v", err)
+	}
+}
@@ -2,6 +2,9 @@ package version
 
 import (
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +17,8 @@ import (
 
 	"archive/tar"
 	"archive/zip"
+
+	"github.com/typstify/tpix-cli/utils"
 )
 
 // DownloadCounter counts the number of bytes written to it. It implements to the io.Writer interface
@@ -21,6 +26,7 @@ import (
 type DownloadProgress struct {
 	finished   atomic.Uint64
 	total      uint64
+	start      time.Time
 	reportChan chan float32
 	Err        error
 }
@@ -39,20 +45,52 @@ func (dp *DownloadProgress) Progress() chan float32 {
 	return dp.reportChan
 }
 
+// Received returns the number of bytes downloaded so far.
+func (dp *DownloadProgress) Received() uint64 {
+	return dp.finished.Load()
+}
+
+// Speed returns the average download speed in bytes per second since the
+// download started.
+func (dp *DownloadProgress) Speed() float64 {
+	elapsed := time.Since(dp.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(dp.Received()) / elapsed
+}
+
+// ETA estimates the time left until the download completes at the current
+// average speed. It is zero if the speed is not known yet.
+func (dp *DownloadProgress) ETA() time.Duration {
+	speed := dp.Speed()
+	received := dp.Received()
+	if speed == 0 || received >= dp.total {
+		return 0
+	}
+	return time.Duration(float64(dp.total-received) / speed * float64(time.Second))
+}
+
 func (dp *DownloadProgress) Done() {
 	close(dp.reportChan)
 }
 
 // Downloader check and download the latest version of TPIX CLI.
 type Downloader struct {
-	asset   Asset
+	asset Asset
+	// destDir is a temporary directory the asset is downloaded and
+	// extracted to. It is removed if the download fails.
 	destDir string
 	client  *http.Client
+	// sha256 is the expected checksum of the asset. The asset is not
+	// extracted unless it matches.
+	sha256 string
 }
 
 func newDownloadProgress(total uint64) *DownloadProgress {
 	return &DownloadProgress{
 		total:      total,
+		start:      time.Now(),
 		reportChan: make(chan float32, 5),
 	}
 }
@@ -74,27 +112,38 @@ func newDownloader(asset Asset, destDir string) *Downloader {
 
 }
 
-func (d *Downloader) get(url string) (*http.Response, error) {
-	request, err := http.NewRequest("GET", url, nil)
+func (d *Downloader) get(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	request.Header.Set("User-Agent", UserAgent())
 
 	return d.client.Do(request)
 }
 
 // Download downloads the release file in async manner, and reports its progress.
-func (d *Downloader) Download(onFinished func()) *DownloadProgress {
+// onFinished is called once the download is verified and extracted, and
+// any error it returns is reported as the error of the download.
+// Cancelling ctx aborts the download.
+func (d *Downloader) Download(ctx context.Context, onFinished func() error) *DownloadProgress {
 	progress := newDownloadProgress(uint64(d.asset.Size))
 
 	go func() {
 		defer progress.Done()
+		defer func() {
+			if progress.Err != nil {
+				os.RemoveAll(d.destDir)
+			}
+		}()
+
 		// download the asset
-		resp, err := d.get(d.asset.DownloadURL)
+		resp, err := d.get(ctx, d.asset.DownloadURL)
 		if err != nil {
 			progress.Err = err
 			return
 		}
+		defer resp.Body.Close()
 
 		var targetFile *os.File
 		targetFile, err = os.OpenFile(filepath.Join(d.destDir, d.asset.Name), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
@@ -105,8 +154,18 @@ func (d *Downloader) Download(onFinished func()) *DownloadProgress {
 
 		defer targetFile.Close()
 
-		if n, err := io.Copy(targetFile, io.TeeReader(resp.Body, progress)); err != nil || n != int64(d.asset.Size) {
-			progress.Err = errors.New("Download error")
+		hash := sha256.New()
+		if n, err := io.Copy(io.MultiWriter(targetFile, hash), io.TeeReader(resp.Body, progress)); err != nil || n != int64(d.asset.Size) {
+			if ctx.Err() != nil {
+				progress.Err = ctx.Err()
+			} else {
+				progress.Err = errors.New("Download error")
+			}
+			return
+		}
+
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != d.sha256 {
+			progress.Err = fmt.Errorf("%s: %w: expected %s, got %s", d.asset.Name, ErrChecksumMismatch, d.sha256, sum)
 			return
 		}
 
@@ -118,7 +177,7 @@ func (d *Downloader) Download(onFinished func()) *DownloadProgress {
 		}
 
 		if onFinished != nil {
-			onFinished()
+			progress.Err = onFinished()
 		}
 	}()
 
@@ -157,6 +216,7 @@ func (d *Downloader) uncompressTarFile(targetFile *os.File, destDir string) erro
 
 	// Create a tar Reader from the decompressed stream
 	tr := tar.NewReader(gz)
+	var budget utils.ExtractBudget
 	// Iterate through the files in the archive.
 	for {
 		header, err := tr.Next()
@@ -166,28 +226,40 @@ func (d *Downloader) uncompressTarFile(targetFile *os.File, destDir string) erro
 		if err != nil {
 			return err
 		}
+		target, err := utils.EntryPath(destDir, header.Name)
+		if err != nil {
+			return err
+		}
 		switch header.Typeflag {
 		case tar.TypeDir:
 			// create a directory
-			err = os.MkdirAll(filepath.Join(destDir, header.Name), 0755)
+			err = os.MkdirAll(target, 0755)
 			if err != nil {
 				return err
 			}
 		case tar.TypeReg:
 			// write a file
-			w, err := os.Create(filepath.Join(destDir, header.Name))
+			w, err := os.Create(target)
 			if err != nil {
 				return err
 			}
-			_, err = io.Copy(w, tr)
+			err = budget.Copy(w, tr, header.Name, header.Size)
+			w.Close()
 			if err != nil {
 				return err
 			}
-			w.Close()
+		case tar.TypeSymlink:
+			if err := utils.Symlink(destDir, header.Name, header.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if err := utils.Link(destDir, header.Name, header.Linkname); err != nil {
+				return err
+			}
 		}
 	}
 
-	return nil
+	return utils.CheckSymlinks(destDir)
 }
 
 func (d *Downloader) unzipFile(targetFile *os.File, destDir string) error {
@@ -200,19 +272,33 @@ func (d *Downloader) unzipFile(targetFile *os.File, destDir string) error {
 	if err != nil {
 		return err
 	}
+	var budget utils.ExtractBudget
 
 	for _, f := range r.File {
+		target, err := utils.EntryPath(destDir, f.Name)
+		if err != nil {
+			return err
+		}
+
 		if f.FileInfo().IsDir() {
 			// create a directory
-			err = os.MkdirAll(filepath.Join(destDir, f.Name), 0755)
+			err = os.MkdirAll(target, 0755)
 			if err != nil {
 				return err
 			}
 			continue
 		}
 
+		if f.Mode()&os.ModeSymlink != 0 {
+			// the content of a symlink entry is its target
+			if err := unzipSymlink(f, destDir); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// normal file, write to destDir directly.
-		dest, err := os.Create(filepath.Join(destDir, f.Name))
+		dest, err := os.Create(target)
 		if err != nil {
 			return err
 		}
@@ -224,12 +310,28 @@ func (d *Downloader) unzipFile(targetFile *os.File, destDir string) error {
 		}
 		defer rc.Close()
 
-		_, err = io.Copy(dest, rc)
+		err = budget.Copy(dest, rc, f.Name, int64(f.UncompressedSize64))
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return utils.CheckSymlinks(destDir)
+
+}
+
+func unzipSymlink(f *zip.File, destDir string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var target strings.Builder
+	var budget utils.ExtractBudget
+	if err := budget.Copy(&target, rc, f.Name, int64(f.UncompressedSize64)); err != nil {
+		return err
+	}
 
+	return utils.Symlink(destDir, f.Name, target.String())
 }
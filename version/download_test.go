@@ -0,0 +1,62 @@
+package version
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadProgressSpeedAndETA(t *testing.T) {
+	dp := newDownloadProgress(1000)
+	if dp.ETA() != 0 {
+		t.Errorf("ETA() = %v before any data, want 0", dp.ETA())
+	}
+
+	dp.start = time.Now().Add(-2 * time.Second)
+	dp.finished.Store(250)
+
+	if speed := dp.Speed(); speed < 120 || speed > 125 {
+		t.Errorf("Speed() = %.1f, want about 125 bytes/s", speed)
+	}
+	if eta := dp.ETA(); eta < 5900*time.Millisecond || eta > 6100*time.Millisecond {
+		t.Errorf("ETA() = %v, want about 6s", eta)
+	}
+
+	dp.finished.Store(1000)
+	if dp.ETA() != 0 {
+		t.Errorf("ETA() = %v after completion, want 0", dp.ETA())
+	}
+}
+
+func TestDownloadCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000000")
+		w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	destDir := filepath.Join(t.TempDir(), "update")
+	os.Mkdir(destDir, 0755)
+	dl := newDownloader(Asset{Name: "tpix-cli-linux-amd64.tar.gz", Size: 1000000, DownloadURL: srv.URL}, destDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := dl.Download(ctx, nil)
+	for range progress.Progress() {
+		cancel()
+	}
+
+	if !errors.Is(progress.Err, context.Canceled) {
+		t.Fatalf("Download() error = %v, want context.Canceled", progress.Err)
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("partial download left behind: %v", err)
+	}
+}
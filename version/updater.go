@@ -1,12 +1,12 @@
 package version
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -14,8 +14,18 @@ import (
 	"golang.org/x/mod/semver"
 )
 
-const (
+// The release URLs are variables so that tests can point them at a fake
+// server.
+var (
 	latestReleaseUrl = "https://api.github.com/repos/typstify/tpix-cli/releases/latest"
+	// releaseByTagUrl is formatted with the tag of a release.
+	releaseByTagUrl = "https://api.github.com/repos/typstify/tpix-cli/releases/tags/%s"
+)
+
+const (
+	// ReleaseCacheTTL is how long a cached release lookup is used before
+	// GitHub is asked again.
+	ReleaseCacheTTL = 24 * time.Hour
 )
 
 type GithubRelease struct {
@@ -35,14 +45,29 @@ type Asset struct {
 }
 
 type Updater struct {
+	// CacheFile, if set, is where the latest release is cached for
+	// ReleaseCacheTTL, as GitHub rate limits unauthenticated requests.
+	CacheFile string
+	// Refresh ignores the cached release and asks GitHub again.
+	Refresh bool
+
 	latestRelease *Release
 }
 
+// cachedRelease is the content of Updater.CacheFile.
+type cachedRelease struct {
+	CheckedAt time.Time     `json:"checkedAt"`
+	Release   GithubRelease `json:"release"`
+}
+
 type Release struct {
 	Asset
 	Version     string
 	Changelog   string
 	PublishedAt time.Time
+	// Checksums is the asset listing the SHA256 of the release assets, or
+	// empty if the release has none.
+	Checksums Asset
 }
 
 // Check queries che GitHub release API to see if there is a new
@@ -61,6 +86,29 @@ func (u *Updater) Check() (bool, error) {
 
 }
 
+// UseVersion selects the release tagged with version, with or without the
+// leading "v", as the one Update installs instead of the latest release.
+// An error is returned if there is no such release or it has no asset for
+// the current platform.
+func (u *Updater) UseVersion(version string) (*Release, error) {
+	tag, err := normVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := fetchGithubRelease(fmt.Sprintf(releaseByTagUrl, tag))
+	if err != nil {
+		return nil, err
+	}
+	r, err := matchRelease(release)
+	if err != nil {
+		return nil, err
+	}
+
+	u.latestRelease = r
+	return r, nil
+}
+
 func (u *Updater) Latest() (*Release, error) {
 	if u.latestRelease == nil {
 		r, err := u.getRelease()
@@ -75,13 +123,29 @@ func (u *Updater) Latest() (*Release, error) {
 }
 
 // Update downloads the specified version to disk and replace the
-// current version.
-func (u *Updater) Update() (*DownloadProgress, error) {
+// current version. The download is verified against the checksums asset of
+// the release, and the current version is kept if that is not possible.
+// Cancelling ctx aborts the download and keeps the current version too.
+func (u *Updater) Update(ctx context.Context) (*DownloadProgress, error) {
 
 	if u.latestRelease == nil {
 		return nil, fmt.Errorf("Check if there is a new version first!")
 	}
 
+	if u.latestRelease.Checksums.DownloadURL == "" {
+		return nil, fmt.Errorf("release %s has no checksums.txt, the download cannot be verified", u.latestRelease.Version)
+	}
+
+	dl := newDownloader(u.latestRelease.Asset, "")
+	if dl == nil {
+		return nil, fmt.Errorf("release %s has no download URL for %s", u.latestRelease.Version, u.latestRelease.Name)
+	}
+	sum, err := fetchChecksum(dl.client, u.latestRelease.Checksums, u.latestRelease.Name)
+	if err != nil {
+		return nil, err
+	}
+	dl.sha256 = sum
+
 	// Download to temp directory first, then move to final location
 	// This avoids issues with replacing the running executable
 	tempDir, err := os.MkdirTemp("", "tpix-update-*")
@@ -89,24 +153,85 @@ func (u *Updater) Update() (*DownloadProgress, error) {
 		return nil, err
 	}
 
-	dl := newDownloader(u.latestRelease.Asset, tempDir)
+	dl.destDir = tempDir
 
-	progress := dl.Download(func() {
-		onDownloadFinished(tempDir)
-		os.RemoveAll(tempDir)
+	progress := dl.Download(ctx, func() error {
+		defer os.RemoveAll(tempDir)
+		return onDownloadFinished(tempDir)
 	})
 
 	return progress, nil
 }
 
 func (d *Updater) getRelease() (*Release, error) {
-	// Get release meta from Github API
-	resp, err := http.Get(latestReleaseUrl)
+	release, err := d.latestGithubRelease()
+	if err != nil {
+		return nil, err
+	}
+
+	return matchRelease(release)
+}
+
+// matchRelease picks the asset for the current platform from a release.
+func matchRelease(release *GithubRelease) (*Release, error) {
+	// asset name should be like 'tpix-cli-windows-amd64.tar.gz'
+	target, ok := matchAsset(release.Assets, currentPlatform())
+	if !ok {
+		return nil, fmt.Errorf("No matched release for %s-%s in %s", runtime.GOOS, runtime.GOARCH, release.TagName)
+	}
+
+	checksums, _ := findChecksumsAsset(release.Assets)
+
+	return &Release{
+		Asset:       target,
+		Version:     release.TagName,
+		Changelog:   release.Body,
+		PublishedAt: release.PublishedAt,
+		Checksums:   checksums,
+	}, nil
+}
+
+// latestGithubRelease returns the latest release from the cache file if it
+// is fresh, and from the GitHub API otherwise, caching the response.
+func (d *Updater) latestGithubRelease() (*GithubRelease, error) {
+	if d.CacheFile != "" && !d.Refresh {
+		if cached, err := loadCachedRelease(d.CacheFile); err == nil && time.Since(cached.CheckedAt) < ReleaseCacheTTL {
+			return &cached.Release, nil
+		}
+	}
+
+	release, err := fetchGithubRelease(latestReleaseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.CacheFile != "" {
+		// Failing to cache only means asking GitHub again next time
+		_ = saveCachedRelease(d.CacheFile, &cachedRelease{CheckedAt: time.Now(), Release: *release})
+	}
+
+	return release, nil
+}
+
+// fetchGithubRelease gets the release metadata at url from the GitHub API.
+func fetchGithubRelease(url string) (*GithubRelease, error) {
+	req, err := newGithubRequest(url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("release not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub release API returned status %d", resp.StatusCode)
+	}
+
 	decoder := json.NewDecoder(resp.Body)
 	var release GithubRelease
 	err = decoder.Decode(&release)
@@ -114,62 +239,125 @@ func (d *Updater) getRelease() (*Release, error) {
 		return nil, err
 	}
 
-	// asset name should be like 'tpix-cli-windows-amd64.tar.gz'
-	assetNamePat := fmt.Sprintf(`^tpix-cli-%s-%s-?\w*?\.(tar\.gz|zip)$`, runtime.GOOS, runtime.GOARCH)
-	//log.Println("re pattern: ", assetNamePat)
-	re := regexp.MustCompile(assetNamePat)
-	var target Asset
-	for _, asset := range release.Assets {
-		if re.Match([]byte(asset.Name)) {
-			target = asset
+	return &release, nil
+}
+
+// newGithubRequest creates a GET request to the GitHub API. GitHub requires
+// a User-Agent, and a token from GITHUB_TOKEN or GH_TOKEN lifts the rate
+// limit of unauthenticated requests, which is shared by everyone behind the
+// same IP address, e.g. in CI.
+func newGithubRequest(url string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", UserAgent())
+	for _, env := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := os.Getenv(env); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
 			break
 		}
 	}
 
-	if target == (Asset{}) {
-		return nil, fmt.Errorf("No matched release for %s-%s", runtime.GOOS, runtime.GOARCH)
+	return req, nil
+}
+
+func loadCachedRelease(path string) (*cachedRelease, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Release{
-		Asset:       target,
-		Version:     release.TagName,
-		Changelog:   release.Body,
-		PublishedAt: release.PublishedAt,
-	}, nil
+	var cached cachedRelease
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	return &cached, nil
 }
 
-func onDownloadFinished(tempDir string) {
+func saveCachedRelease(path string, cached *cachedRelease) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// onDownloadFinished replaces the running executable with the binary
+// extracted to tempDir. The replaced binary is kept with an ".old" suffix
+// for Rollback; Windows locks the running executable, which can be renamed
+// but not overwritten.
+func onDownloadFinished(tempDir string) error {
 	binaryName := "tpix"
 	if runtime.GOOS == "windows" {
 		binaryName = "tpix.exe"
 	}
 
 	newBinPath := filepath.Join(tempDir, binaryName)
+	if _, err := os.Stat(newBinPath); err != nil {
+		return fmt.Errorf("release archive has no %s: %w", binaryName, err)
+	}
 	exePath, err := os.Executable()
 	if err != nil {
-		return
+		return err
 	}
 
 	// Ensure the new file is executable
 	os.Chmod(newBinPath, 0755)
 
-	if runtime.GOOS == "windows" {
-		// Windows locks the running executable file, rename current to .old, then move new to current
-		oldPath := exePath + ".old"
-		os.Remove(oldPath)
+	return replaceBinary(newBinPath, exePath)
+}
 
-		if err := os.Rename(exePath, oldPath); err != nil {
-			fmt.Printf("Windows: Failed to rename running exe: %v\n", err)
-			return
-		}
+// replaceBinary moves newBinPath to exePath, keeping the current exePath as
+// exePath.old. If the move fails, the current binary is restored.
+func replaceBinary(newBinPath, exePath string) error {
+	oldPath := exePath + ".old"
+	os.Remove(oldPath)
+
+	if err := os.Rename(exePath, oldPath); err != nil {
+		return fmt.Errorf("failed to move the current binary aside: %w", err)
 	}
 
 	// Use a robust move/copy
-	err = moveFile(newBinPath, exePath)
+	if err := moveFile(newBinPath, exePath); err != nil {
+		os.Rename(oldPath, exePath)
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+
+	return nil
+}
+
+// Rollback restores the binary replaced by the last update, which is kept
+// next to the executable with an ".old" suffix. The current binary takes its
+// place, so rolling back twice returns to the updated version.
+func Rollback() error {
+	exePath, err := os.Executable()
 	if err != nil {
-		fmt.Printf("Failed to replace binary: %v\n", err)
-		return
+		return err
 	}
+	return rollback(exePath)
+}
+
+func rollback(exePath string) error {
+	oldPath := exePath + ".old"
+	if _, err := os.Stat(oldPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no previous version to roll back to (%s does not exist)", oldPath)
+		}
+		return err
+	}
+
+	swapPath := exePath + ".rollback"
+	if err := os.Rename(exePath, swapPath); err != nil {
+		return fmt.Errorf("failed to move the current binary aside: %w", err)
+	}
+	if err := os.Rename(oldPath, exePath); err != nil {
+		os.Rename(swapPath, exePath)
+		return fmt.Errorf("failed to restore the previous binary: %w", err)
+	}
+	return os.Rename(swapPath, oldPath)
 }
 
 func moveFile(src, dst string) error {
@@ -195,16 +383,36 @@ func moveFile(src, dst string) error {
 // if v1 is newer than v2. It returns true if v1 is newer than
 // v2, otherwise it returns false.
 func compareVersion(v1, v2 string) (bool, error) {
-	ver1, err := normVersion(v1)
+	c, err := Compare(v1, v2)
 	if err != nil {
 		return false, err
 	}
+
+	return c > 0, nil
+}
+
+// Compare compares two semantic version strings, with or without the
+// leading "v". The result is 0 if v1 == v2, -1 if v1 < v2, or +1 if v1 > v2.
+func Compare(v1, v2 string) (int, error) {
+	ver1, err := normVersion(v1)
+	if err != nil {
+		return 0, err
+	}
 	ver2, err := normVersion(v2)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
 
-	return semver.Compare(ver1, ver2) > 0, nil
+	return semver.Compare(ver1, ver2), nil
+}
+
+// AtLeast reports whether version v is the same as or newer than min.
+func AtLeast(v, min string) (bool, error) {
+	c, err := Compare(v, min)
+	if err != nil {
+		return false, err
+	}
+	return c >= 0, nil
 }
 
 func normVersion(ver string) (string, error) {
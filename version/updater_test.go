@@ -0,0 +1,164 @@
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLatestGithubReleaseCache(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(GithubRelease{TagName: "v2.0.0"})
+	}))
+	t.Cleanup(srv.Close)
+
+	origURL := latestReleaseUrl
+	latestReleaseUrl = srv.URL
+	t.Cleanup(func() { latestReleaseUrl = origURL })
+
+	cacheFile := filepath.Join(t.TempDir(), "latest-release.json")
+
+	tests := []struct {
+		name         string
+		refresh      bool
+		checkedAt    time.Time
+		wantTag      string
+		wantRequests int
+	}{
+		{"fresh cache", false, time.Now().Add(-time.Hour), "v1.0.0", 0},
+		{"refresh", true, time.Now().Add(-time.Hour), "v2.0.0", 1},
+		{"expired cache", false, time.Now().Add(-2 * ReleaseCacheTTL), "v2.0.0", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			saveCachedRelease(cacheFile, &cachedRelease{CheckedAt: tt.checkedAt, Release: GithubRelease{TagName: "v1.0.0"}})
+
+			u := &Updater{CacheFile: cacheFile, Refresh: tt.refresh}
+			release, err := u.latestGithubRelease()
+			if err != nil {
+				t.Fatalf("latestGithubRelease() error = %v", err)
+			}
+			if release.TagName != tt.wantTag || requests != tt.wantRequests {
+				t.Errorf("latestGithubRelease() = %s with %d requests, want %s with %d", release.TagName, requests, tt.wantTag, tt.wantRequests)
+			}
+
+			// A fetched release replaces the cached one
+			cached, err := loadCachedRelease(cacheFile)
+			if err != nil {
+				t.Fatalf("loadCachedRelease() error = %v", err)
+			}
+			if cached.Release.TagName != tt.wantTag {
+				t.Errorf("cached release = %s, want %s", cached.Release.TagName, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestNewGithubRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		githubToken string
+		ghToken     string
+		wantAuth    string
+	}{
+		{"anonymous", "", "", ""},
+		{"GITHUB_TOKEN", "github-secret", "gh-secret", "Bearer github-secret"},
+		{"GH_TOKEN", "", "gh-secret", "Bearer gh-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", tt.githubToken)
+			t.Setenv("GH_TOKEN", tt.ghToken)
+
+			req, err := newGithubRequest(latestReleaseUrl)
+			if err != nil {
+				t.Fatalf("newGithubRequest() error = %v", err)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", got, tt.wantAuth)
+			}
+			if got := req.Header.Get("Accept"); got != "application/vnd.github+json" {
+				t.Errorf("Accept = %q", got)
+			}
+			if got := req.Header.Get("User-Agent"); got != UserAgent() {
+				t.Errorf("User-Agent = %q", got)
+			}
+		})
+	}
+}
+
+func TestUseVersion(t *testing.T) {
+	asset := fmt.Sprintf("tpix-cli-%s-%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tags/v1.2.3":
+			json.NewEncoder(w).Encode(GithubRelease{TagName: "v1.2.3", Assets: []Asset{{Name: asset, DownloadURL: "https://example.com/" + asset}}})
+		case "/tags/v1.0.0":
+			json.NewEncoder(w).Encode(GithubRelease{TagName: "v1.0.0", Assets: []Asset{{Name: "tpix-cli-plan9-mips.tar.gz"}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	origURL := releaseByTagUrl
+	releaseByTagUrl = srv.URL + "/tags/%s"
+	t.Cleanup(func() { releaseByTagUrl = origURL })
+
+	u := &Updater{}
+	release, err := u.UseVersion("1.2.3")
+	if err != nil {
+		t.Fatalf("UseVersion() error = %v", err)
+	}
+	if release.Version != "v1.2.3" || release.Name != asset {
+		t.Errorf("UseVersion() = %s %s, want v1.2.3 %s", release.Version, release.Name, asset)
+	}
+	if latest, _ := u.Latest(); latest != release {
+		t.Error("Latest() does not return the selected release")
+	}
+
+	for _, v := range []string{"v1.0.0", "v9.9.9", "latest"} {
+		if _, err := u.UseVersion(v); err == nil {
+			t.Errorf("UseVersion(%s) expected error", v)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "tpix")
+
+	if err := rollback(exe); err == nil {
+		t.Fatal("rollback() expected error without a previous version")
+	}
+
+	os.WriteFile(exe, []byte("v1"), 0755)
+	newBin := filepath.Join(dir, "new")
+	os.WriteFile(newBin, []byte("v2"), 0755)
+	if err := replaceBinary(newBin, exe); err != nil {
+		t.Fatalf("replaceBinary() error = %v", err)
+	}
+
+	for _, want := range []string{"v1", "v2"} {
+		if err := rollback(exe); err != nil {
+			t.Fatalf("rollback() error = %v", err)
+		}
+		if data, _ := os.ReadFile(exe); string(data) != want {
+			t.Errorf("after rollback binary = %q, want %q", data, want)
+		}
+	}
+	if _, err := os.Stat(exe + ".rollback"); !os.IsNotExist(err) {
+		t.Errorf("temporary rollback file left behind: %v", err)
+	}
+}
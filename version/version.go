@@ -5,8 +5,15 @@ import (
 	"runtime"
 	"strconv"
 	"time"
+
+	"golang.org/x/mod/semver"
 )
 
+// APIVersion is the version of the TPIX server API this client is written
+// against. A server is compatible if it has the same major version and is
+// at least this version.
+const APIVersion = "1.0.0"
+
 var (
 	Version        = "v0.0.0"
 	BuildTime      = "1706890000"
@@ -17,6 +24,12 @@ func FormatedVersion() string {
 	return fmt.Sprintf("%s-%s %s %s-%s", Version, parsedBuildTime().Format(time.DateOnly), BuildGoVersion, runtime.GOOS, runtime.GOARCH)
 }
 
+// UserAgent is the User-Agent header sent with every request, e.g.
+// "tpix-cli/v1.3.0 (linux/amd64)".
+func UserAgent() string {
+	return fmt.Sprintf("tpix-cli/%s (%s/%s)", Version, runtime.GOOS, runtime.GOARCH)
+}
+
 func parsedBuildTime() time.Time {
 	t, err := strconv.ParseInt(BuildTime, 10, 64)
 	if err != nil {
@@ -25,3 +38,20 @@ func parsedBuildTime() time.Time {
 
 	return time.Unix(t, 0)
 }
+
+// CheckAPIVersion returns an error if a server advertising serverVersion is
+// not compatible with APIVersion.
+func CheckAPIVersion(serverVersion string) error {
+	server, err := normVersion(serverVersion)
+	if err != nil {
+		return fmt.Errorf("server advertised an invalid API version: %w", err)
+	}
+	client, _ := normVersion(APIVersion)
+
+	if semver.Major(server) != semver.Major(client) || semver.Compare(server, client) < 0 {
+		return fmt.Errorf("server API version %s is not compatible with this client (supports %s.x from %s)",
+			serverVersion, semver.Major(client), APIVersion)
+	}
+
+	return nil
+}
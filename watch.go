@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/typstify/tpix-cli/deps"
+)
+
+// watchDebounce is how long pull --watch waits for changes to settle before
+// scanning the project again, as editors often write a file several times
+// when saving.
+const watchDebounce = 300 * time.Millisecond
+
+// importWatcher rescans a project whenever its .typ files change and hands
+// imports it has not seen before to fetch.
+type importWatcher struct {
+	dir      string
+	debounce time.Duration
+	// scanOpts select the files scanned for imports.
+	scanOpts []deps.ScanOption
+	// known holds the keys of the imports already handled.
+	known map[string]bool
+	fetch func([]deps.Dependency) error
+}
+
+func newImportWatcher(dir string, known []deps.Dependency, scanOpts []deps.ScanOption, fetch func([]deps.Dependency) error) *importWatcher {
+	w := &importWatcher{
+		dir:      dir,
+		debounce: watchDebounce,
+		scanOpts: scanOpts,
+		known:    make(map[string]bool),
+		fetch:    fetch,
+	}
+	for _, dep := range known {
+		w.known[dep.Key()] = true
+	}
+	return w
+}
+
+// run watches the project until ctx is cancelled. Errors while fetching
+// are printed and do not stop the watcher, so that a typo in an import can
+// simply be fixed.
+func (w *importWatcher) run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch project: %w", err)
+	}
+	defer watcher.Close()
+
+	skip, err := deps.SkipDirFunc(w.dir, w.scanOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to watch project: %w", err)
+	}
+	if err := watchTree(watcher, w.dir, skip); err != nil {
+		return fmt.Errorf("failed to watch project: %w", err)
+	}
+
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Directories created later have to be watched as well
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watchTree(watcher, event.Name, skip)
+				}
+			}
+			// Any file may be scanned, depending on scanOpts
+			if !event.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename) {
+				continue
+			}
+			timer.Reset(w.debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			warnf("%v\n", err)
+
+		case <-timer.C:
+			if err := w.scan(); err != nil {
+				errorf("%v\n", err)
+			}
+		}
+	}
+}
+
+// scan looks for new imports in the project and fetches them.
+func (w *importWatcher) scan() error {
+	discovered, err := deps.ExtractFromDirectory(w.dir, w.scanOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to scan for imports: %w", err)
+	}
+
+	var added []deps.Dependency
+	for _, dep := range discovered {
+		if !w.known[dep.Key()] {
+			added = append(added, dep)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	if err := w.fetch(added); err != nil {
+		return err
+	}
+	for _, dep := range added {
+		w.known[dep.Key()] = true
+	}
+	return nil
+}
+
+// watchTree adds dir and all directories below it to watcher, skipping
+// hidden directories such as .git and those for which skip returns true,
+// i.e. the ones not scanned for imports.
+func watchTree(watcher *fsnotify.Watcher, dir string, skip func(path string) bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if skip(path) || path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/typstify/tpix-cli/deps"
+)
+
+func TestImportWatcher(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.typ")
+	os.WriteFile(mainFile, []byte(`#import "@preview/cetz:0.3.0": canvas`), 0644)
+
+	known, err := deps.ExtractFromDirectory(dir)
+	if err != nil {
+		t.Fatalf("ExtractFromDirectory() error = %v", err)
+	}
+
+	fetched := make(chan []deps.Dependency, 10)
+	w := newImportWatcher(dir, known, nil, func(added []deps.Dependency) error {
+		fetched <- added
+		return nil
+	})
+	w.debounce = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	}()
+
+	// Editing a file in a new subdirectory adds an import. The file is
+	// rewritten until the watcher, which starts asynchronously, notices.
+	chapter := filepath.Join(dir, "chapters", "intro.typ")
+	os.MkdirAll(filepath.Dir(chapter), 0755)
+	content := []byte("#import \"@preview/cetz:0.3.0\": canvas\n#import \"@preview/tablex:0.0.6\": tablex\n")
+
+	want := []deps.Dependency{{Namespace: "preview", Name: "tablex", Version: "0.0.6"}}
+	deadline := time.After(5 * time.Second)
+	for {
+		os.WriteFile(chapter, content, 0644)
+		select {
+		case added := <-fetched:
+			if !reflect.DeepEqual(added, want) {
+				t.Fatalf("fetched %v, want %v", added, want)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("new import was not fetched")
+		}
+	}
+}
+
+func TestWatchTreeSkipsUnscannedDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"chapters", "node_modules/pkg", "cache/preview", ".git"} {
+		os.MkdirAll(filepath.Join(dir, sub), 0755)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	skip, err := deps.SkipDirFunc(dir, deps.WithExclude("cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watchTree(watcher, dir, skip); err != nil {
+		t.Fatalf("watchTree() error = %v", err)
+	}
+
+	got := watcher.WatchList()
+	slices.Sort(got)
+	if want := []string{dir, filepath.Join(dir, "chapters")}; !slices.Equal(got, want) {
+		t.Errorf("watched %v, want %v", got, want)
+	}
+}